@@ -30,6 +30,21 @@ func main() {
 	simManager.RegisterProject("btree", func() engine.Simulation {
 		return btreesim.NewBTreeSimulation()
 	})
+	simManager.RegisterProject("btree-disk", func() engine.Simulation {
+		return btreesim.NewDiskBTreeSimulation()
+	})
+	simManager.RegisterProject("btree-latching", func() engine.Simulation {
+		return btreesim.NewConcurrentBTreeSimulation()
+	})
+	simManager.RegisterProject("btree-persistent", func() engine.Simulation {
+		return btreesim.NewPersistentBTreeSimulation()
+	})
+	simManager.RegisterProject("btree-employees", func() engine.Simulation {
+		return btreesim.NewEmployeesSimulation()
+	})
+	simManager.RegisterProject("btree-split-policy", func() engine.Simulation {
+		return btreesim.NewSplitPolicySimulation()
+	})
 	simManager.RegisterProject("mvcc", func() engine.Simulation {
 		return mvccsim.NewMVCCSimulation()
 	})
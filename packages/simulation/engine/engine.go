@@ -23,6 +23,7 @@ type Step struct {
 	Description string
 	Execute     func() StepResult
 	Highlights  []protocol.Highlight
+	Data        map[string]interface{} // Snapshot of the visualization data at this step
 }
 
 // StepResult contains the result of executing a step
@@ -256,13 +257,18 @@ func (e *Engine) GetState() *protocol.SimulationState {
 		}
 	}
 
+	data := e.simulation.GetVisualizationData()
+	if e.currentStep >= 0 && e.currentStep < len(e.history) && e.history[e.currentStep].Data != nil {
+		data = e.history[e.currentStep].Data
+	}
+
 	return &protocol.SimulationState{
 		Project:     e.simulation.Name(),
 		Mode:        e.mode,
 		Speed:       e.speed,
 		CurrentStep: currentStep,
 		TotalSteps:  len(e.steps),
-		Data:        e.simulation.GetVisualizationData(),
+		Data:        data,
 	}
 }
 
@@ -340,10 +346,17 @@ func (e *Engine) buildStepUpdate(result StepResult) *protocol.StepUpdateResponse
 		}
 	}
 
+	// Prefer the step's own snapshot so intermediate states render as they
+	// were, not as the final state of the operation
+	data := result.Data
+	if data == nil {
+		data = e.simulation.GetVisualizationData()
+	}
+
 	return &protocol.StepUpdateResponse{
 		Project:    e.simulation.Name(),
 		Step:       step,
 		Highlights: result.Highlights,
-		Data:       e.simulation.GetVisualizationData(),
+		Data:       data,
 	}
 }
@@ -1,13 +1,17 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 )
 
+// ErrDuplicateKey is returned when inserting a key that a unique tree already holds
+var ErrDuplicateKey = errors.New("duplicate key value violates unique constraint")
+
 // BTreeNode represents a node in the B-Tree
 type BTreeNode struct {
 	ID       string   `json:"id"`
-	Keys     []int    `json:"keys"`
+	Keys     []Key    `json:"keys"`
 	Children []string `json:"children"` // IDs of child nodes
 	IsLeaf   bool     `json:"isLeaf"`
 	Parent   string   `json:"parent,omitempty"`
@@ -18,10 +22,27 @@ type BTree struct {
 	Order   int                   `json:"order"` // Maximum number of children
 	RootID  string                `json:"rootId"`
 	Nodes   map[string]*BTreeNode `json:"nodes"`
+	Unique  bool                  `json:"unique"` // Reject duplicate keys
 	nodeSeq int
+	rowSeq  int64
+	version uint64 // Bumped by every modification so cursors can re-seek
+	splits  int
+	merges  int
+
+	// Compression selects prefix compression and the split point choice
+	Compression Compression `json:"compression"`
+
+	// Split selects how inserts make room in full nodes
+	Split SplitConfig `json:"split"`
+	// underfull holds the right-edge nodes a rightmost split created with
+	// fewer than the minimum keys, until a split or delete reaches them
+	underfull map[string]bool
+
+	// Observer, if set, receives a trace event for every split, borrow and merge
+	Observer func(TraceEvent) `json:"-"`
 }
 
-// NewBTree creates a new B-Tree with the given order
+// NewBTree creates a new unique B-Tree with the given order
 func NewBTree(order int) *BTree {
 	if order < 3 {
 		order = 3 // Minimum order for a B-Tree
@@ -30,10 +51,18 @@ func NewBTree(order int) *BTree {
 		Order:   order,
 		RootID:  "",
 		Nodes:   make(map[string]*BTreeNode),
+		Unique:  true,
 		nodeSeq: 0,
 	}
 }
 
+// NewNonUniqueBTree creates a B-Tree that stores duplicates as (key, rowid) entries
+func NewNonUniqueBTree(order int) *BTree {
+	bt := NewBTree(order)
+	bt.Unique = false
+	return bt
+}
+
 // generateNodeID creates a unique node ID
 func (bt *BTree) generateNodeID() string {
 	bt.nodeSeq++
@@ -49,7 +78,7 @@ func (bt *BTree) GetNode(id string) *BTreeNode {
 func (bt *BTree) createNode(isLeaf bool) *BTreeNode {
 	node := &BTreeNode{
 		ID:       bt.generateNodeID(),
-		Keys:     make([]int, 0),
+		Keys:     make([]Key, 0),
 		Children: make([]string, 0),
 		IsLeaf:   isLeaf,
 	}
@@ -58,15 +87,16 @@ func (bt *BTree) createNode(isLeaf bool) *BTreeNode {
 }
 
 // Search finds a key in the B-Tree
-// Returns (nodeID, keyIndex, found)
-func (bt *BTree) Search(key int) (string, int, bool) {
+// Returns (nodeID, keyIndex, found). For a bare key in a non-unique tree this
+// is the first of its duplicates in index order, even when they span nodes.
+func (bt *BTree) Search(key Key) (string, int, bool) {
 	if bt.RootID == "" {
 		return "", -1, false
 	}
 	return bt.searchNode(bt.RootID, key)
 }
 
-func (bt *BTree) searchNode(nodeID string, key int) (string, int, bool) {
+func (bt *BTree) searchNode(nodeID string, key Key) (string, int, bool) {
 	node := bt.Nodes[nodeID]
 	if node == nil {
 		return "", -1, false
@@ -74,26 +104,79 @@ func (bt *BTree) searchNode(nodeID string, key int) (string, int, bool) {
 
 	// Find the first key >= key
 	i := 0
-	for i < len(node.Keys) && key > node.Keys[i] {
+	for i < len(node.Keys) && key.Compare(node.Keys[i]) > 0 {
 		i++
 	}
 
 	// Check if we found the key
-	if i < len(node.Keys) && key == node.Keys[i] {
+	if i < len(node.Keys) && key.Compare(node.Keys[i]) == 0 {
 		return nodeID, i, true
 	}
 
 	// If leaf, key not found
 	if node.IsLeaf {
+		if i < len(node.Keys) && matchesEntry(node.Keys[i], key) {
+			return nodeID, i, true
+		}
 		return nodeID, i, false
 	}
 
-	// Recurse to child
-	return bt.searchNode(node.Children[i], key)
+	// Recurse to child. Earlier duplicates of a bare key may live in the
+	// left subtree of the first matching entry.
+	childID, childIndex, found := bt.searchNode(node.Children[i], key)
+	if !found && i < len(node.Keys) && matchesEntry(node.Keys[i], key) {
+		return nodeID, i, true
+	}
+	return childID, childIndex, found
+}
+
+// matchesEntry reports whether a stored entry is a duplicate of a bare key
+func matchesEntry(entry, key Key) bool {
+	if _, exact := key.(RowKey); exact {
+		return false
+	}
+	return EntryKey(entry).Compare(key) == 0
+}
+
+// EntryFor returns the entry Insert would store for key, or the error it
+// would fail with. Non-unique trees wrap bare keys in a RowKey with the next
+// row ID, so new duplicates are placed after existing ones.
+func (bt *BTree) EntryFor(key Key) (Key, error) {
+	if bt.Unique {
+		if _, _, found := bt.Search(EntryKey(key)); found {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateKey, EntryKey(key))
+		}
+		return key, nil
+	}
+	if row, ok := key.(RowKey); ok {
+		if _, _, found := bt.Search(row); found {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateKey, row)
+		}
+		return row, nil
+	}
+	return RowKey{Key: key, RowID: bt.rowSeq + 1}, nil
 }
 
 // Insert adds a key to the B-Tree
-func (bt *BTree) Insert(key int) {
+func (bt *BTree) Insert(key Key) error {
+	entry, err := bt.EntryFor(key)
+	if err != nil {
+		return err
+	}
+	if row, ok := entry.(RowKey); ok && row.RowID > bt.rowSeq {
+		bt.rowSeq = row.RowID
+	}
+	bt.insertEntry(entry)
+	return nil
+}
+
+// InsertRow adds an entry for key pointing at a specific row
+func (bt *BTree) InsertRow(key Key, rowID int64) error {
+	return bt.Insert(RowKey{Key: EntryKey(key), RowID: rowID})
+}
+
+func (bt *BTree) insertEntry(key Key) {
+	bt.version++
 	if bt.RootID == "" {
 		// Create root node
 		root := bt.createNode(true)
@@ -102,6 +185,11 @@ func (bt *BTree) Insert(key int) {
 		return
 	}
 
+	if bt.bottomUp() {
+		bt.insertBottomUp(key)
+		return
+	}
+
 	root := bt.Nodes[bt.RootID]
 	if len(root.Keys) == bt.Order-1 {
 		// Root is full, need to split
@@ -109,21 +197,22 @@ func (bt *BTree) Insert(key int) {
 		newRoot.Children = append(newRoot.Children, bt.RootID)
 		root.Parent = newRoot.ID
 		bt.RootID = newRoot.ID
-		bt.splitChild(newRoot.ID, 0)
+		bt.emit(TraceEvent{Type: EventRootGrown, NodeID: root.ID, TargetID: newRoot.ID})
+		bt.splitChild(newRoot.ID, 0, key)
 		bt.insertNonFull(newRoot.ID, key)
 	} else {
 		bt.insertNonFull(bt.RootID, key)
 	}
 }
 
-func (bt *BTree) insertNonFull(nodeID string, key int) {
+func (bt *BTree) insertNonFull(nodeID string, key Key) {
 	node := bt.Nodes[nodeID]
 
 	if node.IsLeaf {
 		// Insert key in sorted order
 		i := len(node.Keys) - 1
-		node.Keys = append(node.Keys, 0)
-		for i >= 0 && key < node.Keys[i] {
+		node.Keys = append(node.Keys, nil)
+		for i >= 0 && key.Compare(node.Keys[i]) < 0 {
 			node.Keys[i+1] = node.Keys[i]
 			i--
 		}
@@ -131,15 +220,24 @@ func (bt *BTree) insertNonFull(nodeID string, key int) {
 	} else {
 		// Find child to recurse into
 		i := len(node.Keys) - 1
-		for i >= 0 && key < node.Keys[i] {
+		for i >= 0 && key.Compare(node.Keys[i]) < 0 {
 			i--
 		}
 		i++
 
 		child := bt.Nodes[node.Children[i]]
+		if len(child.Keys) == bt.Order-1 && bt.Split.Policy == SplitRedistribute && bt.redistribute(nodeID, i) {
+			// The separator moved, so the key may now belong to the sibling,
+			// which the moved keys can have filled
+			i = 0
+			for i < len(node.Keys) && key.Compare(node.Keys[i]) > 0 {
+				i++
+			}
+			child = bt.Nodes[node.Children[i]]
+		}
 		if len(child.Keys) == bt.Order-1 {
-			bt.splitChild(nodeID, i)
-			if key > node.Keys[i] {
+			bt.splitChild(nodeID, i, key)
+			if key.Compare(node.Keys[i]) > 0 {
 				i++
 			}
 		}
@@ -147,18 +245,22 @@ func (bt *BTree) insertNonFull(nodeID string, key int) {
 	}
 }
 
-func (bt *BTree) splitChild(parentID string, childIndex int) {
+// splitChild splits the full child at childIndex of parent while key is
+// being inserted, moving the keys right of the split point into a new node
+func (bt *BTree) splitChild(parentID string, childIndex int, key Key) {
 	parent := bt.Nodes[parentID]
 	fullChild := bt.Nodes[parent.Children[childIndex]]
 
 	// Create new node for right half
+	bt.splits++
 	newNode := bt.createNode(fullChild.IsLeaf)
 	newNode.Parent = parentID
 
-	mid := (bt.Order - 1) / 2
+	mid := bt.splitIndex(fullChild, key)
 
 	// Move median key up to parent
 	medianKey := fullChild.Keys[mid]
+	bt.emit(TraceEvent{Type: EventMedianChosen, NodeID: fullChild.ID, ParentID: parentID, Key: medianKey, Index: mid})
 
 	// Move keys to new node
 	newNode.Keys = append(newNode.Keys, fullChild.Keys[mid+1:]...)
@@ -175,18 +277,45 @@ func (bt *BTree) splitChild(parentID string, childIndex int) {
 		}
 	}
 
+	bt.emit(TraceEvent{
+		Type:     EventKeysMoved,
+		NodeID:   fullChild.ID,
+		TargetID: newNode.ID,
+		ParentID: parentID,
+		Keys:     append([]Key{}, newNode.Keys...),
+	})
+
 	// Insert median key and new child into parent
 	parent.Keys = insertAt(parent.Keys, childIndex, medianKey)
 	parent.Children = insertAtStr(parent.Children, childIndex+1, newNode.ID)
+	bt.emit(TraceEvent{Type: EventSeparatorPushed, NodeID: fullChild.ID, ParentID: parentID, Key: medianKey, Index: childIndex})
+
+	// Only a rightmost split leaves the new node under the minimum, and
+	// appends are about to fill it
+	delete(bt.underfull, fullChild.ID)
+	if len(newNode.Keys) < bt.minKeys() {
+		if bt.underfull == nil {
+			bt.underfull = make(map[string]bool)
+		}
+		bt.underfull[newNode.ID] = true
+	}
 }
 
-// Delete removes a key from the B-Tree
-func (bt *BTree) Delete(key int) bool {
+// Delete removes a key from the B-Tree. A bare key in a non-unique tree
+// removes its first entry in index order; a RowKey removes that exact entry.
+func (bt *BTree) Delete(key Key) bool {
 	if bt.RootID == "" {
 		return false
 	}
 
-	deleted := bt.deleteFromNode(bt.RootID, key)
+	nodeID, index, found := bt.Search(key)
+	if !found {
+		return false
+	}
+	entry := bt.Nodes[nodeID].Keys[index]
+
+	bt.version++
+	deleted := bt.deleteFromNode(bt.RootID, entry)
 
 	// If root has no keys and has a child, make child the new root
 	root := bt.Nodes[bt.RootID]
@@ -195,36 +324,64 @@ func (bt *BTree) Delete(key int) bool {
 		bt.RootID = root.Children[0]
 		bt.Nodes[bt.RootID].Parent = ""
 		delete(bt.Nodes, oldRootID)
+		bt.emit(TraceEvent{Type: EventRootShrunk, NodeID: bt.RootID, TargetID: oldRootID})
 	}
 
 	return deleted
 }
 
-func (bt *BTree) deleteFromNode(nodeID string, key int) bool {
+// minKeys is the fewest keys a non-root node may hold. Preemptive splits of
+// a full node leave (Order-2)/2 keys on the smaller side, so that is also the
+// threshold below which deletes must refill a node. Order 3 splits bottom-up
+// into halves of one key each.
+func (bt *BTree) minKeys() int {
+	if bt.Order == 3 {
+		return 1
+	}
+	return (bt.Order - 2) / 2
+}
+
+// refillsAhead reports whether deletes refill children before descending
+// into them. At order 3 two one-key siblings and their separator do not fit
+// in one node, so deletes descend first and repair underflow on the way up.
+func (bt *BTree) refillsAhead() bool {
+	return bt.Order > 3
+}
+
+func (bt *BTree) deleteFromNode(nodeID string, key Key) bool {
 	node := bt.Nodes[nodeID]
-	minKeys := (bt.Order - 1) / 2
+	minKeys := bt.minKeys()
+	// The descent refilled this node if it was under the minimum
+	delete(bt.underfull, nodeID)
 
 	// Find key position
 	i := 0
-	for i < len(node.Keys) && key > node.Keys[i] {
+	for i < len(node.Keys) && key.Compare(node.Keys[i]) > 0 {
 		i++
 	}
 
 	if node.IsLeaf {
 		// Case 1: Key is in leaf node
-		if i < len(node.Keys) && node.Keys[i] == key {
+		if i < len(node.Keys) && node.Keys[i].Compare(key) == 0 {
 			node.Keys = removeAt(node.Keys, i)
 			return true
 		}
 		return false
 	}
 
-	if i < len(node.Keys) && node.Keys[i] == key {
+	if i < len(node.Keys) && node.Keys[i].Compare(key) == 0 {
 		// Case 2: Key is in internal node
 		leftChild := bt.Nodes[node.Children[i]]
 		rightChild := bt.Nodes[node.Children[i+1]]
 
-		if len(leftChild.Keys) > minKeys {
+		if !bt.refillsAhead() {
+			// Replace with predecessor and repair the left child afterwards
+			pred := bt.getPredecessor(node.Children[i])
+			node.Keys[i] = pred
+			deleted := bt.deleteFromNode(node.Children[i], pred)
+			bt.repairChild(nodeID, i)
+			return deleted
+		} else if len(leftChild.Keys) > minKeys {
 			// Replace with predecessor
 			pred := bt.getPredecessor(node.Children[i])
 			node.Keys[i] = pred
@@ -243,18 +400,28 @@ func (bt *BTree) deleteFromNode(nodeID string, key int) bool {
 
 	// Case 3: Key is in subtree
 	child := bt.Nodes[node.Children[i]]
-	if len(child.Keys) == minKeys {
-		bt.fillChild(nodeID, i)
+	if !bt.refillsAhead() {
+		deleted := bt.deleteFromNode(node.Children[i], key)
+		bt.repairChild(nodeID, i)
+		return deleted
 	}
-
-	// After fill, the child index might have changed
-	if i > len(node.Keys) {
-		return bt.deleteFromNode(node.Children[i-1], key)
+	if len(child.Keys) <= minKeys {
+		// After fill, the child index might have changed
+		i = bt.fillChild(nodeID, i, minKeys+1)
 	}
 	return bt.deleteFromNode(node.Children[i], key)
 }
 
-func (bt *BTree) getPredecessor(nodeID string) int {
+// repairChild refills the child at childIndex if a delete below left it
+// under the minimum
+func (bt *BTree) repairChild(parentID string, childIndex int) {
+	parent := bt.Nodes[parentID]
+	if len(bt.Nodes[parent.Children[childIndex]].Keys) < bt.minKeys() {
+		bt.fillChild(parentID, childIndex, bt.minKeys())
+	}
+}
+
+func (bt *BTree) getPredecessor(nodeID string) Key {
 	node := bt.Nodes[nodeID]
 	for !node.IsLeaf {
 		node = bt.Nodes[node.Children[len(node.Children)-1]]
@@ -262,7 +429,7 @@ func (bt *BTree) getPredecessor(nodeID string) int {
 	return node.Keys[len(node.Keys)-1]
 }
 
-func (bt *BTree) getSuccessor(nodeID string) int {
+func (bt *BTree) getSuccessor(nodeID string) Key {
 	node := bt.Nodes[nodeID]
 	for !node.IsLeaf {
 		node = bt.Nodes[node.Children[0]]
@@ -270,34 +437,35 @@ func (bt *BTree) getSuccessor(nodeID string) int {
 	return node.Keys[0]
 }
 
-func (bt *BTree) fillChild(parentID string, childIndex int) {
+// fillChild tops up a child to want keys, merging it with a sibling if
+// borrowing cannot, and returns the index of the child that now holds its keys
+func (bt *BTree) fillChild(parentID string, childIndex int, want int) int {
 	parent := bt.Nodes[parentID]
-	minKeys := (bt.Order - 1) / 2
+	minKeys := bt.minKeys()
+	child := bt.Nodes[parent.Children[childIndex]]
 
-	// Try borrowing from left sibling
-	if childIndex > 0 {
-		leftSibling := bt.Nodes[parent.Children[childIndex-1]]
-		if len(leftSibling.Keys) > minKeys {
+	// Borrow from a sibling with keys to spare. A node a rightmost split
+	// left under the minimum may need more than one key.
+	for len(child.Keys) < want {
+		if childIndex > 0 && len(bt.Nodes[parent.Children[childIndex-1]].Keys) > minKeys {
 			bt.borrowFromLeft(parentID, childIndex)
-			return
-		}
-	}
-
-	// Try borrowing from right sibling
-	if childIndex < len(parent.Children)-1 {
-		rightSibling := bt.Nodes[parent.Children[childIndex+1]]
-		if len(rightSibling.Keys) > minKeys {
+		} else if childIndex < len(parent.Children)-1 && len(bt.Nodes[parent.Children[childIndex+1]].Keys) > minKeys {
 			bt.borrowFromRight(parentID, childIndex)
-			return
+		} else {
+			break
 		}
 	}
+	if len(child.Keys) >= want {
+		return childIndex
+	}
 
 	// Merge with sibling
 	if childIndex > 0 {
 		bt.mergeChildren(parentID, childIndex-1)
-	} else {
-		bt.mergeChildren(parentID, childIndex)
+		return childIndex - 1
 	}
+	bt.mergeChildren(parentID, childIndex)
+	return childIndex
 }
 
 func (bt *BTree) borrowFromLeft(parentID string, childIndex int) {
@@ -306,7 +474,8 @@ func (bt *BTree) borrowFromLeft(parentID string, childIndex int) {
 	leftSibling := bt.Nodes[parent.Children[childIndex-1]]
 
 	// Move parent key down to child
-	child.Keys = insertAt(child.Keys, 0, parent.Keys[childIndex-1])
+	separator := parent.Keys[childIndex-1]
+	child.Keys = insertAt(child.Keys, 0, separator)
 
 	// Move sibling's last key up to parent
 	parent.Keys[childIndex-1] = leftSibling.Keys[len(leftSibling.Keys)-1]
@@ -319,6 +488,16 @@ func (bt *BTree) borrowFromLeft(parentID string, childIndex int) {
 		child.Children = insertAtStr(child.Children, 0, movedChildID)
 		bt.Nodes[movedChildID].Parent = child.ID
 	}
+
+	bt.emit(TraceEvent{
+		Type:      EventBorrowLeft,
+		NodeID:    child.ID,
+		TargetID:  leftSibling.ID,
+		ParentID:  parentID,
+		Key:       separator,
+		Separator: parent.Keys[childIndex-1],
+		Index:     childIndex - 1,
+	})
 }
 
 func (bt *BTree) borrowFromRight(parentID string, childIndex int) {
@@ -327,7 +506,8 @@ func (bt *BTree) borrowFromRight(parentID string, childIndex int) {
 	rightSibling := bt.Nodes[parent.Children[childIndex+1]]
 
 	// Move parent key down to child
-	child.Keys = append(child.Keys, parent.Keys[childIndex])
+	separator := parent.Keys[childIndex]
+	child.Keys = append(child.Keys, separator)
 
 	// Move sibling's first key up to parent
 	parent.Keys[childIndex] = rightSibling.Keys[0]
@@ -340,6 +520,16 @@ func (bt *BTree) borrowFromRight(parentID string, childIndex int) {
 		child.Children = append(child.Children, movedChildID)
 		bt.Nodes[movedChildID].Parent = child.ID
 	}
+
+	bt.emit(TraceEvent{
+		Type:      EventBorrowRight,
+		NodeID:    child.ID,
+		TargetID:  rightSibling.ID,
+		ParentID:  parentID,
+		Key:       separator,
+		Separator: parent.Keys[childIndex],
+		Index:     childIndex,
+	})
 }
 
 func (bt *BTree) mergeChildren(parentID string, leftIndex int) {
@@ -348,7 +538,9 @@ func (bt *BTree) mergeChildren(parentID string, leftIndex int) {
 	rightChild := bt.Nodes[parent.Children[leftIndex+1]]
 
 	// Move parent key down to left child
-	leftChild.Keys = append(leftChild.Keys, parent.Keys[leftIndex])
+	bt.merges++
+	separator := parent.Keys[leftIndex]
+	leftChild.Keys = append(leftChild.Keys, separator)
 
 	// Move all keys from right child to left child
 	leftChild.Keys = append(leftChild.Keys, rightChild.Keys...)
@@ -367,27 +559,44 @@ func (bt *BTree) mergeChildren(parentID string, leftIndex int) {
 
 	// Delete right child
 	delete(bt.Nodes, rightChild.ID)
+	delete(bt.underfull, rightChild.ID)
+
+	bt.emit(TraceEvent{
+		Type:     EventMerged,
+		NodeID:   leftChild.ID,
+		TargetID: rightChild.ID,
+		ParentID: parentID,
+		Key:      separator,
+		Keys:     append([]Key{}, rightChild.Keys...),
+		Index:    leftIndex,
+	})
 }
 
-// RangeSearch finds all keys in the range [start, end]
-func (bt *BTree) RangeSearch(start, end int) []int {
-	result := []int{}
+// DeleteRow removes the entry for key pointing at rowID
+func (bt *BTree) DeleteRow(key Key, rowID int64) bool {
+	return bt.Delete(RowKey{Key: EntryKey(key), RowID: rowID})
+}
+
+// RangeSearch finds all keys in the range [start, end], including every
+// duplicate entry of the bounds
+func (bt *BTree) RangeSearch(start, end Key) []Key {
+	result := []Key{}
 	if bt.RootID == "" {
 		return result
 	}
-	bt.rangeSearchNode(bt.RootID, start, end, &result)
+	bt.rangeSearchNode(bt.RootID, EntryKey(start), EntryKey(end), &result)
 	return result
 }
 
-func (bt *BTree) rangeSearchNode(nodeID string, start, end int, result *[]int) {
+func (bt *BTree) rangeSearchNode(nodeID string, start, end Key, result *[]Key) {
 	node := bt.Nodes[nodeID]
 
 	i := 0
-	for i < len(node.Keys) && node.Keys[i] < start {
+	for i < len(node.Keys) && EntryKey(node.Keys[i]).Compare(start) < 0 {
 		i++
 	}
 
-	for i < len(node.Keys) && node.Keys[i] <= end {
+	for i < len(node.Keys) && EntryKey(node.Keys[i]).Compare(end) <= 0 {
 		if !node.IsLeaf {
 			bt.rangeSearchNode(node.Children[i], start, end, result)
 		}
@@ -400,18 +609,83 @@ func (bt *BTree) rangeSearchNode(nodeID string, start, end int, result *[]int) {
 	}
 }
 
+// PrefixSearch finds all keys starting with prefix, e.g. every ("Smith", id)
+// entry of a (last_name, id) index for the prefix ("Smith") or "Smith"
+func (bt *BTree) PrefixSearch(prefix Key) []Key {
+	result := []Key{}
+	if bt.RootID == "" {
+		return result
+	}
+	bt.prefixSearchNode(bt.RootID, bt.PrefixKey(prefix), &result)
+	return result
+}
+
+// PrefixKey returns the key PrefixSearch descends with. Composite keys sort
+// apart from bare values, so on a tree of composite keys a bare value
+// becomes a one-column prefix.
+func (bt *BTree) PrefixKey(prefix Key) Key {
+	if _, ok := prefix.(CompositeKey); ok || bt.RootID == "" {
+		return prefix
+	}
+	root := bt.Nodes[bt.RootID]
+	if len(root.Keys) > 0 {
+		if _, ok := EntryKey(root.Keys[0]).(CompositeKey); ok {
+			return CompositeKey{prefix}
+		}
+	}
+	return prefix
+}
+
+// prefixSearchNode returns false once a key past the prefix range is seen
+func (bt *BTree) prefixSearchNode(nodeID string, prefix Key, result *[]Key) bool {
+	node := bt.Nodes[nodeID]
+
+	// Keys sharing a prefix are contiguous and never sort before the prefix itself
+	i := 0
+	for i < len(node.Keys) && node.Keys[i].Compare(prefix) < 0 {
+		i++
+	}
+
+	for ; i < len(node.Keys); i++ {
+		if !node.IsLeaf && !bt.prefixSearchNode(node.Children[i], prefix, result) {
+			return false
+		}
+		if !HasPrefix(node.Keys[i], prefix) {
+			return false
+		}
+		*result = append(*result, node.Keys[i])
+	}
+
+	if !node.IsLeaf {
+		return bt.prefixSearchNode(node.Children[i], prefix, result)
+	}
+	return true
+}
+
 // Clone creates a deep copy of the B-Tree
 func (bt *BTree) Clone() *BTree {
 	clone := &BTree{
 		Order:   bt.Order,
 		RootID:  bt.RootID,
 		Nodes:   make(map[string]*BTreeNode),
+		Unique:  bt.Unique,
 		nodeSeq: bt.nodeSeq,
+		rowSeq:  bt.rowSeq,
+		version: bt.version,
+		splits:  bt.splits,
+		merges:  bt.merges,
+
+		Compression: bt.Compression,
+		Split:       bt.Split,
+		underfull:   make(map[string]bool, len(bt.underfull)),
+	}
+	for id := range bt.underfull {
+		clone.underfull[id] = true
 	}
 	for id, node := range bt.Nodes {
 		clone.Nodes[id] = &BTreeNode{
 			ID:       node.ID,
-			Keys:     append([]int{}, node.Keys...),
+			Keys:     append([]Key{}, node.Keys...),
 			Children: append([]string{}, node.Children...),
 			IsLeaf:   node.IsLeaf,
 			Parent:   node.Parent,
@@ -420,9 +694,54 @@ func (bt *BTree) Clone() *BTree {
 	return clone
 }
 
+// Height returns the number of levels in the tree
+func (bt *BTree) Height() int {
+	height := 0
+	nodeID := bt.RootID
+	for nodeID != "" {
+		height++
+		node := bt.Nodes[nodeID]
+		if node.IsLeaf {
+			break
+		}
+		nodeID = node.Children[0]
+	}
+	return height
+}
+
+// Levels returns node IDs level by level from the root, left to right
+func (bt *BTree) Levels() [][]string {
+	levels := [][]string{}
+	if bt.RootID == "" {
+		return levels
+	}
+	current := []string{bt.RootID}
+	for len(current) > 0 {
+		levels = append(levels, current)
+		next := []string{}
+		for _, id := range current {
+			next = append(next, bt.Nodes[id].Children...)
+		}
+		current = next
+	}
+	return levels
+}
+
+// FillFactor returns the fraction of key slots in use across all nodes
+func (bt *BTree) FillFactor() float64 {
+	if len(bt.Nodes) == 0 {
+		return 0
+	}
+	keys := 0
+	for _, node := range bt.Nodes {
+		keys += len(node.Keys)
+	}
+	return float64(keys) / float64(len(bt.Nodes)*(bt.Order-1))
+}
+
 // Helper functions
-func insertAt(slice []int, index int, value int) []int {
-	slice = append(slice, 0)
+func insertAt(slice []Key, index int, value Key) []Key {
+	slice = append(slice, nil)
 	copy(slice[index+1:], slice[index:])
 	slice[index] = value
 	return slice
@@ -435,7 +754,7 @@ func insertAtStr(slice []string, index int, value string) []string {
 	return slice
 }
 
-func removeAt(slice []int, index int) []int {
+func removeAt(slice []Key, index int) []Key {
 	return append(slice[:index], slice[index+1:]...)
 }
 
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTreeNotEmpty is returned when bulk loading into a tree that already has keys
+var ErrTreeNotEmpty = errors.New("bulk load requires an empty tree")
+
+// BulkLoad builds the tree bottom-up from keys sorted in ascending order, the
+// way CREATE INDEX does: leaves are packed left to right up to fillFactor,
+// one separator is promoted between neighbouring nodes, and the separators
+// are packed into the next level until a single root remains.
+func (bt *BTree) BulkLoad(sortedKeys []Key, fillFactor float64) error {
+	if bt.RootID != "" {
+		return ErrTreeNotEmpty
+	}
+	if fillFactor <= 0 || fillFactor > 1 {
+		return fmt.Errorf("fill factor %.2f must be in (0, 1]", fillFactor)
+	}
+
+	entries, err := bt.bulkEntries(sortedKeys)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	bt.version++
+	capacity := bt.bulkCapacity(fillFactor)
+	items := entries
+	var children []string
+	for {
+		sizes := bt.chunkSizes(len(items), capacity)
+		level, separators := bt.packLevel(items, children, sizes)
+		if len(level) == 1 {
+			bt.RootID = level[0]
+			return nil
+		}
+		items, children = separators, level
+	}
+}
+
+// bulkEntries validates the input order and wraps keys as the tree would on insert
+func (bt *BTree) bulkEntries(sortedKeys []Key) ([]Key, error) {
+	entries := make([]Key, 0, len(sortedKeys))
+	for i, key := range sortedKeys {
+		if i > 0 {
+			c := EntryKey(key).Compare(EntryKey(sortedKeys[i-1]))
+			if c < 0 {
+				return nil, fmt.Errorf("keys are not sorted: %s follows %s", key, sortedKeys[i-1])
+			}
+			if c == 0 && bt.Unique {
+				return nil, fmt.Errorf("%w: %s", ErrDuplicateKey, EntryKey(key))
+			}
+		}
+		if !bt.Unique {
+			row, ok := key.(RowKey)
+			if !ok {
+				row = RowKey{Key: key, RowID: bt.rowSeq + 1}
+			}
+			if row.RowID > bt.rowSeq {
+				bt.rowSeq = row.RowID
+			}
+			key = row
+		}
+		entries = append(entries, key)
+	}
+	return entries, nil
+}
+
+// bulkCapacity is the number of keys packed into each node for a fill factor
+func (bt *BTree) bulkCapacity(fillFactor float64) int {
+	capacity := int(fillFactor * float64(bt.Order-1))
+	if capacity < bt.minKeys() {
+		capacity = bt.minKeys()
+	}
+	if capacity < 1 {
+		capacity = 1
+	}
+	if capacity > bt.Order-1 {
+		capacity = bt.Order - 1
+	}
+	return capacity
+}
+
+// chunkSizes splits n keys into nodes of the given capacity with one
+// separator between neighbours. Only the last node can come up short; if it
+// falls below minimum occupancy it is merged with or rebalanced against its
+// left neighbour.
+func (bt *BTree) chunkSizes(n, capacity int) []int {
+	if n <= capacity {
+		return []int{n}
+	}
+
+	count := (n + capacity + 1) / (capacity + 1) // ceil((n+1)/(capacity+1))
+	sizes := make([]int, count)
+	for i := range sizes {
+		sizes[i] = capacity
+	}
+	last := n - (count-1)*(capacity+1)
+	sizes[count-1] = last
+
+	minFill := bt.minKeys()
+	if minFill < 1 {
+		minFill = 1
+	}
+	if last < minFill {
+		combined := sizes[count-2] + 1 + last
+		if combined <= bt.Order-1 {
+			sizes = sizes[:count-1]
+			sizes[count-2] = combined
+		} else {
+			sizes[count-2] = (combined - 1) / 2
+			sizes[count-1] = combined - 1 - sizes[count-2]
+		}
+	}
+	return sizes
+}
+
+// packLevel creates one level of nodes from items and, for internal levels,
+// the nodes of the level below. It returns the new node IDs and the
+// separators promoted between them.
+func (bt *BTree) packLevel(items []Key, children []string, sizes []int) ([]string, []Key) {
+	isLeaf := children == nil
+	level := make([]string, 0, len(sizes))
+	separators := make([]Key, 0, len(sizes)-1)
+
+	pos, childPos := 0, 0
+	for i, size := range sizes {
+		node := bt.createNode(isLeaf)
+		node.Keys = append(node.Keys, items[pos:pos+size]...)
+		pos += size
+
+		if !isLeaf {
+			node.Children = append(node.Children, children[childPos:childPos+size+1]...)
+			childPos += size + 1
+			for _, childID := range node.Children {
+				bt.Nodes[childID].Parent = node.ID
+			}
+		}
+		level = append(level, node.ID)
+
+		if i < len(sizes)-1 {
+			separators = append(separators, items[pos])
+			pos++
+		}
+	}
+	return level, separators
+}
@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Compression selects how node keys are stored. Neither setting changes
+// which keys the tree holds or how Order bounds a node; they change the
+// bytes each node needs, which decides how many keys fit in a page.
+type Compression struct {
+	// Prefix stores the longest prefix shared by every key of a node once,
+	// and each key as the suffix that follows it
+	Prefix bool `json:"prefix"`
+
+	// SuffixTruncation makes a split promote the shortest key near the
+	// median, and lays out each internal key as the shortest prefix that is
+	// still greater than every key of its left subtree.
+	//
+	// Internal keys of this B-Tree are entries in their own right, so the
+	// tree itself keeps them whole; the truncated layout is what a B+-tree,
+	// whose separators only route searches, would store. The split point
+	// has little room to move either: after a proactive split both halves
+	// must hold minKeys, which leaves at most one position of slack.
+	SuffixTruncation bool `json:"suffixTruncation"`
+}
+
+// pointerBytes is the size of a child pointer counted in fan-out estimates
+const pointerBytes = 4
+
+// StoredKey is a key as a compressed node stores it
+type StoredKey struct {
+	Key       Key      `json:"key"`
+	Suffix    BytesKey `json:"suffix"`    // Bytes stored after the node prefix
+	Truncated bool     `json:"truncated"` // Suffix truncation dropped trailing bytes
+}
+
+// NodeLayout is the byte layout of one node
+type NodeLayout struct {
+	NodeID       string      `json:"nodeId"`
+	Prefix       BytesKey    `json:"prefix"`
+	Keys         []StoredKey `json:"keys"`
+	LogicalBytes int         `json:"logicalBytes"` // Sum of the full encoded keys
+	StoredBytes  int         `json:"storedBytes"`  // Prefix once plus each suffix
+}
+
+// CompressionStats compares logical and stored key bytes across the tree,
+// and the fan-out each would give in a page of PageSize bytes
+type CompressionStats struct {
+	PageSize       int     `json:"pageSize"`
+	LogicalBytes   int     `json:"logicalBytes"`
+	StoredBytes    int     `json:"storedBytes"`
+	Ratio          float64 `json:"ratio"` // StoredBytes / LogicalBytes
+	LogicalFanOut  int     `json:"logicalFanOut"`
+	StoredFanOut   int     `json:"storedFanOut"`
+	SeparatorBytes int     `json:"separatorBytes"` // Key bytes held by internal nodes
+}
+
+// keyBytes is the order-preserving byte encoding the compression accounting
+// works on: big-endian integers with the sign bit flipped, raw string and
+// byte contents, composite parts concatenated, and a row ID after the key.
+// A string or byte part followed by more bytes is escaped and terminated
+// (see appendPart), or ("a", "z") would encode greater than ("ab", "a").
+func keyBytes(k Key) []byte {
+	switch k := k.(type) {
+	case StringKey:
+		return []byte(k)
+	case BytesKey:
+		return append([]byte{}, k...)
+	}
+	return appendPart(nil, k)
+}
+
+// appendPart appends the encoding of k as part of a longer key. Fixed-width
+// integers need nothing more; strings and bytes have each 0x00 escaped as
+// 0x00 0xFF and end in 0x00 0x00, which sorts below any escaped content, so
+// a shorter part still sorts before every longer part it prefixes.
+func appendPart(buf []byte, k Key) []byte {
+	switch k := k.(type) {
+	case IntKey:
+		return binary.BigEndian.AppendUint64(buf, uint64(k)^(1<<63))
+	case StringKey:
+		return appendTerminated(buf, []byte(k))
+	case BytesKey:
+		return appendTerminated(buf, k)
+	case CompositeKey:
+		for _, part := range k {
+			buf = appendPart(buf, part)
+		}
+		return buf
+	case RowKey:
+		buf = appendPart(buf, k.Key)
+		return binary.BigEndian.AppendUint64(buf, uint64(k.RowID))
+	}
+	return appendTerminated(buf, []byte(k.String()))
+}
+
+func appendTerminated(buf, part []byte) []byte {
+	for _, b := range part {
+		buf = append(buf, b)
+		if b == 0x00 {
+			buf = append(buf, 0xFF)
+		}
+	}
+	return append(buf, 0x00, 0x00)
+}
+
+// NodeLayout returns the byte layout of a node under the tree's compression
+// settings. Without prefix compression the prefix is empty.
+func (bt *BTree) NodeLayout(nodeID string) NodeLayout {
+	node := bt.Nodes[nodeID]
+	layout := NodeLayout{NodeID: nodeID, Prefix: BytesKey{}, Keys: []StoredKey{}}
+	if node == nil {
+		return layout
+	}
+
+	encoded := make([][]byte, len(node.Keys))
+	truncated := make([]bool, len(node.Keys))
+	for i, k := range node.Keys {
+		encoded[i] = keyBytes(k)
+		layout.LogicalBytes += len(encoded[i])
+		if bt.Compression.SuffixTruncation && !node.IsLeaf {
+			separator := shortestSeparator(keyBytes(bt.subtreeMax(node.Children[i])), encoded[i])
+			truncated[i] = len(separator) < len(encoded[i])
+			encoded[i] = separator
+		}
+	}
+	if bt.Compression.Prefix && len(encoded) > 1 {
+		layout.Prefix = commonPrefix(encoded)
+	}
+
+	layout.StoredBytes = len(layout.Prefix)
+	for i, k := range node.Keys {
+		suffix := encoded[i][len(layout.Prefix):]
+		layout.Keys = append(layout.Keys, StoredKey{Key: k, Suffix: suffix, Truncated: truncated[i]})
+		layout.StoredBytes += len(suffix)
+	}
+	return layout
+}
+
+// CompressionStats totals key bytes over every node. Fan-out is estimated
+// from the average internal-node key plus a child pointer, or from all
+// nodes while the tree is a single leaf.
+func (bt *BTree) CompressionStats(pageSize int) CompressionStats {
+	stats := CompressionStats{PageSize: pageSize}
+	internalKeys, internalLogical, internalStored := 0, 0, 0
+	allKeys := 0
+	for id, node := range bt.Nodes {
+		layout := bt.NodeLayout(id)
+		stats.LogicalBytes += layout.LogicalBytes
+		stats.StoredBytes += layout.StoredBytes
+		allKeys += len(node.Keys)
+		if !node.IsLeaf {
+			internalKeys += len(node.Keys)
+			internalLogical += layout.LogicalBytes
+			internalStored += layout.StoredBytes
+		}
+	}
+	stats.SeparatorBytes = internalStored
+	if stats.LogicalBytes > 0 {
+		stats.Ratio = float64(stats.StoredBytes) / float64(stats.LogicalBytes)
+	}
+
+	keys, logical, stored := internalKeys, internalLogical, internalStored
+	if keys == 0 {
+		keys, logical, stored = allKeys, stats.LogicalBytes, stats.StoredBytes
+	}
+	if keys > 0 {
+		stats.LogicalFanOut = fanOut(pageSize, float64(logical)/float64(keys))
+		stats.StoredFanOut = fanOut(pageSize, float64(stored)/float64(keys))
+	}
+	return stats
+}
+
+// fanOut is how many children a page holds when each key averages keyBytes
+func fanOut(pageSize int, keyBytes float64) int {
+	return int(float64(pageSize)/(keyBytes+pointerBytes)) + 1
+}
+
+// splitPoint picks the index of the key a full node promotes when it splits,
+// the median unless suffix truncation moves it. With suffix truncation it is
+// the shortest key within a quarter of the node either side of the median,
+// closest to the median on ties, as long as both halves keep the minimum
+// number of keys and at least one key.
+func (bt *BTree) splitPoint(keys []Key) int {
+	mid := len(keys) / 2
+	if !bt.Compression.SuffixTruncation {
+		return mid
+	}
+
+	least := bt.minKeys()
+	if least < 1 {
+		least = 1
+	}
+	window := (bt.Order - 1) / 4
+	lo, hi := mid-window, mid+window
+	if lo < least {
+		lo = least
+	}
+	if hi > len(keys)-1-least {
+		hi = len(keys) - 1 - least
+	}
+
+	best, bestLen := mid, len(keyBytes(keys[mid]))
+	for i := lo; i <= hi; i++ {
+		n := len(keyBytes(keys[i]))
+		if n < bestLen || (n == bestLen && abs(i-mid) < abs(best-mid)) {
+			best, bestLen = i, n
+		}
+	}
+	return best
+}
+
+// subtreeMax returns the largest key below a node
+func (bt *BTree) subtreeMax(nodeID string) Key {
+	node := bt.Nodes[nodeID]
+	for !node.IsLeaf {
+		node = bt.Nodes[node.Children[len(node.Children)-1]]
+	}
+	return node.Keys[len(node.Keys)-1]
+}
+
+// shortestSeparator returns the shortest prefix of key that still sorts
+// after below, given below < key
+func shortestSeparator(below, key []byte) []byte {
+	n := 0
+	for n < len(below) && n < len(key) && below[n] == key[n] {
+		n++
+	}
+	if n < len(key) {
+		n++
+	}
+	return key[:n]
+}
+
+func commonPrefix(keys [][]byte) []byte {
+	prefix := keys[0]
+	for _, k := range keys[1:] {
+		n := 0
+		for n < len(prefix) && n < len(k) && prefix[n] == k[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return bytes.Clone(prefix)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,742 @@
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// LatchMode is the mode a latch is held in
+type LatchMode string
+
+const (
+	LatchRead  LatchMode = "read"
+	LatchWrite LatchMode = "write"
+)
+
+// Latch event actions
+const (
+	ActionAcquire = "acquire"
+	ActionRelease = "release"
+	ActionWait    = "wait"    // the latch is held by another operation
+	ActionModify  = "modify"  // a node was changed under a write latch
+	ActionRestart = "restart" // an optimistic operation fell back to pessimistic latching
+	ActionDone    = "done"
+)
+
+// RootLatchID names the latch guarding the root pointer
+const RootLatchID = "root"
+
+// LatchEvent is a latch acquisition, release or wait, or a change made while
+// holding latches
+type LatchEvent struct {
+	Op     int       `json:"op"`
+	Action string    `json:"action"`
+	NodeID string    `json:"nodeId,omitempty"`
+	Mode   LatchMode `json:"mode,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// HeldLatch is a latch held by an operation
+type HeldLatch struct {
+	NodeID string    `json:"nodeId"`
+	Mode   LatchMode `json:"mode"`
+}
+
+type latchNode struct {
+	latch    sync.RWMutex
+	id       string
+	leaf     bool
+	keys     []Key
+	children []*latchNode
+}
+
+// ConcurrentBTree is a unique B-Tree that is safe for concurrent use. Every
+// node carries a read/write latch and operations use latch crabbing: a latch
+// on a child is taken before the latch on its parent is released, and write
+// latches on ancestors are released as soon as the child is safe, meaning the
+// operation cannot propagate a split or merge above it.
+//
+// Like BTree, inserts split full nodes and deletes refill minimal nodes on the
+// way down, so a safe child is guaranteed after each step and at most a
+// parent, a child and a sibling are write-latched at once.
+type ConcurrentBTree struct {
+	Order int
+
+	rootLatch sync.RWMutex // Guards root; always taken before the root node's latch
+	root      *latchNode
+	nodeSeq   atomic.Int64
+	opSeq     atomic.Int64
+
+	// Yield, if set, is called at every latch event of every operation, and
+	// latches are acquired by polling so a blocked operation yields instead of
+	// blocking. Interleave uses it to run operations in a deterministic order.
+	Yield func(op *LatchOp, event LatchEvent)
+}
+
+// NewConcurrentBTree creates an empty concurrent B-Tree with the given order
+func NewConcurrentBTree(order int) *ConcurrentBTree {
+	if order < 4 {
+		order = 4 // An order 3 split cannot leave both halves non-empty
+	}
+	return &ConcurrentBTree{Order: order}
+}
+
+// LatchOp is one logical operation and the latches it holds
+type LatchOp struct {
+	ID   int
+	tree *ConcurrentBTree
+	held []heldLatch
+}
+
+type heldLatch struct {
+	HeldLatch
+	latch  *sync.RWMutex
+	pinned bool // kept until the operation finishes, even above a safe node
+}
+
+// NewOp starts a new operation on the tree
+func (t *ConcurrentBTree) NewOp() *LatchOp {
+	return &LatchOp{ID: int(t.opSeq.Add(1)), tree: t}
+}
+
+// Insert adds a key using pessimistic latch crabbing
+func (t *ConcurrentBTree) Insert(key Key) error {
+	return t.NewOp().Insert(key)
+}
+
+// Delete removes a key using pessimistic latch crabbing
+func (t *ConcurrentBTree) Delete(key Key) bool {
+	return t.NewOp().Delete(key)
+}
+
+// Search finds a key using read latch crabbing
+func (t *ConcurrentBTree) Search(key Key) bool {
+	return t.NewOp().Search(key)
+}
+
+// Held returns the latches the operation holds, in acquisition order
+func (op *LatchOp) Held() []HeldLatch {
+	held := make([]HeldLatch, len(op.held))
+	for i, h := range op.held {
+		held[i] = h.HeldLatch
+	}
+	return held
+}
+
+// Search finds a key, holding at most a parent and a child read latch
+func (op *LatchOp) Search(key Key) bool {
+	t := op.tree
+	op.acquire(&t.rootLatch, RootLatchID, LatchRead)
+	node := t.root
+	if node == nil {
+		op.releaseAll()
+		return false
+	}
+	op.acquireNode(node, LatchRead)
+	op.releaseAbove(node.id)
+
+	for {
+		i := node.lowerBound(key)
+		if i < len(node.keys) && node.keys[i].Compare(key) == 0 {
+			op.note(node.id, fmt.Sprintf("found %s", key))
+			op.releaseAll()
+			return true
+		}
+		if node.leaf {
+			op.note(node.id, fmt.Sprintf("%s not found", key))
+			op.releaseAll()
+			return false
+		}
+		child := node.children[i]
+		op.acquireNode(child, LatchRead)
+		op.releaseAbove(child.id)
+		node = child
+	}
+}
+
+// Insert adds a key. Write latches are taken top-down and ancestors are
+// released once a child is not full.
+func (op *LatchOp) Insert(key Key) error {
+	t := op.tree
+	op.acquire(&t.rootLatch, RootLatchID, LatchWrite)
+	if t.root == nil {
+		t.root = t.newNode(true)
+		t.root.keys = append(t.root.keys, key)
+		op.note(t.root.id, fmt.Sprintf("create root with %s", key))
+		op.releaseAll()
+		return nil
+	}
+
+	node := t.root
+	op.acquireNode(node, LatchWrite)
+	if len(node.keys) == t.Order-1 {
+		// Root is full: grow the tree while holding the root latch
+		newRoot := t.newNode(false)
+		newRoot.children = append(newRoot.children, node)
+		op.acquireNode(newRoot, LatchWrite)
+		t.root = newRoot
+		op.note(newRoot.id, fmt.Sprintf("grow root above %s", node.id))
+		op.splitChild(newRoot, 0, node)
+		op.release(node.id)
+		node = newRoot
+	}
+	op.releaseAbove(node.id)
+
+	for {
+		i := node.lowerBound(key)
+		if i < len(node.keys) && node.keys[i].Compare(key) == 0 {
+			op.releaseAll()
+			return fmt.Errorf("%w: %s", ErrDuplicateKey, key)
+		}
+		if node.leaf {
+			node.keys = insertAt(node.keys, i, key)
+			op.note(node.id, fmt.Sprintf("insert %s", key))
+			op.releaseAll()
+			return nil
+		}
+
+		child := node.children[i]
+		op.acquireNode(child, LatchWrite)
+		if len(child.keys) == t.Order-1 {
+			right := op.splitChild(node, i, child)
+			if c := key.Compare(node.keys[i]); c == 0 {
+				op.releaseAll()
+				return fmt.Errorf("%w: %s", ErrDuplicateKey, key)
+			} else if c > 0 {
+				op.acquireNode(right, LatchWrite)
+				op.release(child.id)
+				child = right
+			}
+		}
+		// The child is not full, so no split can reach the ancestors
+		op.releaseAbove(child.id)
+		node = child
+	}
+}
+
+// OptimisticInsert assumes the leaf has room: it descends with read latches
+// and write-latches only the leaf. If the leaf is full it releases everything
+// and restarts with pessimistic crabbing.
+func (op *LatchOp) OptimisticInsert(key Key) error {
+	t := op.tree
+	op.acquire(&t.rootLatch, RootLatchID, LatchRead)
+	node := t.root
+	if node == nil {
+		return op.restart("tree is empty", func() error { return op.Insert(key) })
+	}
+	op.acquireNode(node, leafMode(node))
+	op.releaseAbove(node.id)
+
+	for {
+		i := node.lowerBound(key)
+		if i < len(node.keys) && node.keys[i].Compare(key) == 0 {
+			op.releaseAll()
+			return fmt.Errorf("%w: %s", ErrDuplicateKey, key)
+		}
+		if node.leaf {
+			if len(node.keys) == t.Order-1 {
+				return op.restart(fmt.Sprintf("leaf %s is full", node.id), func() error { return op.Insert(key) })
+			}
+			node.keys = insertAt(node.keys, i, key)
+			op.note(node.id, fmt.Sprintf("insert %s", key))
+			op.releaseAll()
+			return nil
+		}
+		child := node.children[i]
+		op.acquireNode(child, leafMode(child))
+		op.releaseAbove(child.id)
+		node = child
+	}
+}
+
+// Delete removes a key. Write latches are taken top-down and ancestors are
+// released once a child holds more than the minimum number of keys.
+func (op *LatchOp) Delete(key Key) bool {
+	t := op.tree
+	op.acquire(&t.rootLatch, RootLatchID, LatchWrite)
+	node := t.root
+	if node == nil {
+		op.releaseAll()
+		return false
+	}
+	op.acquireNode(node, LatchWrite)
+	if node.leaf || len(node.keys) > 1 {
+		// The root cannot become empty, so the root pointer will not change
+		op.releaseAbove(node.id)
+	}
+	return op.deleteFrom(node, key)
+}
+
+// OptimisticDelete assumes the key is in a leaf that stays above minimum
+// occupancy. Otherwise it restarts with pessimistic crabbing.
+func (op *LatchOp) OptimisticDelete(key Key) bool {
+	t := op.tree
+	op.acquire(&t.rootLatch, RootLatchID, LatchRead)
+	node := t.root
+	if node == nil {
+		op.releaseAll()
+		return false
+	}
+	op.acquireNode(node, leafMode(node))
+	op.releaseAbove(node.id)
+	isRoot := true
+
+	restart := func(reason string) bool {
+		deleted := false
+		op.restart(reason, func() error {
+			deleted = op.Delete(key)
+			return nil
+		})
+		return deleted
+	}
+
+	for {
+		i := node.lowerBound(key)
+		present := i < len(node.keys) && node.keys[i].Compare(key) == 0
+		if node.leaf {
+			if !present {
+				op.releaseAll()
+				return false
+			}
+			if !isRoot && len(node.keys) <= t.minKeys() {
+				return restart(fmt.Sprintf("leaf %s is at minimum occupancy", node.id))
+			}
+			node.keys = removeAt(node.keys, i)
+			op.note(node.id, fmt.Sprintf("delete %s", key))
+			op.releaseAll()
+			return true
+		}
+		if present {
+			return restart(fmt.Sprintf("%s is in internal node %s", key, node.id))
+		}
+		child := node.children[i]
+		op.acquireNode(child, leafMode(child))
+		op.releaseAbove(child.id)
+		node, isRoot = child, false
+	}
+}
+
+// deleteFrom removes key from the subtree of node, which is write-latched and
+// either safe or the root
+func (op *LatchOp) deleteFrom(node *latchNode, key Key) bool {
+	t := op.tree
+	minKeys := t.minKeys()
+	for {
+		i := node.lowerBound(key)
+		present := i < len(node.keys) && node.keys[i].Compare(key) == 0
+
+		if node.leaf {
+			if present {
+				node.keys = removeAt(node.keys, i)
+				op.note(node.id, fmt.Sprintf("delete %s", key))
+			}
+			op.releaseAll()
+			return present
+		}
+
+		if present {
+			left := node.children[i]
+			op.acquireNode(left, LatchWrite)
+			if len(left.keys) > minKeys {
+				// Replace with the predecessor; this node stays latched
+				// until the replacement is written
+				op.pin(node.id)
+				pred := op.deleteEdge(left, false)
+				node.keys[i] = pred
+				op.note(node.id, fmt.Sprintf("replace %s with predecessor %s", key, pred))
+				op.releaseAll()
+				return true
+			}
+			right := node.children[i+1]
+			op.acquireNode(right, LatchWrite)
+			if len(right.keys) > minKeys {
+				op.release(left.id)
+				op.pin(node.id)
+				succ := op.deleteEdge(right, true)
+				node.keys[i] = succ
+				op.note(node.id, fmt.Sprintf("replace %s with successor %s", key, succ))
+				op.releaseAll()
+				return true
+			}
+			op.merge(node, i, left, right)
+			op.shrinkRoot(node, left)
+			op.releaseAbove(left.id)
+			node = left
+			continue
+		}
+
+		child := node.children[i]
+		op.acquireNode(child, LatchWrite)
+		if len(child.keys) <= minKeys {
+			child = op.fill(node, i, child)
+		}
+		op.shrinkRoot(node, child)
+		// The child holds more than the minimum, so no merge can reach the ancestors
+		op.releaseAbove(child.id)
+		node = child
+	}
+}
+
+// deleteEdge removes and returns the smallest or largest key below node,
+// which is write-latched and holds more than the minimum number of keys
+func (op *LatchOp) deleteEdge(node *latchNode, first bool) Key {
+	for !node.leaf {
+		i := len(node.children) - 1
+		if first {
+			i = 0
+		}
+		child := node.children[i]
+		op.acquireNode(child, LatchWrite)
+		if len(child.keys) <= op.tree.minKeys() {
+			child = op.fill(node, i, child)
+		}
+		op.releaseAbove(child.id)
+		node = child
+	}
+
+	var k Key
+	if first {
+		k = node.keys[0]
+		node.keys = node.keys[1:]
+	} else {
+		k = node.keys[len(node.keys)-1]
+		node.keys = node.keys[:len(node.keys)-1]
+	}
+	op.note(node.id, fmt.Sprintf("remove %s", k))
+	return k
+}
+
+// fill tops up a write-latched child at minimum occupancy by borrowing from
+// or merging with a sibling, and returns the node now holding its keys
+func (op *LatchOp) fill(parent *latchNode, i int, child *latchNode) *latchNode {
+	minKeys := op.tree.minKeys()
+
+	var left, right *latchNode
+	if i > 0 {
+		left = parent.children[i-1]
+		op.acquireNode(left, LatchWrite)
+		if len(left.keys) > minKeys {
+			child.keys = insertAt(child.keys, 0, parent.keys[i-1])
+			parent.keys[i-1] = left.keys[len(left.keys)-1]
+			left.keys = left.keys[:len(left.keys)-1]
+			if !left.leaf {
+				moved := left.children[len(left.children)-1]
+				left.children = left.children[:len(left.children)-1]
+				child.children = append([]*latchNode{moved}, child.children...)
+			}
+			op.note(child.id, fmt.Sprintf("borrow from left sibling %s", left.id))
+			op.release(left.id)
+			return child
+		}
+	}
+	if i < len(parent.children)-1 {
+		right = parent.children[i+1]
+		op.acquireNode(right, LatchWrite)
+		if len(right.keys) > minKeys {
+			child.keys = append(child.keys, parent.keys[i])
+			parent.keys[i] = right.keys[0]
+			right.keys = right.keys[1:]
+			if !right.leaf {
+				moved := right.children[0]
+				right.children = right.children[1:]
+				child.children = append(child.children, moved)
+			}
+			op.note(child.id, fmt.Sprintf("borrow from right sibling %s", right.id))
+			op.release(right.id)
+			if left != nil {
+				op.release(left.id)
+			}
+			return child
+		}
+	}
+
+	if left != nil {
+		if right != nil {
+			op.release(right.id)
+		}
+		op.merge(parent, i-1, left, child)
+		return left
+	}
+	op.merge(parent, i, child, right)
+	return child
+}
+
+// merge folds the separator and the right node into the left node. Both
+// children are write-latched; the right node's latch is released as it
+// leaves the tree.
+func (op *LatchOp) merge(parent *latchNode, leftIndex int, left, right *latchNode) {
+	left.keys = append(left.keys, parent.keys[leftIndex])
+	left.keys = append(left.keys, right.keys...)
+	left.children = append(left.children, right.children...)
+	parent.keys = removeAt(parent.keys, leftIndex)
+	parent.children = append(parent.children[:leftIndex+1], parent.children[leftIndex+2:]...)
+	op.note(left.id, fmt.Sprintf("merge %s into %s", right.id, left.id))
+	op.release(right.id)
+}
+
+// shrinkRoot makes child the root if a merge emptied the root. The root
+// latch is still held because a root with one key is never safe; without it
+// node cannot be the root being emptied.
+func (op *LatchOp) shrinkRoot(node, child *latchNode) {
+	t := op.tree
+	if !op.holds(RootLatchID) || node != t.root || len(node.keys) > 0 {
+		return
+	}
+	t.root = child
+	op.note(child.id, fmt.Sprintf("root %s is empty, %s becomes the root", node.id, child.id))
+	op.release(node.id)
+}
+
+// splitChild splits the full, write-latched child at index i of parent and
+// returns the new right node
+func (op *LatchOp) splitChild(parent *latchNode, i int, child *latchNode) *latchNode {
+	t := op.tree
+	right := t.newNode(child.leaf)
+	mid := (t.Order - 1) / 2
+	median := child.keys[mid]
+
+	right.keys = append(right.keys, child.keys[mid+1:]...)
+	child.keys = child.keys[:mid:mid]
+	if !child.leaf {
+		right.children = append(right.children, child.children[mid+1:]...)
+		child.children = child.children[: mid+1 : mid+1]
+	}
+
+	parent.keys = insertAt(parent.keys, i, median)
+	parent.children = append(parent.children, nil)
+	copy(parent.children[i+2:], parent.children[i+1:])
+	parent.children[i+1] = right
+
+	op.note(child.id, fmt.Sprintf("split %s around %s into %s", child.id, median, right.id))
+	return right
+}
+
+// Latch helpers
+
+func leafMode(node *latchNode) LatchMode {
+	if node.leaf {
+		return LatchWrite
+	}
+	return LatchRead
+}
+
+func (op *LatchOp) acquireNode(node *latchNode, mode LatchMode) {
+	op.acquire(&node.latch, node.id, mode)
+}
+
+func (op *LatchOp) acquire(latch *sync.RWMutex, id string, mode LatchMode) {
+	if op.tree.Yield == nil {
+		if mode == LatchWrite {
+			latch.Lock()
+		} else {
+			latch.RLock()
+		}
+	} else {
+		for {
+			var ok bool
+			if mode == LatchWrite {
+				ok = latch.TryLock()
+			} else {
+				ok = latch.TryRLock()
+			}
+			if ok {
+				break
+			}
+			op.tree.Yield(op, LatchEvent{Op: op.ID, Action: ActionWait, NodeID: id, Mode: mode})
+		}
+	}
+	op.held = append(op.held, heldLatch{HeldLatch: HeldLatch{NodeID: id, Mode: mode}, latch: latch})
+	op.event(ActionAcquire, id, mode, "")
+}
+
+func (op *LatchOp) release(id string) {
+	for i, h := range op.held {
+		if h.NodeID == id {
+			op.held = append(op.held[:i], op.held[i+1:]...)
+			op.unlock(h)
+			return
+		}
+	}
+}
+
+// releaseAbove releases every unpinned latch taken before the latch on id
+func (op *LatchOp) releaseAbove(id string) {
+	kept := op.held[:0:0]
+	var released []heldLatch
+	for i, h := range op.held {
+		if h.NodeID == id {
+			kept = append(kept, op.held[i:]...)
+			break
+		}
+		if h.pinned {
+			kept = append(kept, h)
+		} else {
+			released = append(released, h)
+		}
+	}
+	op.held = kept
+	for _, h := range released {
+		op.unlock(h)
+	}
+}
+
+func (op *LatchOp) releaseAll() {
+	held := op.held
+	op.held = nil
+	for _, h := range held {
+		op.unlock(h)
+	}
+}
+
+func (op *LatchOp) holds(id string) bool {
+	for _, h := range op.held {
+		if h.NodeID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (op *LatchOp) pin(id string) {
+	for i := range op.held {
+		if op.held[i].NodeID == id {
+			op.held[i].pinned = true
+		}
+	}
+}
+
+func (op *LatchOp) unlock(h heldLatch) {
+	if h.Mode == LatchWrite {
+		h.latch.Unlock()
+	} else {
+		h.latch.RUnlock()
+	}
+	op.event(ActionRelease, h.NodeID, h.Mode, "")
+}
+
+// restart releases every latch and runs the pessimistic fallback
+func (op *LatchOp) restart(reason string, fallback func() error) error {
+	op.releaseAll()
+	op.event(ActionRestart, "", "", reason)
+	return fallback()
+}
+
+func (op *LatchOp) note(id, detail string) {
+	op.event(ActionModify, id, "", detail)
+}
+
+func (op *LatchOp) event(action, id string, mode LatchMode, detail string) {
+	if op.tree.Yield != nil {
+		op.tree.Yield(op, LatchEvent{Op: op.ID, Action: action, NodeID: id, Mode: mode, Detail: detail})
+	}
+}
+
+// Tree helpers
+
+func (t *ConcurrentBTree) newNode(leaf bool) *latchNode {
+	return &latchNode{
+		id:       fmt.Sprintf("node-%d", t.nodeSeq.Add(1)),
+		leaf:     leaf,
+		keys:     []Key{},
+		children: []*latchNode{},
+	}
+}
+
+// minKeys matches BTree.minKeys
+func (t *ConcurrentBTree) minKeys() int {
+	return (t.Order - 2) / 2
+}
+
+// lowerBound returns the index of the first key >= key
+func (n *latchNode) lowerBound(key Key) int {
+	i := 0
+	for i < len(n.keys) && key.Compare(n.keys[i]) > 0 {
+		i++
+	}
+	return i
+}
+
+// Snapshot copies the tree into a BTree with the same node IDs, for
+// visualization and invariant checks. It takes no latches, so it must only be
+// called while no operation is running or while Interleave has them paused.
+func (t *ConcurrentBTree) Snapshot() *BTree {
+	bt := NewBTree(t.Order)
+	if t.root == nil {
+		return bt
+	}
+	var copyNode func(n *latchNode, parent string)
+	copyNode = func(n *latchNode, parent string) {
+		node := &BTreeNode{
+			ID:       n.id,
+			Keys:     append([]Key{}, n.keys...),
+			Children: make([]string, 0, len(n.children)),
+			IsLeaf:   n.leaf,
+			Parent:   parent,
+		}
+		bt.Nodes[n.id] = node
+		for _, child := range n.children {
+			node.Children = append(node.Children, child.id)
+			copyNode(child, n.id)
+		}
+	}
+	copyNode(t.root, "")
+	bt.RootID = t.root.id
+	return bt
+}
+
+// Interleave runs each task as its own operation and schedules them
+// round-robin, letting one operation advance by a single latch event per
+// turn. observe is called after every event with all operations paused, so
+// the tree and held latches can be inspected. A task blocked on a latch
+// reports a wait event and yields its turn.
+func (t *ConcurrentBTree) Interleave(tasks []func(op *LatchOp), observe func(event LatchEvent, ops []*LatchOp)) {
+	type runner struct {
+		op     *LatchOp
+		resume chan struct{}
+		done   bool
+	}
+
+	events := make(chan LatchEvent)
+	finished := make(chan struct{})
+	runners := make([]*runner, len(tasks))
+	ops := make([]*LatchOp, len(tasks))
+	byOp := make(map[*LatchOp]*runner, len(tasks))
+	for i := range tasks {
+		op := t.NewOp()
+		runners[i] = &runner{op: op, resume: make(chan struct{})}
+		ops[i] = op
+		byOp[op] = runners[i]
+	}
+
+	t.Yield = func(op *LatchOp, event LatchEvent) {
+		events <- event
+		<-byOp[op].resume
+	}
+	defer func() { t.Yield = nil }()
+
+	for i, task := range tasks {
+		go func(r *runner, task func(*LatchOp)) {
+			<-r.resume
+			task(r.op)
+			finished <- struct{}{}
+		}(runners[i], task)
+	}
+
+	active := len(runners)
+	for turn := 0; active > 0; turn = (turn + 1) % len(runners) {
+		r := runners[turn]
+		if r.done {
+			continue
+		}
+		r.resume <- struct{}{}
+		select {
+		case event := <-events:
+			observe(event, ops)
+		case <-finished:
+			r.done = true
+			active--
+			observe(LatchEvent{Op: r.op.ID, Action: ActionDone}, ops)
+		}
+	}
+}
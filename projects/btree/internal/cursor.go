@@ -0,0 +1,277 @@
+package internal
+
+// Cursor walks the entries of a B-Tree in key order, one at a time.
+//
+// The position is a stack of (node, index) frames from the root down. Every
+// frame but the top records the child the cursor descended into; the top
+// frame records the index of the current key. Keys of internal nodes are part
+// of the sequence, so moving can go down into a subtree or back up to an
+// ancestor.
+//
+// A cursor remembers the entry it is on and the tree version it was
+// positioned against. If the tree is modified in between, Next and Prev
+// re-seek from that entry instead of following stale frames, so a scan keeps
+// its place across splits and merges.
+type Cursor struct {
+	tree    *BTree
+	stack   []cursorFrame
+	key     Key
+	version uint64
+	valid   bool
+}
+
+type cursorFrame struct {
+	nodeID string
+	index  int
+}
+
+// Cursor returns an unpositioned cursor over the tree
+func (bt *BTree) Cursor() *Cursor {
+	return &Cursor{tree: bt}
+}
+
+// Valid reports whether the cursor is positioned on an entry
+func (c *Cursor) Valid() bool {
+	return c.valid
+}
+
+// Key returns the entry under the cursor, or nil if it is not valid
+func (c *Cursor) Key() Key {
+	if !c.valid {
+		return nil
+	}
+	return c.key
+}
+
+// NodeID returns the node holding the entry under the cursor
+func (c *Cursor) NodeID() string {
+	if !c.valid {
+		return ""
+	}
+	return c.stack[len(c.stack)-1].nodeID
+}
+
+// Path returns the node IDs from the root to the current node
+func (c *Cursor) Path() []string {
+	path := make([]string, len(c.stack))
+	for i, frame := range c.stack {
+		path[i] = frame.nodeID
+	}
+	return path
+}
+
+// First positions the cursor on the smallest entry
+func (c *Cursor) First() bool {
+	return c.seekForward(func(Key) bool { return false })
+}
+
+// Last positions the cursor on the largest entry
+func (c *Cursor) Last() bool {
+	return c.seekBackward(func(Key) bool { return false })
+}
+
+// Seek positions the cursor on the first entry >= key. A bare key in a
+// non-unique tree lands on its first duplicate.
+func (c *Cursor) Seek(key Key) bool {
+	return c.seekForward(func(entry Key) bool { return seekCompare(entry, key) < 0 })
+}
+
+// SeekLE positions the cursor on the last entry <= key, the starting point of
+// a reverse scan. A bare key in a non-unique tree lands on its last duplicate.
+func (c *Cursor) SeekLE(key Key) bool {
+	return c.seekBackward(func(entry Key) bool { return seekCompare(entry, key) > 0 })
+}
+
+// Next moves to the following entry
+func (c *Cursor) Next() bool {
+	if !c.valid {
+		return false
+	}
+	if c.version != c.tree.version {
+		last := c.key
+		return c.seekForward(func(entry Key) bool { return entry.Compare(last) <= 0 })
+	}
+
+	top := &c.stack[len(c.stack)-1]
+	node := c.tree.Nodes[top.nodeID]
+	if !node.IsLeaf {
+		// The next entry is the smallest of the right subtree
+		top.index++
+		c.descend(node.Children[top.index], true)
+		return c.settle()
+	}
+	if top.index+1 < len(node.Keys) {
+		top.index++
+		return c.settle()
+	}
+
+	// Leaf exhausted: climb to the first ancestor with a key to the right
+	c.stack = c.stack[:len(c.stack)-1]
+	for len(c.stack) > 0 {
+		top := c.stack[len(c.stack)-1]
+		if top.index < len(c.tree.Nodes[top.nodeID].Keys) {
+			return c.settle()
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+	return c.invalidate()
+}
+
+// Prev moves to the preceding entry
+func (c *Cursor) Prev() bool {
+	if !c.valid {
+		return false
+	}
+	if c.version != c.tree.version {
+		last := c.key
+		return c.seekBackward(func(entry Key) bool { return entry.Compare(last) >= 0 })
+	}
+
+	top := &c.stack[len(c.stack)-1]
+	node := c.tree.Nodes[top.nodeID]
+	if !node.IsLeaf {
+		// The previous entry is the largest of the left subtree
+		c.descend(node.Children[top.index], false)
+		return c.settle()
+	}
+	if top.index > 0 {
+		top.index--
+		return c.settle()
+	}
+
+	// Leaf exhausted: climb to the first ancestor with a key to the left
+	c.stack = c.stack[:len(c.stack)-1]
+	for len(c.stack) > 0 {
+		top := &c.stack[len(c.stack)-1]
+		if top.index > 0 {
+			top.index--
+			return c.settle()
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+	return c.invalidate()
+}
+
+// seekForward positions the cursor on the first entry for which before
+// returns false
+func (c *Cursor) seekForward(before func(Key) bool) bool {
+	c.stack = c.stack[:0]
+	nodeID := c.tree.RootID
+	for nodeID != "" {
+		node := c.tree.Nodes[nodeID]
+		i := 0
+		for i < len(node.Keys) && before(node.Keys[i]) {
+			i++
+		}
+		c.stack = append(c.stack, cursorFrame{nodeID: nodeID, index: i})
+		if node.IsLeaf {
+			if i < len(node.Keys) {
+				return c.settle()
+			}
+			break
+		}
+		nodeID = node.Children[i]
+	}
+
+	// Ran off the end of a leaf: the answer is the separator above it
+	if len(c.stack) > 0 {
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+	for len(c.stack) > 0 {
+		top := c.stack[len(c.stack)-1]
+		if top.index < len(c.tree.Nodes[top.nodeID].Keys) {
+			return c.settle()
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+	return c.invalidate()
+}
+
+// seekBackward positions the cursor on the last entry for which after
+// returns false
+func (c *Cursor) seekBackward(after func(Key) bool) bool {
+	c.stack = c.stack[:0]
+	nodeID := c.tree.RootID
+	for nodeID != "" {
+		node := c.tree.Nodes[nodeID]
+		i := 0
+		for i < len(node.Keys) && !after(node.Keys[i]) {
+			i++
+		}
+		if node.IsLeaf {
+			if i > 0 {
+				c.stack = append(c.stack, cursorFrame{nodeID: nodeID, index: i - 1})
+				return c.settle()
+			}
+			break
+		}
+		c.stack = append(c.stack, cursorFrame{nodeID: nodeID, index: i})
+		nodeID = node.Children[i]
+	}
+
+	// Nothing qualifies in the leaf: the answer is the separator left of it
+	for len(c.stack) > 0 {
+		top := &c.stack[len(c.stack)-1]
+		if top.index > 0 {
+			top.index--
+			return c.settle()
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+	return c.invalidate()
+}
+
+// descend pushes the path to the leftmost or rightmost entry of a subtree
+func (c *Cursor) descend(nodeID string, leftmost bool) {
+	for {
+		node := c.tree.Nodes[nodeID]
+		index := 0
+		if !leftmost {
+			index = len(node.Children) - 1
+			if node.IsLeaf {
+				index = len(node.Keys) - 1
+			}
+		}
+		c.stack = append(c.stack, cursorFrame{nodeID: nodeID, index: index})
+		if node.IsLeaf {
+			return
+		}
+		nodeID = node.Children[index]
+	}
+}
+
+// settle records the entry under the top frame as the cursor position
+func (c *Cursor) settle() bool {
+	top := c.stack[len(c.stack)-1]
+	c.key = c.tree.Nodes[top.nodeID].Keys[top.index]
+	c.version = c.tree.version
+	c.valid = true
+	return true
+}
+
+func (c *Cursor) invalidate() bool {
+	c.stack = c.stack[:0]
+	c.key = nil
+	c.valid = false
+	return false
+}
+
+// seekCompare orders an entry against a seek target. A bare target matches
+// every duplicate of its key; a RowKey target matches one exact entry.
+func seekCompare(entry, target Key) int {
+	if _, exact := target.(RowKey); exact {
+		return entry.Compare(target)
+	}
+	return EntryKey(entry).Compare(target)
+}
+
+// ReverseRangeSearch finds all keys in the range [start, end] in descending
+// order, including every duplicate entry of the bounds
+func (bt *BTree) ReverseRangeSearch(start, end Key) []Key {
+	result := []Key{}
+	c := bt.Cursor()
+	for ok := c.SeekLE(EntryKey(end)); ok && EntryKey(c.Key()).Compare(EntryKey(start)) >= 0; ok = c.Prev() {
+		result = append(result, c.Key())
+	}
+	return result
+}
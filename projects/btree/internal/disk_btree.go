@@ -0,0 +1,840 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Page layout
+//
+// Page 0 is the meta page:
+//
+//	0:4   magic "BTPG"
+//	4:6   format version
+//	6:8   key width in bytes
+//	8:12  page size
+//	12:16 root page (0 when the tree is empty)
+//	16:20 head of the free page list (0 when empty)
+//	20    key kind
+//
+// Every other page is a node or a free page:
+//
+//	0     page type
+//	2:4   number of keys
+//	4:8   next free page (free pages only)
+//	8:    keys, maxKeys slots of keyWidth bytes
+//	...   children, maxKeys+1 slots of 4-byte page numbers (internal nodes only)
+//
+// Nodes store no parent pointer, so a split writes exactly three pages
+// (the two halves and the parent) instead of also rewriting every moved child.
+const (
+	diskMagic      = "BTPG"
+	diskVersion    = 1
+	diskHeaderSize = 8
+
+	pageTypeLeaf     = 1
+	pageTypeInternal = 2
+	pageTypeFree     = 3
+)
+
+// ErrKeyTooWide is returned when a key does not fit the tree's fixed key width
+var ErrKeyTooWide = errors.New("key does not fit the fixed key width")
+
+// ErrKeyTrailingZero is returned for string and byte keys ending in a zero
+// byte, which the fixed-width form cannot tell apart from padding
+var ErrKeyTrailingZero = errors.New("key ends in a zero byte")
+
+// DiskBTree is a page-oriented unique B-Tree: every node is serialized into
+// one fixed-size page of a single file and node IDs are page numbers.
+// The order is not chosen but derived from the page size and key width.
+type DiskBTree struct {
+	pager     *Pager
+	Kind      KeyKind `json:"keyType"`
+	KeyWidth  int     `json:"keyWidth"`
+	Order     int     `json:"order"`
+	Root      uint32  `json:"root"`
+	FreeHead  uint32  `json:"freeHead"`
+	metaDirty bool
+}
+
+// diskNode is a decoded node page
+type diskNode struct {
+	page     uint32
+	leaf     bool
+	keys     [][]byte
+	children []uint32
+}
+
+// DiskPage describes a node page for visualization
+type DiskPage struct {
+	Page      uint32   `json:"page"`
+	Parent    uint32   `json:"parent,omitempty"`
+	Level     int      `json:"level"`
+	IsLeaf    bool     `json:"isLeaf"`
+	Keys      []Key    `json:"keys"`
+	Children  []uint32 `json:"children"`
+	BytesUsed int      `json:"bytesUsed"`
+	PageSize  int      `json:"pageSize"`
+}
+
+// DiskOrder returns the order that fits a page: a full internal node holds
+// Order-1 keys and Order child page numbers after the page header
+func DiskOrder(pageSize, keyWidth int) int {
+	return (pageSize-diskHeaderSize-4)/(keyWidth+4) + 1
+}
+
+// CreateDiskBTree initializes an empty page file as a B-Tree. A keyWidth of 0
+// uses 8 bytes for integers and 16 bytes for strings and byte keys.
+func CreateDiskBTree(pager *Pager, kind KeyKind, keyWidth int) (*DiskBTree, error) {
+	if pager.PageCount != 0 {
+		return nil, fmt.Errorf("page file already holds %d pages", pager.PageCount)
+	}
+	switch kind {
+	case KindInt:
+		if keyWidth != 0 && keyWidth != 8 {
+			return nil, fmt.Errorf("int keys are 8 bytes wide, got %d", keyWidth)
+		}
+		keyWidth = 8
+	case KindString, KindBytes:
+		if keyWidth == 0 {
+			keyWidth = 16
+		}
+	default:
+		return nil, fmt.Errorf("%s keys are not supported on disk", kind)
+	}
+	if keyWidth < 1 || keyWidth > 65535 {
+		return nil, fmt.Errorf("key width %d out of range", keyWidth)
+	}
+
+	// An order 3 split cannot leave both halves non-empty
+	order := DiskOrder(pager.PageSize, keyWidth)
+	if order < 4 {
+		return nil, fmt.Errorf("page size %d is too small for %d-byte keys: a page must hold at least 3 keys", pager.PageSize, keyWidth)
+	}
+
+	t := &DiskBTree{
+		pager:    pager,
+		Kind:     kind,
+		KeyWidth: keyWidth,
+		Order:    order,
+	}
+	if _, err := pager.Append(); err != nil {
+		return nil, err
+	}
+	t.metaDirty = true
+	if err := t.flushMeta(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// OpenDiskBTree loads a B-Tree from an existing page file
+func OpenDiskBTree(pager *Pager) (*DiskBTree, error) {
+	buf, err := pager.ReadPage(0)
+	if err != nil {
+		return nil, err
+	}
+	if string(buf[0:4]) != diskMagic {
+		return nil, errors.New("not a B-Tree page file")
+	}
+	if v := binary.BigEndian.Uint16(buf[4:6]); v != diskVersion {
+		return nil, fmt.Errorf("unsupported page file version %d", v)
+	}
+	if size := int(binary.BigEndian.Uint32(buf[8:12])); size != pager.PageSize {
+		return nil, fmt.Errorf("page file uses %d-byte pages, pager uses %d", size, pager.PageSize)
+	}
+
+	t := &DiskBTree{
+		pager:    pager,
+		KeyWidth: int(binary.BigEndian.Uint16(buf[6:8])),
+		Root:     binary.BigEndian.Uint32(buf[12:16]),
+		FreeHead: binary.BigEndian.Uint32(buf[16:20]),
+	}
+	switch buf[20] {
+	case 1:
+		t.Kind = KindInt
+	case 2:
+		t.Kind = KindString
+	case 3:
+		t.Kind = KindBytes
+	default:
+		return nil, fmt.Errorf("unknown key kind %d", buf[20])
+	}
+	t.Order = DiskOrder(pager.PageSize, t.KeyWidth)
+	if t.Order < 4 {
+		return nil, fmt.Errorf("page size %d is too small for %d-byte keys: a page must hold at least 3 keys", pager.PageSize, t.KeyWidth)
+	}
+	return t, nil
+}
+
+// Pager returns the pager backing the tree
+func (t *DiskBTree) Pager() *Pager {
+	return t.pager
+}
+
+// PageSize returns the size of every page in bytes
+func (t *DiskBTree) PageSize() int {
+	return t.pager.PageSize
+}
+
+// EncodeKey converts a key into its fixed-width byte form. Integers are
+// big-endian with the sign bit flipped so byte order matches numeric order;
+// strings and byte keys are zero-padded on the right, so they must not end
+// in a zero byte themselves: "a\x00" would encode exactly like "a".
+func (t *DiskBTree) EncodeKey(key Key) ([]byte, error) {
+	if key.Kind() != t.Kind {
+		return nil, fmt.Errorf("cannot store %s key %s in a %s tree", key.Kind(), key, t.Kind)
+	}
+	buf := make([]byte, t.KeyWidth)
+	switch k := key.(type) {
+	case IntKey:
+		binary.BigEndian.PutUint64(buf, uint64(k)^(1<<63))
+	case StringKey:
+		if len(k) > t.KeyWidth {
+			return nil, fmt.Errorf("%w: %q is %d bytes, width is %d", ErrKeyTooWide, string(k), len(k), t.KeyWidth)
+		}
+		if len(k) > 0 && k[len(k)-1] == 0 {
+			return nil, fmt.Errorf("%w: %q", ErrKeyTrailingZero, string(k))
+		}
+		copy(buf, k)
+	case BytesKey:
+		if len(k) > t.KeyWidth {
+			return nil, fmt.Errorf("%w: %s is %d bytes, width is %d", ErrKeyTooWide, k, len(k), t.KeyWidth)
+		}
+		if len(k) > 0 && k[len(k)-1] == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrKeyTrailingZero, k)
+		}
+		copy(buf, k)
+	default:
+		return nil, fmt.Errorf("%s keys are not supported on disk", key.Kind())
+	}
+	return buf, nil
+}
+
+// DecodeKey converts a fixed-width key back into a key. Trailing zero bytes
+// of strings and byte keys are padding, since EncodeKey rejects keys that
+// end in one, and are dropped.
+func (t *DiskBTree) DecodeKey(b []byte) Key {
+	switch t.Kind {
+	case KindInt:
+		return IntKey(int64(binary.BigEndian.Uint64(b) ^ (1 << 63)))
+	case KindString:
+		return StringKey(bytes.TrimRight(b, "\x00"))
+	}
+	return BytesKey(append([]byte{}, bytes.TrimRight(b, "\x00")...))
+}
+
+// Search finds a key. Returns (page, keyIndex, found).
+func (t *DiskBTree) Search(key Key) (uint32, int, bool, error) {
+	enc, err := t.EncodeKey(key)
+	if err != nil {
+		return 0, -1, false, err
+	}
+	return t.search(enc)
+}
+
+func (t *DiskBTree) search(key []byte) (uint32, int, bool, error) {
+	page := t.Root
+	for page != 0 {
+		node, err := t.readNode(page)
+		if err != nil {
+			return 0, -1, false, err
+		}
+		i := node.lowerBound(key)
+		if i < len(node.keys) && bytes.Equal(node.keys[i], key) {
+			return page, i, true, nil
+		}
+		if node.leaf {
+			return page, i, false, nil
+		}
+		page = node.children[i]
+	}
+	return 0, -1, false, nil
+}
+
+// Insert adds a key, splitting full pages on the way down
+func (t *DiskBTree) Insert(key Key) error {
+	enc, err := t.EncodeKey(key)
+	if err != nil {
+		return err
+	}
+	if _, _, found, err := t.search(enc); err != nil {
+		return err
+	} else if found {
+		return fmt.Errorf("%w: %s", ErrDuplicateKey, key)
+	}
+
+	if t.Root == 0 {
+		root, err := t.allocNode(true)
+		if err != nil {
+			return err
+		}
+		root.keys = append(root.keys, enc)
+		if err := t.writeNode(root); err != nil {
+			return err
+		}
+		t.setRoot(root.page)
+		return t.flushMeta()
+	}
+
+	root, err := t.readNode(t.Root)
+	if err != nil {
+		return err
+	}
+	if len(root.keys) == t.Order-1 {
+		// Root is full, grow the tree by one level
+		newRoot, err := t.allocNode(false)
+		if err != nil {
+			return err
+		}
+		newRoot.children = append(newRoot.children, root.page)
+		if _, err := t.splitChild(newRoot, 0, root); err != nil {
+			return err
+		}
+		t.setRoot(newRoot.page)
+		root = newRoot
+	}
+	if err := t.insertNonFull(root, enc); err != nil {
+		return err
+	}
+	return t.flushMeta()
+}
+
+func (t *DiskBTree) insertNonFull(node *diskNode, key []byte) error {
+	i := node.lowerBound(key)
+	if node.leaf {
+		node.keys = insertBytes(node.keys, i, key)
+		return t.writeNode(node)
+	}
+
+	child, err := t.readNode(node.children[i])
+	if err != nil {
+		return err
+	}
+	if len(child.keys) == t.Order-1 {
+		right, err := t.splitChild(node, i, child)
+		if err != nil {
+			return err
+		}
+		if bytes.Compare(key, node.keys[i]) > 0 {
+			child = right
+		}
+	}
+	return t.insertNonFull(child, key)
+}
+
+// splitChild splits the full child at childIndex of parent and writes the
+// two halves and the parent. It returns the new right half.
+func (t *DiskBTree) splitChild(parent *diskNode, childIndex int, child *diskNode) (*diskNode, error) {
+	right, err := t.allocNode(child.leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	mid := (t.Order - 1) / 2
+	median := child.keys[mid]
+
+	right.keys = append(right.keys, child.keys[mid+1:]...)
+	child.keys = child.keys[:mid:mid]
+	if !child.leaf {
+		right.children = append(right.children, child.children[mid+1:]...)
+		child.children = child.children[: mid+1 : mid+1]
+	}
+
+	parent.keys = insertBytes(parent.keys, childIndex, median)
+	parent.children = insertPage(parent.children, childIndex+1, right.page)
+
+	for _, n := range []*diskNode{child, right, parent} {
+		if err := t.writeNode(n); err != nil {
+			return nil, err
+		}
+	}
+	return right, nil
+}
+
+// Delete removes a key, refilling pages at minimum occupancy on the way down
+func (t *DiskBTree) Delete(key Key) (bool, error) {
+	enc, err := t.EncodeKey(key)
+	if err != nil {
+		return false, err
+	}
+	if t.Root == 0 {
+		return false, nil
+	}
+
+	root, err := t.readNode(t.Root)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := t.deleteFrom(root, enc)
+	if err != nil {
+		return false, err
+	}
+
+	// An empty root is dropped: an internal root hands over to its only
+	// child, an empty leaf root leaves an empty tree
+	if len(root.keys) == 0 {
+		next := uint32(0)
+		if !root.leaf {
+			next = root.children[0]
+		}
+		t.setRoot(next)
+		if err := t.freePage(root.page); err != nil {
+			return false, err
+		}
+	}
+	return deleted, t.flushMeta()
+}
+
+// minKeys is the fewest keys a non-root page may hold. Splitting a full page
+// leaves (Order-2)/2 keys on the smaller side, so that is also the threshold
+// below which deletes must refill a page.
+func (t *DiskBTree) minKeys() int {
+	return (t.Order - 2) / 2
+}
+
+func (t *DiskBTree) deleteFrom(node *diskNode, key []byte) (bool, error) {
+	minKeys := t.minKeys()
+	i := node.lowerBound(key)
+	present := i < len(node.keys) && bytes.Equal(node.keys[i], key)
+
+	if node.leaf {
+		// Case 1: Key is in leaf page
+		if !present {
+			return false, nil
+		}
+		node.keys = removeBytes(node.keys, i)
+		return true, t.writeNode(node)
+	}
+
+	if present {
+		// Case 2: Key is in internal page
+		left, err := t.readNode(node.children[i])
+		if err != nil {
+			return false, err
+		}
+		if len(left.keys) > minKeys {
+			pred, err := t.edgeKey(left, false)
+			if err != nil {
+				return false, err
+			}
+			node.keys[i] = pred
+			if err := t.writeNode(node); err != nil {
+				return false, err
+			}
+			return t.deleteFrom(left, pred)
+		}
+		right, err := t.readNode(node.children[i+1])
+		if err != nil {
+			return false, err
+		}
+		if len(right.keys) > minKeys {
+			succ, err := t.edgeKey(right, true)
+			if err != nil {
+				return false, err
+			}
+			node.keys[i] = succ
+			if err := t.writeNode(node); err != nil {
+				return false, err
+			}
+			return t.deleteFrom(right, succ)
+		}
+		merged, err := t.mergeChildren(node, i, left, right)
+		if err != nil {
+			return false, err
+		}
+		return t.deleteFrom(merged, key)
+	}
+
+	// Case 3: Key is in subtree
+	child, err := t.readNode(node.children[i])
+	if err != nil {
+		return false, err
+	}
+	if len(child.keys) <= minKeys {
+		if child, err = t.fillChild(node, i, child); err != nil {
+			return false, err
+		}
+	}
+	return t.deleteFrom(child, key)
+}
+
+// edgeKey returns the smallest (first) or largest key below node
+func (t *DiskBTree) edgeKey(node *diskNode, first bool) ([]byte, error) {
+	for !node.leaf {
+		next := node.children[len(node.children)-1]
+		if first {
+			next = node.children[0]
+		}
+		var err error
+		if node, err = t.readNode(next); err != nil {
+			return nil, err
+		}
+	}
+	if first {
+		return node.keys[0], nil
+	}
+	return node.keys[len(node.keys)-1], nil
+}
+
+// fillChild tops up a child at minimum occupancy by borrowing from or
+// merging with a sibling, and returns the page that now holds its keys
+func (t *DiskBTree) fillChild(parent *diskNode, childIndex int, child *diskNode) (*diskNode, error) {
+	minKeys := t.minKeys()
+
+	var left, right *diskNode
+	var err error
+	if childIndex > 0 {
+		if left, err = t.readNode(parent.children[childIndex-1]); err != nil {
+			return nil, err
+		}
+		if len(left.keys) > minKeys {
+			return child, t.borrowFromLeft(parent, childIndex, child, left)
+		}
+	}
+	if childIndex < len(parent.children)-1 {
+		if right, err = t.readNode(parent.children[childIndex+1]); err != nil {
+			return nil, err
+		}
+		if len(right.keys) > minKeys {
+			return child, t.borrowFromRight(parent, childIndex, child, right)
+		}
+	}
+
+	if left != nil {
+		return t.mergeChildren(parent, childIndex-1, left, child)
+	}
+	return t.mergeChildren(parent, childIndex, child, right)
+}
+
+func (t *DiskBTree) borrowFromLeft(parent *diskNode, childIndex int, child, left *diskNode) error {
+	child.keys = insertBytes(child.keys, 0, parent.keys[childIndex-1])
+	parent.keys[childIndex-1] = left.keys[len(left.keys)-1]
+	left.keys = left.keys[:len(left.keys)-1]
+	if !left.leaf {
+		moved := left.children[len(left.children)-1]
+		left.children = left.children[:len(left.children)-1]
+		child.children = insertPage(child.children, 0, moved)
+	}
+	return t.writeNodes(left, child, parent)
+}
+
+func (t *DiskBTree) borrowFromRight(parent *diskNode, childIndex int, child, right *diskNode) error {
+	child.keys = append(child.keys, parent.keys[childIndex])
+	parent.keys[childIndex] = right.keys[0]
+	right.keys = right.keys[1:]
+	if !right.leaf {
+		moved := right.children[0]
+		right.children = right.children[1:]
+		child.children = append(child.children, moved)
+	}
+	return t.writeNodes(child, right, parent)
+}
+
+// mergeChildren folds the right page and the separator into the left page,
+// then returns the right page to the free list
+func (t *DiskBTree) mergeChildren(parent *diskNode, leftIndex int, left, right *diskNode) (*diskNode, error) {
+	left.keys = append(left.keys, parent.keys[leftIndex])
+	left.keys = append(left.keys, right.keys...)
+	if !left.leaf {
+		left.children = append(left.children, right.children...)
+	}
+
+	parent.keys = removeBytes(parent.keys, leftIndex)
+	parent.children = removePage(parent.children, leftIndex+1)
+
+	if err := t.writeNodes(left, parent); err != nil {
+		return nil, err
+	}
+	if err := t.freePage(right.page); err != nil {
+		return nil, err
+	}
+	return left, nil
+}
+
+// RangeSearch finds all keys in the range [start, end]
+func (t *DiskBTree) RangeSearch(start, end Key) ([]Key, error) {
+	result := []Key{}
+	lo, err := t.EncodeKey(start)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := t.EncodeKey(end)
+	if err != nil {
+		return nil, err
+	}
+	if t.Root == 0 {
+		return result, nil
+	}
+	return result, t.rangeSearchPage(t.Root, lo, hi, &result)
+}
+
+func (t *DiskBTree) rangeSearchPage(page uint32, start, end []byte, result *[]Key) error {
+	node, err := t.readNode(page)
+	if err != nil {
+		return err
+	}
+
+	i := node.lowerBound(start)
+	for i < len(node.keys) && bytes.Compare(node.keys[i], end) <= 0 {
+		if !node.leaf {
+			if err := t.rangeSearchPage(node.children[i], start, end, result); err != nil {
+				return err
+			}
+		}
+		*result = append(*result, t.DecodeKey(node.keys[i]))
+		i++
+	}
+
+	if !node.leaf && i < len(node.children) {
+		return t.rangeSearchPage(node.children[i], start, end, result)
+	}
+	return nil
+}
+
+// Pages returns every node page level by level from the root. Pages are
+// inspected without counting as reads.
+func (t *DiskBTree) Pages() ([]DiskPage, error) {
+	pages := []DiskPage{}
+	if t.Root == 0 {
+		return pages, nil
+	}
+
+	type item struct {
+		page, parent uint32
+		level        int
+	}
+	queue := []item{{page: t.Root}}
+	for len(queue) > 0 {
+		it := queue[0]
+		queue = queue[1:]
+
+		buf, err := t.pager.peek(it.page)
+		if err != nil {
+			return nil, err
+		}
+		node, err := t.decodeNode(it.page, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		keys := make([]Key, len(node.keys))
+		for i, k := range node.keys {
+			keys[i] = t.DecodeKey(k)
+		}
+		pages = append(pages, DiskPage{
+			Page:      it.page,
+			Parent:    it.parent,
+			Level:     it.level,
+			IsLeaf:    node.leaf,
+			Keys:      keys,
+			Children:  append([]uint32{}, node.children...),
+			BytesUsed: t.bytesUsed(node),
+			PageSize:  t.pager.PageSize,
+		})
+		for _, child := range node.children {
+			queue = append(queue, item{page: child, parent: it.page, level: it.level + 1})
+		}
+	}
+	return pages, nil
+}
+
+// FreePages returns the page numbers on the free list
+func (t *DiskBTree) FreePages() ([]uint32, error) {
+	free := []uint32{}
+	for page := t.FreeHead; page != 0; {
+		buf, err := t.pager.peek(page)
+		if err != nil {
+			return nil, err
+		}
+		free = append(free, page)
+		page = binary.BigEndian.Uint32(buf[4:8])
+	}
+	return free, nil
+}
+
+// Close flushes the meta page and closes the page file
+func (t *DiskBTree) Close() error {
+	if err := t.flushMeta(); err != nil {
+		return err
+	}
+	return t.pager.Close()
+}
+
+// bytesUsed is the header plus the occupied key and child slots of a page
+func (t *DiskBTree) bytesUsed(node *diskNode) int {
+	return diskHeaderSize + len(node.keys)*t.KeyWidth + len(node.children)*4
+}
+
+func (t *DiskBTree) setRoot(page uint32) {
+	t.Root = page
+	t.metaDirty = true
+}
+
+// flushMeta writes the meta page if the root or free list changed
+func (t *DiskBTree) flushMeta() error {
+	if !t.metaDirty {
+		return nil
+	}
+	buf := make([]byte, t.pager.PageSize)
+	copy(buf[0:4], diskMagic)
+	binary.BigEndian.PutUint16(buf[4:6], diskVersion)
+	binary.BigEndian.PutUint16(buf[6:8], uint16(t.KeyWidth))
+	binary.BigEndian.PutUint32(buf[8:12], uint32(t.pager.PageSize))
+	binary.BigEndian.PutUint32(buf[12:16], t.Root)
+	binary.BigEndian.PutUint32(buf[16:20], t.FreeHead)
+	switch t.Kind {
+	case KindInt:
+		buf[20] = 1
+	case KindString:
+		buf[20] = 2
+	case KindBytes:
+		buf[20] = 3
+	}
+	if err := t.pager.WritePage(0, buf); err != nil {
+		return err
+	}
+	t.metaDirty = false
+	return nil
+}
+
+// allocNode takes a page from the free list, or appends one to the file
+func (t *DiskBTree) allocNode(leaf bool) (*diskNode, error) {
+	node := &diskNode{leaf: leaf, keys: [][]byte{}, children: []uint32{}}
+	if t.FreeHead != 0 {
+		buf, err := t.pager.ReadPage(t.FreeHead)
+		if err != nil {
+			return nil, err
+		}
+		node.page = t.FreeHead
+		t.FreeHead = binary.BigEndian.Uint32(buf[4:8])
+		t.metaDirty = true
+		t.pager.record("alloc", node.page)
+		return node, nil
+	}
+	page, err := t.pager.Append()
+	if err != nil {
+		return nil, err
+	}
+	node.page = page
+	return node, nil
+}
+
+// freePage pushes a page onto the free list
+func (t *DiskBTree) freePage(page uint32) error {
+	buf := make([]byte, t.pager.PageSize)
+	buf[0] = pageTypeFree
+	binary.BigEndian.PutUint32(buf[4:8], t.FreeHead)
+	if err := t.pager.WritePage(page, buf); err != nil {
+		return err
+	}
+	t.FreeHead = page
+	t.metaDirty = true
+	t.pager.record("free", page)
+	return nil
+}
+
+func (t *DiskBTree) readNode(page uint32) (*diskNode, error) {
+	buf, err := t.pager.ReadPage(page)
+	if err != nil {
+		return nil, err
+	}
+	return t.decodeNode(page, buf)
+}
+
+func (t *DiskBTree) decodeNode(page uint32, buf []byte) (*diskNode, error) {
+	node := &diskNode{page: page}
+	switch buf[0] {
+	case pageTypeLeaf:
+		node.leaf = true
+	case pageTypeInternal:
+	default:
+		return nil, fmt.Errorf("page %d is not a node page (type %d)", page, buf[0])
+	}
+
+	n := int(binary.BigEndian.Uint16(buf[2:4]))
+	if n > t.Order-1 {
+		return nil, fmt.Errorf("page %d holds %d keys, max is %d", page, n, t.Order-1)
+	}
+	node.keys = make([][]byte, n)
+	for i := range node.keys {
+		off := diskHeaderSize + i*t.KeyWidth
+		node.keys[i] = append([]byte{}, buf[off:off+t.KeyWidth]...)
+	}
+
+	node.children = []uint32{}
+	if !node.leaf {
+		base := diskHeaderSize + (t.Order-1)*t.KeyWidth
+		node.children = make([]uint32, n+1)
+		for i := range node.children {
+			node.children[i] = binary.BigEndian.Uint32(buf[base+i*4:])
+		}
+	}
+	return node, nil
+}
+
+func (t *DiskBTree) writeNode(node *diskNode) error {
+	buf := make([]byte, t.pager.PageSize)
+	buf[0] = pageTypeInternal
+	if node.leaf {
+		buf[0] = pageTypeLeaf
+	}
+	binary.BigEndian.PutUint16(buf[2:4], uint16(len(node.keys)))
+	for i, k := range node.keys {
+		copy(buf[diskHeaderSize+i*t.KeyWidth:], k)
+	}
+	if !node.leaf {
+		base := diskHeaderSize + (t.Order-1)*t.KeyWidth
+		for i, child := range node.children {
+			binary.BigEndian.PutUint32(buf[base+i*4:], child)
+		}
+	}
+	return t.pager.write(node.page, buf, PageAccess{
+		Op:        "write",
+		Page:      node.page,
+		Keys:      len(node.keys),
+		BytesUsed: t.bytesUsed(node),
+	})
+}
+
+func (t *DiskBTree) writeNodes(nodes ...*diskNode) error {
+	for _, n := range nodes {
+		if err := t.writeNode(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lowerBound returns the index of the first key >= key
+func (n *diskNode) lowerBound(key []byte) int {
+	i := 0
+	for i < len(n.keys) && bytes.Compare(key, n.keys[i]) > 0 {
+		i++
+	}
+	return i
+}
+
+func insertBytes(slice [][]byte, index int, value []byte) [][]byte {
+	slice = append(slice, nil)
+	copy(slice[index+1:], slice[index:])
+	slice[index] = value
+	return slice
+}
+
+func removeBytes(slice [][]byte, index int) [][]byte {
+	return append(slice[:index], slice[index+1:]...)
+}
+
+func insertPage(slice []uint32, index int, value uint32) []uint32 {
+	slice = append(slice, 0)
+	copy(slice[index+1:], slice[index:])
+	slice[index] = value
+	return slice
+}
+
+func removePage(slice []uint32, index int) []uint32 {
+	return append(slice[:index], slice[index+1:]...)
+}
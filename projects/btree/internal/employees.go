@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// EmployeesRows is the row count employees.sql inserts: generate_series(0, 1000000)
+// yields 1,000,001 rows
+const EmployeesRows = 1000001
+
+// HeapRowsPerPage is roughly how many employees rows PostgreSQL fits in an
+// 8 KB heap page: a 24-byte tuple header, a 4-byte id, a name of up to 10
+// characters and a 4-byte line pointer each
+const HeapRowsPerPage = 185
+
+// randomStringChars is the chars array of random_string in employees.sql
+const randomStringChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Employee is a row of the employees table
+type Employee struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// RandomString mirrors random_string(length) from employees.sql: the result
+// has between 1 and length characters, and each character index is
+// 1+random()*(n-1) rounded to an integer the way PostgreSQL casts a float, so
+// the first and last characters of the alphabet are half as likely as the rest
+func RandomString(rng *rand.Rand, length int) string {
+	n := int(math.Trunc(rng.Float64()*float64(length) + 1))
+	last := float64(len(randomStringChars) - 1)
+	buf := make([]byte, n)
+	for i := range buf {
+		buf[i] = randomStringChars[int(math.RoundToEven(rng.Float64()*last))]
+	}
+	return string(buf)
+}
+
+// GenerateEmployees produces the rows employees.sql inserts, with ids from 1
+// and names from RandomString(10). The same seed always yields the same rows.
+func GenerateEmployees(seed int64, rows int) []Employee {
+	rng := rand.New(rand.NewSource(seed))
+	employees := make([]Employee, rows)
+	for i := range employees {
+		employees[i] = Employee{ID: int64(i + 1), Name: RandomString(rng, 10)}
+	}
+	return employees
+}
+
+// EmployeesTable is the employees table as PostgreSQL stores it: rows in heap
+// pages in insertion order, a unique primary key index on id and a
+// non-unique secondary index on name. Index entries are RowKeys whose RowID
+// is the row's tuple ID, page*HeapRowsPerPage+slot.
+type EmployeesTable struct {
+	Heap    [][]Employee `json:"-"`
+	Rows    int          `json:"rows"`
+	Primary *BTree       `json:"-"` // employees_pkey on id
+	ByName  *BTree       `json:"-"` // employees_name on name
+}
+
+// LoadEmployees generates the table and builds both indexes with BulkLoad,
+// as CREATE INDEX would, using B-Trees of the given order
+func LoadEmployees(seed int64, rows, order int) (*EmployeesTable, error) {
+	if rows < 0 {
+		return nil, fmt.Errorf("rows must not be negative, got %d", rows)
+	}
+	table := &EmployeesTable{
+		Rows:    rows,
+		Primary: NewBTree(order),
+		ByName:  NewNonUniqueBTree(order),
+	}
+
+	employees := GenerateEmployees(seed, rows)
+	ids := make([]Key, len(employees))
+	names := make([]Key, len(employees))
+	for i, e := range employees {
+		page, slot := i/HeapRowsPerPage, i%HeapRowsPerPage
+		if slot == 0 {
+			table.Heap = append(table.Heap, make([]Employee, 0, HeapRowsPerPage))
+		}
+		table.Heap[page] = append(table.Heap[page], e)
+
+		tid := int64(i)
+		ids[i] = RowKey{Key: IntKey(e.ID), RowID: tid}
+		names[i] = RowKey{Key: StringKey(e.Name), RowID: tid}
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].Compare(names[j]) < 0 })
+
+	if err := table.Primary.BulkLoad(ids, 1); err != nil {
+		return nil, fmt.Errorf("build primary key index: %w", err)
+	}
+	if err := table.ByName.BulkLoad(names, 1); err != nil {
+		return nil, fmt.Errorf("build name index: %w", err)
+	}
+	return table, nil
+}
+
+// ScanResult is the outcome of a query and the work it took
+type ScanResult struct {
+	Method       string     `json:"method"`           // "index" or "seq"
+	Column       string     `json:"column"`           // "id" or "name"
+	Rows         []Employee `json:"rows"`             // Matching rows
+	IndexNodes   []string   `json:"indexNodes"`       // Distinct index nodes visited, in visit order
+	HeapPages    []int      `json:"heapPages"`        // Distinct heap pages read, in read order
+	RowsExamined int        `json:"rowsExamined"`     // Heap rows read
+	Height       int        `json:"height,omitempty"` // Height of the index used
+}
+
+// Index returns the B-Tree indexing a column
+func (t *EmployeesTable) Index(column string) (*BTree, error) {
+	switch column {
+	case "id":
+		return t.Primary, nil
+	case "name":
+		return t.ByName, nil
+	}
+	return nil, fmt.Errorf("no index on column %q", column)
+}
+
+// IndexScan answers WHERE column = key by seeking the column's index to the
+// first matching entry, walking entries while they match, and fetching each
+// row from the heap by tuple ID
+func (t *EmployeesTable) IndexScan(column string, key Key) (ScanResult, error) {
+	index, err := t.Index(column)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	result := ScanResult{Method: "index", Column: column, Rows: []Employee{}, Height: index.Height()}
+
+	visited := make(map[string]bool)
+	visit := func(path []string) {
+		for _, id := range path {
+			if !visited[id] {
+				visited[id] = true
+				result.IndexNodes = append(result.IndexNodes, id)
+			}
+		}
+	}
+	pages := make(map[int]bool)
+
+	c := index.Cursor()
+	ok := c.Seek(key)
+	visit(c.Path())
+	for ; ok && EntryKey(c.Key()).Compare(key) == 0; ok = c.Next() {
+		visit(c.Path())
+		tid := c.Key().(RowKey).RowID
+		page, slot := int(tid)/HeapRowsPerPage, int(tid)%HeapRowsPerPage
+		if !pages[page] {
+			pages[page] = true
+			result.HeapPages = append(result.HeapPages, page)
+		}
+		result.RowsExamined++
+		result.Rows = append(result.Rows, t.Heap[page][slot])
+	}
+	return result, nil
+}
+
+// SeqScan answers WHERE column = key by reading every heap page and
+// comparing every row
+func (t *EmployeesTable) SeqScan(column string, key Key) (ScanResult, error) {
+	if column != "id" && column != "name" {
+		return ScanResult{}, fmt.Errorf("no column %q", column)
+	}
+	result := ScanResult{Method: "seq", Column: column, Rows: []Employee{}, IndexNodes: []string{}}
+	for page, rows := range t.Heap {
+		result.HeapPages = append(result.HeapPages, page)
+		for _, e := range rows {
+			result.RowsExamined++
+			var value Key = IntKey(e.ID)
+			if column == "name" {
+				value = StringKey(e.Name)
+			}
+			if value.Compare(key) == 0 {
+				result.Rows = append(result.Rows, e)
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,278 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Repro operation types
+const (
+	ReproInsert = "insert"
+	ReproDelete = "delete"
+	ReproSearch = "search"
+	ReproRange  = "range"
+)
+
+// fuzzKeySpace bounds decoded keys so random streams revisit the same keys
+// and exercise duplicates, deletes of present keys and merges
+const fuzzKeySpace = 64
+
+// ReproOp is one operation of a reproduction. End is only used by range.
+type ReproOp struct {
+	Type string `json:"type"`
+	Key  int64  `json:"key"`
+	End  int64  `json:"end,omitempty"`
+}
+
+func (op ReproOp) String() string {
+	if op.Type == ReproRange {
+		return fmt.Sprintf("%s %d %d", op.Type, op.Key, op.End)
+	}
+	return fmt.Sprintf("%s %d", op.Type, op.Key)
+}
+
+// Repro is a sequence of operations on a unique B-Tree of integer keys. Its
+// text form is one line per operation after an order line and, unless it is
+// the median policy, a split policy line:
+//
+//	order 3
+//	policy lazy
+//	insert 1
+//	delete 1
+//	search 2
+//	range 1 5
+//
+// so a failing sequence can be shrunk by deleting lines, and read back with
+// ParseRepro.
+type Repro struct {
+	Order  int         `json:"order"`
+	Policy SplitPolicy `json:"policy"`
+	Ops    []ReproOp   `json:"ops"`
+}
+
+func (r Repro) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "order %d\n", r.Order)
+	if r.Policy != "" && r.Policy != SplitMedian {
+		fmt.Fprintf(&b, "policy %s\n", r.Policy)
+	}
+	for _, op := range r.Ops {
+		b.WriteString(op.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// DecodeRepro turns any byte stream into a repro, so fuzzers can mutate and
+// minimize raw bytes freely. The first byte picks an order from 3 to 16 and a
+// split policy; each following operation takes a byte for its type and a
+// byte for its key, plus one for a range's end.
+func DecodeRepro(data []byte) Repro {
+	r := Repro{Order: 3, Policy: SplitMedian}
+	if len(data) == 0 {
+		return r
+	}
+	r.Order = 3 + int(data[0])%14
+	r.Policy = SplitPolicies[int(data[0])/14%len(SplitPolicies)]
+	data = data[1:]
+	for len(data) >= 2 {
+		op := ReproOp{Key: int64(data[1]) % fuzzKeySpace}
+		switch data[0] % 4 {
+		case 0:
+			op.Type = ReproInsert
+		case 1:
+			op.Type = ReproDelete
+		case 2:
+			op.Type = ReproSearch
+		case 3:
+			if len(data) < 3 {
+				return r
+			}
+			op.Type = ReproRange
+			op.End = int64(data[2]) % fuzzKeySpace
+			data = data[1:]
+		}
+		data = data[2:]
+		r.Ops = append(r.Ops, op)
+	}
+	return r
+}
+
+// ParseRepro reads the text form of a repro. Blank lines and lines starting
+// with # are ignored.
+func ParseRepro(text string) (Repro, error) {
+	r := Repro{Policy: SplitMedian}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "policy" {
+			if len(fields) != 2 {
+				return Repro{}, fmt.Errorf("line %d: policy takes 1 argument, got %d", line, len(fields)-1)
+			}
+			policy, err := ParseSplitPolicy(fields[1])
+			if err != nil {
+				return Repro{}, fmt.Errorf("line %d: %w", line, err)
+			}
+			r.Policy = policy
+			continue
+		}
+		args := make([]int64, len(fields)-1)
+		for i, field := range fields[1:] {
+			n, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return Repro{}, fmt.Errorf("line %d: %q is not an integer", line, field)
+			}
+			args[i] = n
+		}
+
+		want := 1
+		switch fields[0] {
+		case "order", ReproInsert, ReproDelete, ReproSearch:
+		case ReproRange:
+			want = 2
+		default:
+			return Repro{}, fmt.Errorf("line %d: unknown operation %q", line, fields[0])
+		}
+		if len(args) != want {
+			return Repro{}, fmt.Errorf("line %d: %s takes %d argument(s), got %d", line, fields[0], want, len(args))
+		}
+		switch fields[0] {
+		case "order":
+			if r.Order != 0 {
+				return Repro{}, fmt.Errorf("line %d: order is already set", line)
+			}
+			if args[0] < 3 {
+				return Repro{}, fmt.Errorf("line %d: order must be at least 3, got %d", line, args[0])
+			}
+			r.Order = int(args[0])
+		case ReproInsert, ReproDelete, ReproSearch:
+			r.Ops = append(r.Ops, ReproOp{Type: fields[0], Key: args[0]})
+		case ReproRange:
+			r.Ops = append(r.Ops, ReproOp{Type: fields[0], Key: args[0], End: args[1]})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Repro{}, err
+	}
+	if r.Order == 0 {
+		return Repro{}, fmt.Errorf("missing order line")
+	}
+	return r, nil
+}
+
+// ReproFailure describes the first operation where the tree disagreed with
+// the oracle or broke an invariant
+type ReproFailure struct {
+	Step   int     `json:"step"` // Index into Ops
+	Op     ReproOp `json:"op"`
+	Reason string  `json:"reason"`
+}
+
+func (f *ReproFailure) Error() string {
+	return fmt.Sprintf("op %d (%s): %s", f.Step, f.Op, f.Reason)
+}
+
+// Run replays the repro against a B-Tree and a sorted-slice oracle, checking
+// every result and every structural invariant after each operation. It
+// returns a *ReproFailure for the first divergence.
+func (r Repro) Run() error {
+	bt := NewBTree(r.Order)
+	bt.Split.Policy = r.Policy
+	var oracle []int64
+	find := func(k int64) (int, bool) {
+		i := sort.Search(len(oracle), func(i int) bool { return oracle[i] >= k })
+		return i, i < len(oracle) && oracle[i] == k
+	}
+
+	for step, op := range r.Ops {
+		fail := func(format string, args ...interface{}) error {
+			return &ReproFailure{Step: step, Op: op, Reason: fmt.Sprintf(format, args...)}
+		}
+		i, present := find(op.Key)
+
+		switch op.Type {
+		case ReproInsert:
+			err := bt.Insert(IntKey(op.Key))
+			if present && err == nil {
+				return fail("duplicate key was accepted")
+			}
+			if !present {
+				if err != nil {
+					return fail("insert failed: %v", err)
+				}
+				oracle = append(oracle, 0)
+				copy(oracle[i+1:], oracle[i:])
+				oracle[i] = op.Key
+			}
+		case ReproDelete:
+			if deleted := bt.Delete(IntKey(op.Key)); deleted != present {
+				return fail("delete returned %t, want %t", deleted, present)
+			}
+			if present {
+				oracle = append(oracle[:i], oracle[i+1:]...)
+			}
+		case ReproSearch:
+			nodeID, index, found := bt.Search(IntKey(op.Key))
+			if found != present {
+				return fail("search found %t, want %t", found, present)
+			}
+			if found && bt.Nodes[nodeID].Keys[index].Compare(IntKey(op.Key)) != 0 {
+				return fail("search pointed at %s", bt.Nodes[nodeID].Keys[index])
+			}
+		case ReproRange:
+			got := bt.RangeSearch(IntKey(op.Key), IntKey(op.End))
+			want := []int64{}
+			for _, k := range oracle {
+				if k >= op.Key && k <= op.End {
+					want = append(want, k)
+				}
+			}
+			if len(got) != len(want) {
+				return fail("range returned %v, want %v", got, want)
+			}
+			for j := range got {
+				if got[j].Compare(IntKey(want[j])) != 0 {
+					return fail("range returned %v, want %v", got, want)
+				}
+			}
+		default:
+			return fail("unknown operation")
+		}
+
+		for _, check := range bt.CheckInvariants() {
+			if !check.OK {
+				return fail("invariant %s violated: %s", check.Name, strings.Join(check.Violations, "; "))
+			}
+		}
+	}
+	return nil
+}
+
+// Minimize shrinks a failing repro by repeatedly dropping operations while it
+// still fails, first in halves and then one at a time. A passing repro is
+// returned unchanged.
+func (r Repro) Minimize() Repro {
+	if r.Run() == nil {
+		return r
+	}
+	ops := r.Ops
+	for chunk := len(ops) / 2; chunk >= 1; chunk /= 2 {
+		for start := 0; start+chunk <= len(ops); {
+			candidate := append(append([]ReproOp{}, ops[:start]...), ops[start+chunk:]...)
+			if (Repro{Order: r.Order, Policy: r.Policy, Ops: candidate}).Run() != nil {
+				ops = candidate
+			} else {
+				start += chunk
+			}
+		}
+	}
+	return Repro{Order: r.Order, Policy: r.Policy, Ops: ops}
+}
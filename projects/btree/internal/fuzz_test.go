@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// FuzzBTree replays decoded operation streams against a sorted-slice oracle.
+// Failures print a minimized repro that scenarios.FromRepro turns into a
+// scenario. The repros kept under scenarios run first as regressions.
+func FuzzBTree(f *testing.F) {
+	files, err := filepath.Glob("../scenarios/repros/*.repro")
+	if err != nil || len(files) == 0 {
+		f.Fatalf("no repros found: %v", err)
+	}
+	for _, file := range files {
+		text, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		r, err := ParseRepro(string(text))
+		if err != nil {
+			f.Fatalf("%s: %v", file, err)
+		}
+		if err := r.Run(); err != nil {
+			f.Fatalf("%s: %v", file, err)
+		}
+	}
+
+	f.Add([]byte{0, 0, 1, 0, 2, 0, 3})                                   // Order 3, three inserts
+	f.Add([]byte{1, 0, 5, 0, 9, 0, 2, 0, 7, 1, 5, 2, 9, 3, 0, 63})       // Order 4, deletes and a range
+	f.Add([]byte{13, 0, 1, 0, 2, 0, 3, 0, 4, 0, 5, 1, 3, 1, 1, 3, 2, 4}) // Order 16
+	// Every order under every split policy
+	for config := byte(0); config < 56; config++ {
+		seq := []byte{config}
+		for k := byte(0); k < 40; k++ {
+			seq = append(seq, 0, k*7)
+		}
+		for k := byte(0); k < 40; k++ {
+			seq = append(seq, 1, k*3)
+		}
+		f.Add(seq)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := DecodeRepro(data)
+		if err := r.Run(); err != nil {
+			t.Fatalf("%v\nminimized repro:\n%s", err, r.Minimize())
+		}
+	})
+}
@@ -0,0 +1,318 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// KeyKind identifies the type of values stored in a B-Tree
+type KeyKind string
+
+const (
+	KindInt       KeyKind = "int"
+	KindString    KeyKind = "string"
+	KindBytes     KeyKind = "bytes"
+	KindComposite KeyKind = "composite"
+)
+
+// Key is an ordered value stored in the B-Tree.
+// All keys in a single tree are expected to share the same kind.
+type Key interface {
+	// Compare returns a negative number if the key sorts before other,
+	// zero if they are equal and a positive number otherwise
+	Compare(other Key) int
+	// Kind returns the key kind
+	Kind() KeyKind
+	// String returns the label used in visualizations
+	String() string
+}
+
+// IntKey is a signed integer key
+type IntKey int64
+
+// Compare implements Key
+func (k IntKey) Compare(other Key) int {
+	o, ok := other.(IntKey)
+	if !ok {
+		return compareKinds(k, other)
+	}
+	switch {
+	case k < o:
+		return -1
+	case k > o:
+		return 1
+	}
+	return 0
+}
+
+// Kind implements Key
+func (k IntKey) Kind() KeyKind { return KindInt }
+
+// String implements Key
+func (k IntKey) String() string { return strconv.FormatInt(int64(k), 10) }
+
+// StringKey is a text key compared byte-wise, like a C collation
+type StringKey string
+
+// Compare implements Key
+func (k StringKey) Compare(other Key) int {
+	o, ok := other.(StringKey)
+	if !ok {
+		return compareKinds(k, other)
+	}
+	return strings.Compare(string(k), string(o))
+}
+
+// Kind implements Key
+func (k StringKey) Kind() KeyKind { return KindString }
+
+// String implements Key
+func (k StringKey) String() string { return string(k) }
+
+// BytesKey is a raw byte slice key
+type BytesKey []byte
+
+// Compare implements Key
+func (k BytesKey) Compare(other Key) int {
+	o, ok := other.(BytesKey)
+	if !ok {
+		return compareKinds(k, other)
+	}
+	return bytes.Compare(k, o)
+}
+
+// Kind implements Key
+func (k BytesKey) Kind() KeyKind { return KindBytes }
+
+// String implements Key
+func (k BytesKey) String() string { return "0x" + hex.EncodeToString(k) }
+
+// MarshalJSON renders byte keys as hex strings instead of base64
+func (k BytesKey) MarshalJSON() ([]byte, error) {
+	return json.Marshal(k.String())
+}
+
+// CompositeKey is a tuple of keys compared column by column,
+// as in a multi-column index on (last_name, id)
+type CompositeKey []Key
+
+// Compare implements Key. A tuple that is a prefix of another sorts first.
+func (k CompositeKey) Compare(other Key) int {
+	o, ok := other.(CompositeKey)
+	if !ok {
+		return compareKinds(k, other)
+	}
+	for i := 0; i < len(k) && i < len(o); i++ {
+		if c := k[i].Compare(o[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(k) < len(o):
+		return -1
+	case len(k) > len(o):
+		return 1
+	}
+	return 0
+}
+
+// Kind implements Key
+func (k CompositeKey) Kind() KeyKind { return KindComposite }
+
+// String implements Key
+func (k CompositeKey) String() string {
+	parts := make([]string, len(k))
+	for i, part := range k {
+		parts[i] = part.String()
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// RowKey is an entry of a non-unique index: the indexed key plus the row it
+// points to. The row ID breaks ties so duplicates have a defined order.
+type RowKey struct {
+	Key   Key   `json:"key"`
+	RowID int64 `json:"rowId"`
+}
+
+// Compare implements Key. A bare key sorts before all of its row entries,
+// which makes it a lower bound for its duplicates.
+func (k RowKey) Compare(other Key) int {
+	o, ok := other.(RowKey)
+	if !ok {
+		if c := k.Key.Compare(other); c != 0 {
+			return c
+		}
+		return 1
+	}
+	if c := k.Key.Compare(o.Key); c != 0 {
+		return c
+	}
+	switch {
+	case k.RowID < o.RowID:
+		return -1
+	case k.RowID > o.RowID:
+		return 1
+	}
+	return 0
+}
+
+// Kind implements Key
+func (k RowKey) Kind() KeyKind { return k.Key.Kind() }
+
+// String implements Key
+func (k RowKey) String() string { return fmt.Sprintf("%s#%d", k.Key, k.RowID) }
+
+// EntryKey returns the indexed key of a stored entry, unwrapping row entries
+func EntryKey(k Key) Key {
+	if r, ok := k.(RowKey); ok {
+		return r.Key
+	}
+	return k
+}
+
+// HasPrefix reports whether key starts with prefix. Composite keys match on
+// leading columns, and a bare value is a prefix of their first column;
+// strings and byte slices match on leading bytes, and integers only on
+// equality.
+func HasPrefix(key, prefix Key) bool {
+	switch k := EntryKey(key).(type) {
+	case StringKey:
+		p, ok := prefix.(StringKey)
+		return ok && strings.HasPrefix(string(k), string(p))
+	case BytesKey:
+		p, ok := prefix.(BytesKey)
+		return ok && bytes.HasPrefix(k, p)
+	case CompositeKey:
+		p, ok := prefix.(CompositeKey)
+		if !ok {
+			return HasPrefix(k, CompositeKey{prefix})
+		}
+		if len(p) > len(k) {
+			return false
+		}
+		for i := range p {
+			if i == len(p)-1 && !HasPrefix(k[i], p[i]) {
+				return false
+			}
+			if i < len(p)-1 && k[i].Compare(p[i]) != 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return EntryKey(key).Compare(prefix) == 0
+}
+
+// ParseKey converts a decoded JSON or scenario value into a key of the given kind.
+// An empty kind infers the key kind from the value.
+func ParseKey(kind KeyKind, value interface{}) (Key, error) {
+	switch kind {
+	case "":
+		return inferKey(value)
+	case KindInt:
+		switch v := value.(type) {
+		case int:
+			return IntKey(v), nil
+		case int64:
+			return IntKey(v), nil
+		case float64:
+			// JSON numbers arrive as float64; a fraction is a typo, not a key
+			if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+				return nil, fmt.Errorf("invalid int key %v", v)
+			}
+			return IntKey(int64(v)), nil
+		case string:
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid int key %q", v)
+			}
+			return IntKey(n), nil
+		}
+	case KindString:
+		switch v := value.(type) {
+		case string:
+			return StringKey(v), nil
+		case float64, int, int64:
+			return StringKey(fmt.Sprintf("%v", v)), nil
+		}
+	case KindBytes:
+		if s, ok := value.(string); ok {
+			if strings.HasPrefix(s, "0x") {
+				b, err := hex.DecodeString(s[2:])
+				if err != nil {
+					return nil, fmt.Errorf("invalid bytes key %q", s)
+				}
+				return BytesKey(b), nil
+			}
+			return BytesKey(s), nil
+		}
+		if b, ok := value.([]byte); ok {
+			return BytesKey(append([]byte{}, b...)), nil
+		}
+	case KindComposite:
+		return parseComposite(value)
+	default:
+		return nil, fmt.Errorf("unknown key kind %q", kind)
+	}
+	return nil, fmt.Errorf("cannot use %v (%T) as %s key", value, value, kind)
+}
+
+// ParseKeys converts a list of values into keys of the given kind
+func ParseKeys(kind KeyKind, values []interface{}) ([]Key, error) {
+	keys := make([]Key, 0, len(values))
+	for _, v := range values {
+		k, err := ParseKey(kind, v)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func inferKey(value interface{}) (Key, error) {
+	switch v := value.(type) {
+	case Key:
+		return v, nil
+	case int, int64, float64:
+		return ParseKey(KindInt, v)
+	case string:
+		return StringKey(v), nil
+	case []byte:
+		return ParseKey(KindBytes, v)
+	case []interface{}:
+		return parseComposite(v)
+	}
+	return nil, fmt.Errorf("cannot infer key kind for %v (%T)", value, value)
+}
+
+func parseComposite(value interface{}) (Key, error) {
+	parts, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("composite key must be a list, got %T", value)
+	}
+	key := make(CompositeKey, 0, len(parts))
+	for _, p := range parts {
+		k, err := inferKey(p)
+		if err != nil {
+			return nil, err
+		}
+		key = append(key, k)
+	}
+	return key, nil
+}
+
+// compareKinds gives keys of different kinds a stable order so mixed trees
+// never panic, even though they are not meaningful
+func compareKinds(a, b Key) int {
+	if r, ok := b.(RowKey); ok {
+		return -r.Compare(a)
+	}
+	return strings.Compare(string(a.Kind()), string(b.Kind()))
+}
@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Common page sizes
+const (
+	PageSize4K = 4096
+	PageSize8K = 8192
+)
+
+// ErrPageOutOfRange is returned when reading a page past the end of the file
+var ErrPageOutOfRange = errors.New("page number out of range")
+
+// PageFile is the storage a Pager reads pages from and writes pages to
+type PageFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Close() error
+}
+
+// MemoryFile is an in-memory PageFile, used by simulations so no file is created
+type MemoryFile struct {
+	data []byte
+}
+
+// NewMemoryFile creates an empty in-memory page file
+func NewMemoryFile() *MemoryFile {
+	return &MemoryFile{}
+}
+
+// ReadAt implements io.ReaderAt
+func (f *MemoryFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt implements io.WriterAt, growing the file as needed
+func (f *MemoryFile) WriteAt(p []byte, off int64) (int, error) {
+	end := int(off) + len(p)
+	if end > len(f.data) {
+		f.data = append(f.data, make([]byte, end-len(f.data))...)
+	}
+	return copy(f.data[off:], p), nil
+}
+
+// Close implements PageFile
+func (f *MemoryFile) Close() error {
+	return nil
+}
+
+// PageAccess records a single page I/O for visualization
+type PageAccess struct {
+	Op        string `json:"op"` // read, write, alloc, free
+	Page      uint32 `json:"page"`
+	Keys      int    `json:"keys,omitempty"`      // keys in a written node page
+	BytesUsed int    `json:"bytesUsed,omitempty"` // bytes used by a written node page
+}
+
+// Pager reads and writes fixed-size pages of a single file
+type Pager struct {
+	file      PageFile
+	PageSize  int    `json:"pageSize"`
+	PageCount uint32 `json:"pageCount"`
+	Reads     int    `json:"reads"`
+	Writes    int    `json:"writes"`
+	Trace     []PageAccess
+	// OnAccess, if set, is called after each recorded page access
+	OnAccess func(PageAccess)
+}
+
+// NewPager creates a pager over file. pageCount is the number of pages the
+// file already holds.
+func NewPager(file PageFile, pageSize int, pageCount uint32) (*Pager, error) {
+	if pageSize < 128 || pageSize > 65536 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("page size %d must be a power of two between 128 and 65536", pageSize)
+	}
+	return &Pager{
+		file:      file,
+		PageSize:  pageSize,
+		PageCount: pageCount,
+		Trace:     []PageAccess{},
+	}, nil
+}
+
+// OpenPagerFile opens (or creates) a page file on disk
+func OpenPagerFile(path string, pageSize int) (*Pager, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size()%int64(pageSize) != 0 {
+		file.Close()
+		return nil, fmt.Errorf("file %s size %d is not a multiple of page size %d", path, info.Size(), pageSize)
+	}
+	pager, err := NewPager(file, pageSize, uint32(info.Size()/int64(pageSize)))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return pager, nil
+}
+
+// ReadPage reads page n into a new buffer
+func (p *Pager) ReadPage(n uint32) ([]byte, error) {
+	if n >= p.PageCount {
+		return nil, fmt.Errorf("%w: %d", ErrPageOutOfRange, n)
+	}
+	buf := make([]byte, p.PageSize)
+	if _, err := p.file.ReadAt(buf, int64(n)*int64(p.PageSize)); err != nil && err != io.EOF {
+		return nil, err
+	}
+	p.Reads++
+	p.record("read", n)
+	return buf, nil
+}
+
+// WritePage writes a full page buffer to page n
+func (p *Pager) WritePage(n uint32, buf []byte) error {
+	return p.write(n, buf, PageAccess{Op: "write", Page: n})
+}
+
+// write writes page n and records it as access
+func (p *Pager) write(n uint32, buf []byte, access PageAccess) error {
+	if len(buf) != p.PageSize {
+		return fmt.Errorf("page buffer is %d bytes, want %d", len(buf), p.PageSize)
+	}
+	if _, err := p.file.WriteAt(buf, int64(n)*int64(p.PageSize)); err != nil {
+		return err
+	}
+	if n >= p.PageCount {
+		p.PageCount = n + 1
+	}
+	p.Writes++
+	p.recordAccess(access)
+	return nil
+}
+
+// Append reserves a new zeroed page at the end of the file and returns its number
+func (p *Pager) Append() (uint32, error) {
+	n := p.PageCount
+	if _, err := p.file.WriteAt(make([]byte, p.PageSize), int64(n)*int64(p.PageSize)); err != nil {
+		return 0, err
+	}
+	p.PageCount++
+	p.record("alloc", n)
+	return n, nil
+}
+
+// peek reads a page without counting it, for inspecting the file in
+// visualizations
+func (p *Pager) peek(n uint32) ([]byte, error) {
+	if n >= p.PageCount {
+		return nil, fmt.Errorf("%w: %d", ErrPageOutOfRange, n)
+	}
+	buf := make([]byte, p.PageSize)
+	if _, err := p.file.ReadAt(buf, int64(n)*int64(p.PageSize)); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// ResetTrace clears the recorded page accesses
+func (p *Pager) ResetTrace() {
+	p.Trace = []PageAccess{}
+}
+
+// Close closes the underlying file
+func (p *Pager) Close() error {
+	return p.file.Close()
+}
+
+func (p *Pager) record(op string, page uint32) {
+	p.recordAccess(PageAccess{Op: op, Page: page})
+}
+
+func (p *Pager) recordAccess(access PageAccess) {
+	p.Trace = append(p.Trace, access)
+	if p.OnAccess != nil {
+		p.OnAccess(access)
+	}
+}
@@ -0,0 +1,424 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownVersion is returned when reading a version the tree never produced
+var ErrUnknownVersion = errors.New("unknown tree version")
+
+// PersistentBTree is a unique, copy-on-write B-Tree. Nodes are never modified
+// once written: an update copies only the nodes on the root-to-leaf path it
+// changes, plus any siblings touched by a split, borrow or merge, and produces
+// a new root. Every earlier root stays readable, and subtrees the update did
+// not touch are shared between versions.
+//
+// Version 0 is the empty tree. Each successful Insert or Delete creates the
+// next version.
+type PersistentBTree struct {
+	Order    int
+	versions []*TreeVersion
+	roots    []*persistentNode
+	nodeSeq  int
+}
+
+// TreeVersion describes one version of a persistent tree
+type TreeVersion struct {
+	Version   int        `json:"version"`
+	RootID    string     `json:"rootId"`
+	Operation string     `json:"operation"`
+	Copies    []NodeCopy `json:"copies"`  // Nodes rewritten by this version, in path order
+	Created   []string   `json:"created"` // Nodes with no predecessor, from splits and a growing root
+	Removed   []string   `json:"removed"` // Nodes of the previous version the new root no longer reaches, copied ones included
+}
+
+// NodeCopy records that a node was rewritten under a new ID
+type NodeCopy struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type persistentNode struct {
+	id       string
+	version  int // Version that wrote the node
+	leaf     bool
+	keys     []Key
+	children []*persistentNode
+}
+
+// NewPersistentBTree creates an empty persistent B-Tree with the given order
+func NewPersistentBTree(order int) *PersistentBTree {
+	if order < 3 {
+		order = 3 // Minimum order for a B-Tree
+	}
+	return &PersistentBTree{
+		Order:    order,
+		versions: []*TreeVersion{{Version: 0, Operation: "create", Copies: []NodeCopy{}, Created: []string{}, Removed: []string{}}},
+		roots:    []*persistentNode{nil},
+	}
+}
+
+// Latest returns the newest version number
+func (t *PersistentBTree) Latest() int {
+	return len(t.roots) - 1
+}
+
+// Versions returns every version, oldest first
+func (t *PersistentBTree) Versions() []TreeVersion {
+	versions := make([]TreeVersion, len(t.versions))
+	for i, v := range t.versions {
+		versions[i] = *v
+	}
+	return versions
+}
+
+// Version returns one version
+func (t *PersistentBTree) Version(version int) (TreeVersion, error) {
+	if version < 0 || version >= len(t.versions) {
+		return TreeVersion{}, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	return *t.versions[version], nil
+}
+
+// minKeys is the fewest keys a non-root node holds. Splits are bottom-up, so
+// a node overflows to Order keys and both halves keep at least this many.
+func (t *PersistentBTree) minKeys() int {
+	return (t.Order - 1) / 2
+}
+
+// Search reports whether key is present in the given version
+func (t *PersistentBTree) Search(version int, key Key) (bool, error) {
+	root, err := t.root(version)
+	if err != nil {
+		return false, err
+	}
+	for node := root; node != nil; {
+		i := node.lowerBound(key)
+		if i < len(node.keys) && node.keys[i].Compare(key) == 0 {
+			return true, nil
+		}
+		if node.leaf {
+			break
+		}
+		node = node.children[i]
+	}
+	return false, nil
+}
+
+// RangeSearch finds all keys in [start, end] in the given version
+func (t *PersistentBTree) RangeSearch(version int, start, end Key) ([]Key, error) {
+	root, err := t.root(version)
+	if err != nil {
+		return nil, err
+	}
+	result := []Key{}
+	var walk func(node *persistentNode)
+	walk = func(node *persistentNode) {
+		for i, k := range node.keys {
+			if !node.leaf && k.Compare(start) > 0 {
+				walk(node.children[i])
+			}
+			if k.Compare(start) >= 0 && k.Compare(end) <= 0 {
+				result = append(result, k)
+			}
+			if k.Compare(end) > 0 {
+				return
+			}
+		}
+		if !node.leaf {
+			walk(node.children[len(node.children)-1])
+		}
+	}
+	if root != nil {
+		walk(root)
+	}
+	return result, nil
+}
+
+// Insert adds a key and returns the new version
+func (t *PersistentBTree) Insert(key Key) (int, error) {
+	latest := t.roots[t.Latest()]
+	if found, _ := t.Search(t.Latest(), key); found {
+		return t.Latest(), fmt.Errorf("%w: %s", ErrDuplicateKey, key)
+	}
+
+	w := t.begin(fmt.Sprintf("insert %s", key))
+	if latest == nil {
+		root := w.newNode(true)
+		root.keys = []Key{key}
+		return w.commit(root), nil
+	}
+
+	root, median, right := w.insert(latest, key)
+	if right != nil {
+		// The root split: grow the tree by one level
+		grown := w.newNode(false)
+		grown.keys = []Key{median}
+		grown.children = []*persistentNode{root, right}
+		root = grown
+	}
+	return w.commit(root), nil
+}
+
+// Delete removes a key and returns the new version. If the key is absent no
+// version is created and the latest version is returned.
+func (t *PersistentBTree) Delete(key Key) (int, bool) {
+	if found, _ := t.Search(t.Latest(), key); !found {
+		return t.Latest(), false
+	}
+
+	w := t.begin(fmt.Sprintf("delete %s", key))
+	root := w.delete(t.roots[t.Latest()], key)
+	if len(root.keys) == 0 {
+		// The root lost its last key: its only child becomes the root
+		if root.leaf {
+			root = nil
+		} else {
+			root = root.children[0]
+		}
+	}
+	return w.commit(root), true
+}
+
+// Snapshot returns the given version as a BTree with the same node IDs, so
+// nodes shared between versions keep their identity
+func (t *PersistentBTree) Snapshot(version int) (*BTree, error) {
+	root, err := t.root(version)
+	if err != nil {
+		return nil, err
+	}
+	bt := NewBTree(t.Order)
+	if root == nil {
+		return bt, nil
+	}
+	var copyNode func(n *persistentNode, parent string)
+	copyNode = func(n *persistentNode, parent string) {
+		node := &BTreeNode{
+			ID:       n.id,
+			Keys:     append([]Key{}, n.keys...),
+			Children: make([]string, 0, len(n.children)),
+			IsLeaf:   n.leaf,
+			Parent:   parent,
+		}
+		bt.Nodes[n.id] = node
+		for _, child := range n.children {
+			node.Children = append(node.Children, child.id)
+			copyNode(child, n.id)
+		}
+	}
+	copyNode(root, "")
+	bt.RootID = root.id
+	return bt, nil
+}
+
+// NodeVersions maps every node reachable from the given version to the
+// version that wrote it. Nodes written by an earlier version are shared.
+func (t *PersistentBTree) NodeVersions(version int) (map[string]int, error) {
+	root, err := t.root(version)
+	if err != nil {
+		return nil, err
+	}
+	written := make(map[string]int)
+	var walk func(n *persistentNode)
+	walk = func(n *persistentNode) {
+		written[n.id] = n.version
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	if root != nil {
+		walk(root)
+	}
+	return written, nil
+}
+
+func (t *PersistentBTree) root(version int) (*persistentNode, error) {
+	if version < 0 || version >= len(t.roots) {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	return t.roots[version], nil
+}
+
+// pathWriter builds one new version. Nodes it writes belong to the new
+// version and may be modified in place until commit; any other node is
+// shared and must be copied first.
+type pathWriter struct {
+	tree   *PersistentBTree
+	record *TreeVersion
+}
+
+func (t *PersistentBTree) begin(operation string) *pathWriter {
+	return &pathWriter{
+		tree: t,
+		record: &TreeVersion{
+			Version:   len(t.roots),
+			Operation: operation,
+			Copies:    []NodeCopy{},
+			Created:   []string{},
+			Removed:   []string{},
+		},
+	}
+}
+
+func (w *pathWriter) commit(root *persistentNode) int {
+	t := w.tree
+	if root != nil {
+		w.record.RootID = root.id
+	}
+	t.roots = append(t.roots, root)
+	t.versions = append(t.versions, w.record)
+	return w.record.Version
+}
+
+func (w *pathWriter) newNode(leaf bool) *persistentNode {
+	w.tree.nodeSeq++
+	node := &persistentNode{
+		id:       fmt.Sprintf("node-%d", w.tree.nodeSeq),
+		version:  w.record.Version,
+		leaf:     leaf,
+		keys:     []Key{},
+		children: []*persistentNode{},
+	}
+	w.record.Created = append(w.record.Created, node.id)
+	return node
+}
+
+// own returns a node this version may modify, copying it if it is shared
+func (w *pathWriter) own(n *persistentNode) *persistentNode {
+	if n.version == w.record.Version {
+		return n
+	}
+	w.tree.nodeSeq++
+	copied := &persistentNode{
+		id:       fmt.Sprintf("node-%d", w.tree.nodeSeq),
+		version:  w.record.Version,
+		leaf:     n.leaf,
+		keys:     append([]Key{}, n.keys...),
+		children: append([]*persistentNode{}, n.children...),
+	}
+	w.record.Copies = append(w.record.Copies, NodeCopy{From: n.id, To: copied.id})
+	w.record.Removed = append(w.record.Removed, n.id)
+	return copied
+}
+
+// insert adds key below n and returns n's replacement. If the replacement
+// overflowed it is split, and the median and new right node are returned too.
+func (w *pathWriter) insert(n *persistentNode, key Key) (*persistentNode, Key, *persistentNode) {
+	node := w.own(n)
+	i := node.lowerBound(key)
+	if node.leaf {
+		node.keys = insertAt(node.keys, i, key)
+	} else {
+		child, median, right := w.insert(node.children[i], key)
+		node.children[i] = child
+		if right != nil {
+			node.keys = insertAt(node.keys, i, median)
+			node.children = append(node.children, nil)
+			copy(node.children[i+2:], node.children[i+1:])
+			node.children[i+1] = right
+		}
+	}
+
+	if len(node.keys) < w.tree.Order {
+		return node, nil, nil
+	}
+	mid := len(node.keys) / 2
+	median := node.keys[mid]
+	right := w.newNode(node.leaf)
+	right.keys = append(right.keys, node.keys[mid+1:]...)
+	node.keys = node.keys[:mid:mid]
+	if !node.leaf {
+		right.children = append(right.children, node.children[mid+1:]...)
+		node.children = node.children[: mid+1 : mid+1]
+	}
+	return node, median, right
+}
+
+// delete removes key from the subtree of n and returns n's replacement,
+// which may hold fewer than the minimum number of keys for the caller to fix
+func (w *pathWriter) delete(n *persistentNode, key Key) *persistentNode {
+	node := w.own(n)
+	i := node.lowerBound(key)
+	present := i < len(node.keys) && node.keys[i].Compare(key) == 0
+
+	if node.leaf {
+		node.keys = removeAt(node.keys, i)
+		return node
+	}
+
+	if present {
+		// Replace with the predecessor, the largest key of the left subtree
+		pred := node.children[i]
+		for !pred.leaf {
+			pred = pred.children[len(pred.children)-1]
+		}
+		node.keys[i] = pred.keys[len(pred.keys)-1]
+		node.children[i] = w.delete(node.children[i], node.keys[i])
+	} else {
+		node.children[i] = w.delete(node.children[i], key)
+	}
+	w.rebalance(node, i)
+	return node
+}
+
+// rebalance tops up child i of node, which this version owns, if it fell
+// below the minimum, by borrowing from a sibling or merging with one
+func (w *pathWriter) rebalance(node *persistentNode, i int) {
+	child := node.children[i]
+	if len(child.keys) >= w.tree.minKeys() {
+		return
+	}
+
+	if i > 0 && len(node.children[i-1].keys) > w.tree.minKeys() {
+		left := w.own(node.children[i-1])
+		child.keys = insertAt(child.keys, 0, node.keys[i-1])
+		node.keys[i-1] = left.keys[len(left.keys)-1]
+		left.keys = left.keys[:len(left.keys)-1]
+		if !left.leaf {
+			moved := left.children[len(left.children)-1]
+			left.children = left.children[:len(left.children)-1]
+			child.children = append([]*persistentNode{moved}, child.children...)
+		}
+		node.children[i-1] = left
+		return
+	}
+	if i < len(node.children)-1 && len(node.children[i+1].keys) > w.tree.minKeys() {
+		right := w.own(node.children[i+1])
+		child.keys = append(child.keys, node.keys[i])
+		node.keys[i] = right.keys[0]
+		right.keys = right.keys[1:]
+		if !right.leaf {
+			moved := right.children[0]
+			right.children = right.children[1:]
+			child.children = append(child.children, moved)
+		}
+		node.children[i+1] = right
+		return
+	}
+
+	// Merge with a sibling; the merged node is written by this version
+	if i > 0 {
+		i--
+	}
+	left := w.own(node.children[i])
+	right := node.children[i+1]
+	if right.version != w.record.Version {
+		w.record.Removed = append(w.record.Removed, right.id)
+	}
+	left.keys = append(left.keys, node.keys[i])
+	left.keys = append(left.keys, right.keys...)
+	left.children = append(left.children, right.children...)
+	node.keys = removeAt(node.keys, i)
+	node.children = append(node.children[:i+1], node.children[i+2:]...)
+	node.children[i] = left
+}
+
+// lowerBound returns the index of the first key >= key
+func (n *persistentNode) lowerBound(key Key) int {
+	i := 0
+	for i < len(n.keys) && key.Compare(n.keys[i]) > 0 {
+		i++
+	}
+	return i
+}
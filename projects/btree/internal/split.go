@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+)
+
+// SplitPolicy selects how an insert makes room in a full node
+type SplitPolicy string
+
+const (
+	// SplitMedian splits full nodes on the way down around their median
+	SplitMedian SplitPolicy = "median"
+	// SplitRightmost splits like SplitMedian, except that a full node on the
+	// right edge of its level receiving a key greater than all of its keys
+	// keeps FillFactor of them on the left. Monotonically increasing keys,
+	// like a serial id, then leave nodes mostly full instead of half full.
+	SplitRightmost SplitPolicy = "rightmost"
+	// SplitRedistribute moves keys from a full node into an adjacent sibling
+	// with room, through their separator, and only splits when neither
+	// sibling has room, as a B*-tree does
+	SplitRedistribute SplitPolicy = "redistribute"
+	// SplitLazy descends without splitting, inserts into the leaf and splits
+	// overflowing nodes bottom-up, so only nodes that overflow are split
+	SplitLazy SplitPolicy = "lazy"
+)
+
+// DefaultFillFactor is the fraction of keys a rightmost split keeps on the
+// left, PostgreSQL's default for B-Tree leaves
+const DefaultFillFactor = 0.9
+
+// SplitPolicies lists every policy, in the order they are described above
+var SplitPolicies = []SplitPolicy{SplitMedian, SplitRightmost, SplitRedistribute, SplitLazy}
+
+// ParseSplitPolicy returns the policy with the given name. An empty name is
+// SplitMedian.
+func ParseSplitPolicy(name string) (SplitPolicy, error) {
+	if name == "" {
+		return SplitMedian, nil
+	}
+	for _, policy := range SplitPolicies {
+		if string(policy) == name {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown split policy %q", name)
+}
+
+// SplitConfig selects the split policy and its fill factor
+type SplitConfig struct {
+	Policy SplitPolicy `json:"policy"`
+	// FillFactor is the fraction of keys a rightmost split keeps on the
+	// left; zero means DefaultFillFactor
+	FillFactor float64 `json:"fillFactor"`
+}
+
+// fillFactor returns the configured fill factor, clamped to [0.5, 1]
+func (c SplitConfig) fillFactor() float64 {
+	switch {
+	case c.FillFactor == 0:
+		return DefaultFillFactor
+	case c.FillFactor < 0.5:
+		return 0.5
+	case c.FillFactor > 1:
+		return 1
+	}
+	return c.FillFactor
+}
+
+// bottomUp reports whether inserts split after reaching the leaf. Order 3 is
+// always bottom-up: its full nodes hold two keys, and splitting one before
+// the insert would leave one half empty.
+func (bt *BTree) bottomUp() bool {
+	return bt.Split.Policy == SplitLazy || bt.Order == 3
+}
+
+// insertBottomUp inserts into the leaf key belongs in, then splits each
+// node that overflowed to Order keys, walking up until one has room
+func (bt *BTree) insertBottomUp(key Key) {
+	node := bt.Nodes[bt.RootID]
+	for !node.IsLeaf {
+		i := 0
+		for i < len(node.Keys) && key.Compare(node.Keys[i]) > 0 {
+			i++
+		}
+		node = bt.Nodes[node.Children[i]]
+	}
+	i := 0
+	for i < len(node.Keys) && key.Compare(node.Keys[i]) > 0 {
+		i++
+	}
+	node.Keys = insertAt(node.Keys, i, key)
+
+	for len(node.Keys) == bt.Order {
+		if node.Parent == "" {
+			newRoot := bt.createNode(false)
+			newRoot.Children = append(newRoot.Children, node.ID)
+			node.Parent = newRoot.ID
+			bt.RootID = newRoot.ID
+			bt.emit(TraceEvent{Type: EventRootGrown, NodeID: node.ID, TargetID: newRoot.ID})
+		}
+		parent := bt.Nodes[node.Parent]
+		childIndex := 0
+		for parent.Children[childIndex] != node.ID {
+			childIndex++
+		}
+		bt.splitChild(parent.ID, childIndex, key)
+		node = parent
+	}
+}
+
+// splitIndex picks the position of the key a full node promotes when key is
+// being inserted below it
+func (bt *BTree) splitIndex(node *BTreeNode, key Key) int {
+	n := len(node.Keys)
+	if bt.Split.Policy == SplitRightmost && key.Compare(node.Keys[n-1]) >= 0 && bt.isRightmost(node) {
+		// Keep the fill factor on the left, but never less than the median,
+		// and leave the right node at least one key
+		left := int(math.Round(bt.Split.fillFactor() * float64(n)))
+		if left > n-2 {
+			left = n - 2
+		}
+		if left < n/2 {
+			left = n / 2
+		}
+		return left
+	}
+	return bt.splitPoint(node.Keys)
+}
+
+// isRightmost reports whether node is the last node of its level
+func (bt *BTree) isRightmost(node *BTreeNode) bool {
+	for node.Parent != "" {
+		parent := bt.Nodes[node.Parent]
+		if parent.Children[len(parent.Children)-1] != node.ID {
+			return false
+		}
+		node = parent
+	}
+	return true
+}
+
+// redistribute makes room in the full child at childIndex by moving keys to
+// the adjacent sibling with the fewest keys, evening the two out. It returns
+// false, changing nothing, when both siblings are full.
+func (bt *BTree) redistribute(parentID string, childIndex int) bool {
+	parent := bt.Nodes[parentID]
+	child := bt.Nodes[parent.Children[childIndex]]
+
+	sibling := -1
+	room := 0
+	for _, i := range []int{childIndex - 1, childIndex + 1} {
+		if i < 0 || i >= len(parent.Children) {
+			continue
+		}
+		if free := bt.Order - 1 - len(bt.Nodes[parent.Children[i]].Keys); free > room {
+			sibling, room = i, free
+		}
+	}
+	if sibling < 0 {
+		return false
+	}
+	target := bt.Nodes[parent.Children[sibling]]
+	count := (len(child.Keys) - len(target.Keys) + 1) / 2
+
+	var moved []Key
+	if sibling < childIndex {
+		// Separator and the first count-1 keys go to the end of the left
+		// sibling; the next key becomes the separator
+		sep := childIndex - 1
+		moved = append([]Key{parent.Keys[sep]}, child.Keys[:count-1]...)
+		target.Keys = append(target.Keys, moved...)
+		parent.Keys[sep] = child.Keys[count-1]
+		child.Keys = append([]Key{}, child.Keys[count:]...)
+		if !child.IsLeaf {
+			for _, id := range child.Children[:count] {
+				bt.Nodes[id].Parent = target.ID
+			}
+			target.Children = append(target.Children, child.Children[:count]...)
+			child.Children = append([]string{}, child.Children[count:]...)
+		}
+	} else {
+		// The last count-1 keys and the separator go to the front of the
+		// right sibling; the key before them becomes the separator
+		sep := childIndex
+		n := len(child.Keys)
+		moved = append(append([]Key{}, child.Keys[n-count+1:]...), parent.Keys[sep])
+		target.Keys = append(append([]Key{}, moved...), target.Keys...)
+		parent.Keys[sep] = child.Keys[n-count]
+		child.Keys = child.Keys[:n-count]
+		if !child.IsLeaf {
+			m := len(child.Children)
+			for _, id := range child.Children[m-count:] {
+				bt.Nodes[id].Parent = target.ID
+			}
+			target.Children = append(append([]string{}, child.Children[m-count:]...), target.Children...)
+			child.Children = child.Children[:m-count]
+		}
+	}
+
+	bt.emit(TraceEvent{
+		Type:      EventRedistributed,
+		NodeID:    child.ID,
+		TargetID:  target.ID,
+		ParentID:  parentID,
+		Separator: parent.Keys[min(childIndex, sibling)],
+		Keys:      moved,
+		Index:     min(childIndex, sibling),
+	})
+	return true
+}
@@ -0,0 +1,200 @@
+package internal
+
+import "fmt"
+
+// LevelStats summarizes one level of the tree, root first
+type LevelStats struct {
+	Level int `json:"level"`
+	Nodes int `json:"nodes"`
+	Keys  int `json:"keys"`
+}
+
+// TreeStats summarizes the shape of the tree. Fill factors are the fraction
+// of a node's Order-1 key slots in use.
+type TreeStats struct {
+	Height  int          `json:"height"`
+	Nodes   int          `json:"nodes"`
+	Keys    int          `json:"keys"`
+	Levels  []LevelStats `json:"levels"`
+	MinFill float64      `json:"minFill"`
+	AvgFill float64      `json:"avgFill"`
+	MaxFill float64      `json:"maxFill"`
+	Splits  int          `json:"splits"` // Node splits since creation
+	Merges  int          `json:"merges"` // Node merges since creation
+}
+
+// Stats returns structural statistics for the tree
+func (bt *BTree) Stats() TreeStats {
+	stats := TreeStats{
+		Levels: []LevelStats{},
+		Splits: bt.splits,
+		Merges: bt.merges,
+	}
+
+	capacity := float64(bt.Order - 1)
+	totalFill := 0.0
+	for depth, level := range bt.Levels() {
+		ls := LevelStats{Level: depth, Nodes: len(level)}
+		for _, id := range level {
+			n := len(bt.Nodes[id].Keys)
+			ls.Keys += n
+
+			fill := float64(n) / capacity
+			if stats.Nodes == 0 || fill < stats.MinFill {
+				stats.MinFill = fill
+			}
+			if fill > stats.MaxFill {
+				stats.MaxFill = fill
+			}
+			totalFill += fill
+			stats.Nodes++
+		}
+		stats.Keys += ls.Keys
+		stats.Levels = append(stats.Levels, ls)
+	}
+
+	stats.Height = len(stats.Levels)
+	if stats.Nodes > 0 {
+		stats.AvgFill = totalFill / float64(stats.Nodes)
+	}
+	return stats
+}
+
+// InvariantCheck is the result of one structural invariant
+type InvariantCheck struct {
+	Name       string   `json:"name"`
+	OK         bool     `json:"ok"`
+	Violations []string `json:"violations"`
+}
+
+// Invariant names reported by CheckInvariants
+const (
+	InvariantSorted         = "sorted"
+	InvariantOccupancy      = "occupancy"
+	InvariantBalanced       = "balanced"
+	InvariantParentPointers = "parent-pointers"
+)
+
+// CheckInvariants verifies that keys are in order within and across nodes,
+// every node holds between the minimum and maximum number of keys, all
+// leaves are at the same depth and parent pointers match the child lists.
+// The one exception is a node a rightmost split has just created on the
+// right edge, which may hold fewer than the minimum until appends fill it or
+// a delete reaches it.
+// Trees observed in the middle of a split or merge may legitimately fail.
+func (bt *BTree) CheckInvariants() []InvariantCheck {
+	checker := &invariantChecker{
+		tree:      bt,
+		reached:   make(map[string]bool),
+		leafDepth: -1,
+		results:   map[string]*InvariantCheck{},
+	}
+	for _, name := range []string{InvariantSorted, InvariantOccupancy, InvariantBalanced, InvariantParentPointers} {
+		checker.results[name] = &InvariantCheck{Name: name, OK: true, Violations: []string{}}
+	}
+
+	if bt.RootID != "" {
+		root := bt.Nodes[bt.RootID]
+		if root == nil {
+			checker.fail(InvariantParentPointers, "root %s does not exist", bt.RootID)
+		} else {
+			if root.Parent != "" {
+				checker.fail(InvariantParentPointers, "root %s has parent %s", root.ID, root.Parent)
+			}
+			checker.check(root, 0, nil, nil)
+		}
+	}
+	for id := range bt.Nodes {
+		if !checker.reached[id] {
+			checker.fail(InvariantParentPointers, "%s is not reachable from the root", id)
+		}
+	}
+
+	return []InvariantCheck{
+		*checker.results[InvariantSorted],
+		*checker.results[InvariantOccupancy],
+		*checker.results[InvariantBalanced],
+		*checker.results[InvariantParentPointers],
+	}
+}
+
+type invariantChecker struct {
+	tree      *BTree
+	reached   map[string]bool
+	leafDepth int
+	results   map[string]*InvariantCheck
+}
+
+func (c *invariantChecker) fail(name, format string, args ...interface{}) {
+	result := c.results[name]
+	result.OK = false
+	result.Violations = append(result.Violations, fmt.Sprintf(format, args...))
+}
+
+// check walks the subtree of node, whose keys must lie strictly between lo
+// and hi when those bounds are set
+func (c *invariantChecker) check(node *BTreeNode, depth int, lo, hi Key) {
+	bt := c.tree
+	if c.reached[node.ID] {
+		c.fail(InvariantParentPointers, "%s is reachable more than once", node.ID)
+		return
+	}
+	c.reached[node.ID] = true
+
+	for i, k := range node.Keys {
+		if i > 0 && node.Keys[i-1].Compare(k) >= 0 {
+			c.fail(InvariantSorted, "%s: %s is not greater than %s", node.ID, k, node.Keys[i-1])
+		}
+		if lo != nil && k.Compare(lo) <= 0 {
+			c.fail(InvariantSorted, "%s: %s is not greater than separator %s", node.ID, k, lo)
+		}
+		if hi != nil && k.Compare(hi) >= 0 {
+			c.fail(InvariantSorted, "%s: %s is not less than separator %s", node.ID, k, hi)
+		}
+	}
+
+	if len(node.Keys) > bt.Order-1 {
+		c.fail(InvariantOccupancy, "%s holds %d keys, max is %d", node.ID, len(node.Keys), bt.Order-1)
+	}
+	if node.ID != bt.RootID && len(node.Keys) < bt.minKeys() && !(hi == nil && bt.underfull[node.ID]) {
+		c.fail(InvariantOccupancy, "%s holds %d keys, min is %d", node.ID, len(node.Keys), bt.minKeys())
+	}
+	if node.ID != bt.RootID && len(node.Keys) == 0 {
+		c.fail(InvariantOccupancy, "%s is empty", node.ID)
+	}
+
+	if node.IsLeaf {
+		if len(node.Children) != 0 {
+			c.fail(InvariantParentPointers, "leaf %s has %d children", node.ID, len(node.Children))
+		}
+		if c.leafDepth < 0 {
+			c.leafDepth = depth
+		} else if depth != c.leafDepth {
+			c.fail(InvariantBalanced, "leaf %s is at depth %d, expected %d", node.ID, depth, c.leafDepth)
+		}
+		return
+	}
+
+	if len(node.Children) != len(node.Keys)+1 {
+		c.fail(InvariantOccupancy, "%s has %d keys but %d children", node.ID, len(node.Keys), len(node.Children))
+	}
+	for i, childID := range node.Children {
+		child := bt.Nodes[childID]
+		if child == nil {
+			c.fail(InvariantParentPointers, "%s points to missing child %s", node.ID, childID)
+			continue
+		}
+		if child.Parent != node.ID {
+			c.fail(InvariantParentPointers, "%s has parent %q, expected %s", childID, child.Parent, node.ID)
+		}
+
+		childLo, childHi := lo, hi
+		if i > 0 && i-1 < len(node.Keys) {
+			childLo = node.Keys[i-1]
+		}
+		if i < len(node.Keys) {
+			childHi = node.Keys[i]
+		}
+		c.check(child, depth+1, childLo, childHi)
+	}
+}
@@ -0,0 +1,49 @@
+package internal
+
+// TraceEventType identifies a structural change made during an insert or delete
+type TraceEventType string
+
+const (
+	// EventRootGrown: the full root NodeID was pushed down under new root TargetID
+	EventRootGrown TraceEventType = "root-grown"
+	// EventMedianChosen: full node NodeID will split around Key at position Index
+	EventMedianChosen TraceEventType = "median-chosen"
+	// EventKeysMoved: Keys moved from NodeID into the new right node TargetID
+	EventKeysMoved TraceEventType = "keys-moved"
+	// EventSeparatorPushed: median Key of NodeID went up into ParentID at position Index
+	EventSeparatorPushed TraceEventType = "separator-pushed"
+	// EventBorrowLeft: separator Key moved down from ParentID into NodeID and
+	// Separator moved up from the left sibling TargetID to replace it
+	EventBorrowLeft TraceEventType = "borrow-left"
+	// EventBorrowRight: as EventBorrowLeft, with the right sibling TargetID
+	EventBorrowRight TraceEventType = "borrow-right"
+	// EventMerged: separator Key from ParentID and the Keys of TargetID were
+	// appended to NodeID, and TargetID was removed
+	EventMerged TraceEventType = "merged"
+	// EventRedistributed: instead of splitting, Keys moved from the full node
+	// NodeID into its sibling TargetID through ParentID, whose separator at
+	// Index is now Separator
+	EventRedistributed TraceEventType = "redistributed"
+	// EventRootShrunk: the empty root TargetID was removed and NodeID became the root
+	EventRootShrunk TraceEventType = "root-shrunk"
+)
+
+// TraceEvent describes one structural change. Which fields are set depends on
+// the event type.
+type TraceEvent struct {
+	Type      TraceEventType `json:"type"`
+	NodeID    string         `json:"nodeId"`
+	TargetID  string         `json:"targetId,omitempty"`
+	ParentID  string         `json:"parentId,omitempty"`
+	Key       Key            `json:"key,omitempty"`
+	Separator Key            `json:"separator,omitempty"`
+	Keys      []Key          `json:"keys,omitempty"`
+	Index     int            `json:"index"`
+}
+
+// emit passes an event to the observer, if one is set
+func (bt *BTree) emit(event TraceEvent) {
+	if bt.Observer != nil {
+		bt.Observer(event)
+	}
+}
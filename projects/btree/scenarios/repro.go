@@ -0,0 +1,101 @@
+package scenarios
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ersantana/db-internals/projects/btree/internal"
+)
+
+// repros holds reproductions found by FuzzBTree in internal, kept as
+// regression lessons
+//
+//go:embed repros/*.repro
+var repros embed.FS
+
+// FromRepro turns the text form of a fuzz reproduction into a scenario for
+// the btree simulation. Leading # comment lines become the description.
+func FromRepro(id, text string) (Scenario, error) {
+	r, err := internal.ParseRepro(text)
+	if err != nil {
+		return Scenario{}, err
+	}
+
+	comments := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		comments = append(comments, strings.TrimSpace(strings.TrimPrefix(line, "#")))
+	}
+	description := strings.Join(comments, " ")
+	if description == "" {
+		description = "Replay an operation sequence found by the B-Tree fuzzer"
+	}
+
+	config := map[string]interface{}{"order": r.Order}
+	if r.Policy != internal.SplitMedian {
+		config["splitPolicy"] = string(r.Policy)
+	}
+	operations := make([]Operation, 0, len(r.Ops))
+	for _, op := range r.Ops {
+		params := map[string]interface{}{"key": op.Key}
+		if op.Type == internal.ReproRange {
+			params = map[string]interface{}{"start": op.Key, "end": op.End}
+		}
+		operations = append(operations, Operation{Type: op.Type, Params: params})
+	}
+
+	return Scenario{
+		ID:          id,
+		Name:        "Fuzz Repro: " + strings.ReplaceAll(strings.TrimPrefix(id, "repro-"), "-", " "),
+		Description: description,
+		Config:      config,
+		Operations:  operations,
+	}, nil
+}
+
+// LoadRepros returns a scenario for every embedded reproduction, with IDs
+// "repro-<file name>", and an error naming each reproduction that failed to
+// load
+func LoadRepros() ([]Scenario, error) {
+	entries, err := repros.ReadDir("repros")
+	if err != nil {
+		return nil, fmt.Errorf("reading repros: %w", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	scenarios := []Scenario{}
+	errs := []error{}
+	for _, name := range names {
+		text, err := repros.ReadFile(path.Join("repros", name))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("repro %s: %w", name, err))
+			continue
+		}
+		s, err := FromRepro("repro-"+strings.TrimSuffix(name, ".repro"), string(text))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("repro %s: %w", name, err))
+			continue
+		}
+		scenarios = append(scenarios, s)
+	}
+	return scenarios, errors.Join(errs...)
+}
+
+// ReproScenarios returns the embedded reproductions that load. FuzzBTree
+// replays every repro file and fails on one that does not parse, so a broken
+// reproduction cannot go unnoticed.
+func ReproScenarios() []Scenario {
+	scenarios, _ := LoadRepros()
+	return scenarios
+}
@@ -11,20 +11,33 @@ type Scenario struct {
 
 // Operation represents an operation to perform
 type Operation struct {
-	Type   string                 `json:"type"` // insert, search, delete, range
+	Type   string                 `json:"type"` // insert, search, delete, range, prefix, bulkload, scan, interleave, version, query, compare
 	Params map[string]interface{} `json:"params"`
 }
 
 // GetScenarios returns all available scenarios
 func GetScenarios() []Scenario {
-	return []Scenario{
+	scenarios := []Scenario{
 		BasicInsert(),
 		SplitDemo(),
 		SearchDemo(),
 		DeleteDemo(),
 		RangeQueryDemo(),
 		LargeTreeDemo(),
+		CompositeKeyDemo(),
+		StringKeyDemo(),
+		UniqueViolationDemo(),
+		DuplicateKeysDemo(),
+		BulkLoadDemo(),
+		DiskPagesDemo(),
+		CursorScanDemo(),
+		LatchCrabbingDemo(),
+		CopyOnWriteDemo(),
+		EmployeesIndexDemo(),
+		KeyCompressionDemo(),
+		SplitPolicyDemo(),
 	}
+	return append(scenarios, ReproScenarios()...)
 }
 
 // GetScenario returns a scenario by ID
@@ -155,3 +168,247 @@ func LargeTreeDemo() Scenario {
 		},
 	}
 }
+
+// CompositeKeyDemo demonstrates a multi-column index on employees (last_name, id)
+func CompositeKeyDemo() Scenario {
+	return Scenario{
+		ID:          "composite-key",
+		Name:        "Multi-Column Index",
+		Description: "Index employees on (last_name, id) and look up every employee with a given last name",
+		Config: map[string]interface{}{
+			"order":   4,
+			"keyType": "composite",
+			"initialKeys": []interface{}{
+				[]interface{}{"Garcia", 4},
+				[]interface{}{"Smith", 1},
+				[]interface{}{"Jones", 7},
+				[]interface{}{"Smith", 9},
+				[]interface{}{"Brown", 3},
+				[]interface{}{"Garcia", 2},
+				[]interface{}{"Smith", 5},
+			},
+		},
+		Operations: []Operation{
+			{Type: "insert", Params: map[string]interface{}{"key": []interface{}{"Jones", 6}}},
+			{Type: "search", Params: map[string]interface{}{"key": []interface{}{"Smith", 5}}},
+			{Type: "prefix", Params: map[string]interface{}{"prefix": []interface{}{"Smith"}}},
+			{Type: "range", Params: map[string]interface{}{"start": []interface{}{"Garcia"}, "end": []interface{}{"Jones", 100}}},
+		},
+	}
+}
+
+// StringKeyDemo demonstrates an index on text keys with a prefix lookup
+func StringKeyDemo() Scenario {
+	return Scenario{
+		ID:          "string-key",
+		Name:        "Text Keys",
+		Description: "Index employee names and find every name starting with a prefix",
+		Config: map[string]interface{}{
+			"order":       4,
+			"keyType":     "string",
+			"initialKeys": []interface{}{"maria", "mark", "alex", "zoe", "martin", "bob", "max"},
+		},
+		Operations: []Operation{
+			{Type: "search", Params: map[string]interface{}{"key": "martin"}},
+			{Type: "prefix", Params: map[string]interface{}{"prefix": "mar"}},
+			{Type: "delete", Params: map[string]interface{}{"key": "mark"}},
+		},
+	}
+}
+
+// UniqueViolationDemo demonstrates a unique index rejecting a duplicate key
+func UniqueViolationDemo() Scenario {
+	return Scenario{
+		ID:          "unique-violation",
+		Name:        "Unique Index",
+		Description: "A unique index rejects a second insert of an existing key",
+		Config: map[string]interface{}{
+			"order":       4,
+			"unique":      true,
+			"initialKeys": []int{10, 20, 30, 40},
+		},
+		Operations: []Operation{
+			{Type: "insert", Params: map[string]interface{}{"key": 30}},
+			{Type: "insert", Params: map[string]interface{}{"key": 35}},
+		},
+	}
+}
+
+// DuplicateKeysDemo demonstrates a non-unique index storing (key, rowid) entries
+func DuplicateKeysDemo() Scenario {
+	return Scenario{
+		ID:          "duplicate-keys",
+		Name:        "Non-Unique Index",
+		Description: "Duplicates are stored as (key, rowid) entries and can span node boundaries",
+		Config: map[string]interface{}{
+			"order":       4,
+			"unique":      false,
+			"initialKeys": []int{20, 10, 20, 30, 20, 20, 40, 20},
+		},
+		Operations: []Operation{
+			{Type: "search", Params: map[string]interface{}{"key": 20}},
+			{Type: "range", Params: map[string]interface{}{"start": 20, "end": 30}},
+			{Type: "delete", Params: map[string]interface{}{"key": 20}},
+			{Type: "insert", Params: map[string]interface{}{"key": 20}},
+		},
+	}
+}
+
+// BulkLoadDemo builds the same keys as LargeTreeDemo bottom-up in one pass
+func BulkLoadDemo() Scenario {
+	return Scenario{
+		ID:          "bulk-load",
+		Name:        "Bulk Loading",
+		Description: "Build a multi-level tree bottom-up from sorted keys, as CREATE INDEX does, and compare it with one-by-one inserts",
+		Config: map[string]interface{}{
+			"order": 4,
+		},
+		Operations: []Operation{
+			{Type: "bulkload", Params: map[string]interface{}{
+				"keys":       []int{5, 10, 15, 25, 27, 30, 35, 50, 55, 60, 65, 75, 80, 90, 95},
+				"fillFactor": 1.0,
+			}},
+		},
+	}
+}
+
+// DiskPagesDemo uses tiny pages so the disk B-Tree splits after a few keys
+func DiskPagesDemo() Scenario {
+	return Scenario{
+		ID:          "disk-pages",
+		Name:        "Disk Pages",
+		Description: "Run on the btree-disk simulation: 128-byte pages hold 9 integer keys, so splits and merges show up as page writes, allocations and frees",
+		Config: map[string]interface{}{
+			"pageSize":    128,
+			"keyType":     "int",
+			"initialKeys": []int{10, 20, 30, 40, 50, 60, 70, 80},
+		},
+		Operations: []Operation{
+			{Type: "insert", Params: map[string]interface{}{"key": 90}},
+			{Type: "insert", Params: map[string]interface{}{"key": 100}},
+			{Type: "search", Params: map[string]interface{}{"key": 70}},
+			{Type: "delete", Params: map[string]interface{}{"key": 100}},
+			{Type: "delete", Params: map[string]interface{}{"key": 90}},
+		},
+	}
+}
+
+// CursorScanDemo streams a range forwards and backwards with a cursor
+func CursorScanDemo() Scenario {
+	return Scenario{
+		ID:          "cursor-scan",
+		Name:        "Cursor Scans",
+		Description: "Move a cursor one key at a time across leaves and up through separators, in both directions",
+		Config: map[string]interface{}{
+			"order":       4,
+			"initialKeys": []int{10, 20, 30, 40, 50, 60, 70, 80, 90},
+		},
+		Operations: []Operation{
+			{Type: "scan", Params: map[string]interface{}{"start": 25, "end": 75}},
+			{Type: "scan", Params: map[string]interface{}{"start": 25, "end": 75, "reverse": true}},
+		},
+	}
+}
+
+// LatchCrabbingDemo interleaves a splitting insert with a search and an
+// optimistic insert that has to restart
+func LatchCrabbingDemo() Scenario {
+	return Scenario{
+		ID:          "latch-crabbing",
+		Name:        "Latch Crabbing",
+		Description: "Run on the btree-latching simulation: a pessimistic insert splits a full leaf while a search waits behind its write latches, and an optimistic insert restarts when the leaf it reaches is full",
+		Config: map[string]interface{}{
+			"order":       4,
+			"initialKeys": []int{10, 20, 30, 40, 50, 60, 70, 80, 90},
+		},
+		Operations: []Operation{
+			{Type: "interleave", Params: map[string]interface{}{
+				"operations": []map[string]interface{}{
+					{"type": "insert", "key": 95},
+					{"type": "search", "key": 90},
+					{"type": "optimistic-insert", "key": 85},
+					{"type": "optimistic-insert", "key": 88},
+					{"type": "delete", "key": 10},
+				},
+			}},
+		},
+	}
+}
+
+// CopyOnWriteDemo updates a persistent tree and reads an older version
+func CopyOnWriteDemo() Scenario {
+	return Scenario{
+		ID:          "copy-on-write",
+		Name:        "Copy-on-Write Versions",
+		Description: "Run on the btree-persistent simulation: each update copies one root-to-leaf path into a new version, shares the rest, and older versions stay readable",
+		Config: map[string]interface{}{
+			"order":       4,
+			"initialKeys": []int{10, 20, 30, 40, 50, 60, 70, 80, 90},
+		},
+		Operations: []Operation{
+			{Type: "insert", Params: map[string]interface{}{"key": 95}},
+			{Type: "delete", Params: map[string]interface{}{"key": 10}},
+			{Type: "search", Params: map[string]interface{}{"key": 10, "version": 9}},
+			{Type: "version", Params: map[string]interface{}{"version": 3}},
+		},
+	}
+}
+
+// EmployeesIndexDemo compares index and full scans on the lecture's employees table
+func EmployeesIndexDemo() Scenario {
+	return Scenario{
+		ID:          "employees-index",
+		Name:        "Employees Index Scans",
+		Description: "Run on the btree-employees simulation: look up employees by primary key and by name, counting index nodes and heap pages against a full scan. One-character names match hundreds of rows scattered over the heap, so each match costs its own page read",
+		Config: map[string]interface{}{
+			"rows":  100000,
+			"seed":  1,
+			"order": 64,
+		},
+		Operations: []Operation{
+			{Type: "query", Params: map[string]interface{}{"column": "id", "value": 4242}},
+			{Type: "query", Params: map[string]interface{}{"column": "name", "value": "caL"}},
+			{Type: "query", Params: map[string]interface{}{"column": "name", "value": "A"}},
+		},
+	}
+}
+
+// KeyCompressionDemo stores path-like keys with prefix compression and
+// suffix truncation, showing stored bytes against logical key bytes
+func KeyCompressionDemo() Scenario {
+	return Scenario{
+		ID:          "key-compression",
+		Name:        "Prefix and Suffix Compression",
+		Description: "Keys sharing a long prefix are stored once per node, a split promotes the shortest key next to the median, and internal keys are laid out as the shortest separator that still routes searches",
+		Config: map[string]interface{}{
+			"order":             5,
+			"keyType":           "string",
+			"prefixCompression": true,
+			"suffixTruncation":  true,
+			"initialKeys":       []interface{}{"/users/alexander", "/users/bo", "/users/christina", "/users/dominique"},
+		},
+		Operations: []Operation{
+			{Type: "insert", Params: map[string]interface{}{"key": "/users/eve"}},
+			{Type: "insert", Params: map[string]interface{}{"key": "/users/francesca"}},
+			{Type: "insert", Params: map[string]interface{}{"key": "/users/bartholomew"}},
+		},
+	}
+}
+
+// SplitPolicyDemo appends serial ids, as employees.sql does, under median and
+// rightmost splits
+func SplitPolicyDemo() Scenario {
+	return Scenario{
+		ID:          "split-policy",
+		Name:        "Split Policies",
+		Description: "Run on the btree-split-policy simulation: append ids 1 to 40 to two order-8 trees. Median splits leave every node half full, while rightmost splits keep 90% of the keys on the left, so the same rows need fewer, fuller nodes",
+		Config: map[string]interface{}{
+			"order":      8,
+			"policies":   []interface{}{"median", "rightmost"},
+			"fillFactor": 0.9,
+		},
+		Operations: []Operation{
+			{Type: "compare", Params: map[string]interface{}{"keys": []interface{}{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35, 36, 37, 38, 39, 40}}},
+		},
+	}
+}
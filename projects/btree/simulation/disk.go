@@ -0,0 +1,396 @@
+package simulation
+
+import (
+	"fmt"
+
+	"github.com/ersantana/db-internals/packages/protocol"
+	"github.com/ersantana/db-internals/packages/simulation/engine"
+	"github.com/ersantana/db-internals/projects/btree/internal"
+)
+
+// DiskBTreeSimulation visualizes a page-oriented B-Tree, showing which pages
+// each operation reads, writes, allocates and frees
+type DiskBTreeSimulation struct {
+	tree        *internal.DiskBTree
+	steps       []engine.Step
+	currentStep int
+	operation   string
+	keyKind     internal.KeyKind
+	pageSize    int
+	keyWidth    int
+	snapshots   []map[string]interface{} // Visualization data after each page access
+}
+
+// NewDiskBTreeSimulation creates a new disk B-Tree simulation
+func NewDiskBTreeSimulation() *DiskBTreeSimulation {
+	sim := &DiskBTreeSimulation{
+		keyKind:     internal.KindInt,
+		pageSize:    internal.PageSize4K,
+		steps:       make([]engine.Step, 0),
+		currentStep: -1,
+	}
+	sim.tree, _ = sim.newTree()
+	return sim
+}
+
+// Name returns the simulation name
+func (sim *DiskBTreeSimulation) Name() string {
+	return "Disk B-Tree"
+}
+
+// Description returns the simulation description
+func (sim *DiskBTreeSimulation) Description() string {
+	return "B-Tree stored in fixed-size pages, showing page numbers, bytes used and page I/O per operation"
+}
+
+// Initialize sets up the simulation with given config
+func (sim *DiskBTreeSimulation) Initialize(config map[string]interface{}) error {
+	sim.pageSize = internal.PageSize4K
+	if size, ok := config["pageSize"].(float64); ok {
+		sim.pageSize = int(size)
+	}
+	sim.keyWidth = 0
+	if width, ok := config["keyWidth"].(float64); ok {
+		sim.keyWidth = int(width)
+	}
+	sim.keyKind = internal.KindInt
+	if kind, ok := config["keyType"].(string); ok && kind != "" {
+		sim.keyKind = internal.KeyKind(kind)
+	}
+
+	tree, err := sim.newTree()
+	if err != nil {
+		return err
+	}
+	sim.tree = tree
+
+	// Pre-populate if specified
+	if values, ok := config["initialKeys"].([]interface{}); ok {
+		keys, err := internal.ParseKeys(sim.keyKind, values)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := sim.tree.Insert(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+	return nil
+}
+
+// Reset returns the simulation to initial state
+func (sim *DiskBTreeSimulation) Reset() error {
+	tree, err := sim.newTree()
+	if err != nil {
+		return err
+	}
+	sim.tree = tree
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+	return nil
+}
+
+// GenerateSteps returns all steps for current simulation
+func (sim *DiskBTreeSimulation) GenerateSteps() []engine.Step {
+	return sim.steps
+}
+
+// CurrentStep returns current step index
+func (sim *DiskBTreeSimulation) CurrentStep() int {
+	return sim.currentStep
+}
+
+// ExecuteStep executes a specific step
+func (sim *DiskBTreeSimulation) ExecuteStep(index int) engine.StepResult {
+	if index < 0 || index >= len(sim.steps) {
+		return engine.StepResult{
+			Success: false,
+			Error:   engine.ErrInvalidStepIndex,
+		}
+	}
+
+	sim.currentStep = index
+	step := sim.steps[index]
+
+	data := step.Data
+	if data == nil {
+		data = sim.GetVisualizationData()
+	}
+
+	return engine.StepResult{
+		Success:     true,
+		Highlights:  step.Highlights,
+		Data:        data,
+		Description: step.Description,
+	}
+}
+
+// CanStepForward returns true if can advance
+func (sim *DiskBTreeSimulation) CanStepForward() bool {
+	return sim.currentStep < len(sim.steps)-1
+}
+
+// CanStepBackward returns true if can go back
+func (sim *DiskBTreeSimulation) CanStepBackward() bool {
+	return sim.currentStep > 0
+}
+
+// GetState returns current tree state
+func (sim *DiskBTreeSimulation) GetState() interface{} {
+	pages, _ := sim.tree.Pages()
+	return map[string]interface{}{
+		"pageSize":    sim.tree.PageSize(),
+		"keyWidth":    sim.tree.KeyWidth,
+		"keyType":     sim.keyKind,
+		"order":       sim.tree.Order,
+		"root":        sim.tree.Root,
+		"pages":       pages,
+		"operation":   sim.operation,
+		"currentStep": sim.currentStep,
+		"totalSteps":  len(sim.steps),
+	}
+}
+
+// GetVisualizationData returns data for rendering. Nodes are keyed by page
+// number and carry the bytes they occupy in their page.
+func (sim *DiskBTreeSimulation) GetVisualizationData() map[string]interface{} {
+	pages, _ := sim.tree.Pages()
+	free, _ := sim.tree.FreePages()
+	pager := sim.tree.Pager()
+
+	nodes := make(map[string]interface{})
+	for _, page := range pages {
+		children := make([]string, len(page.Children))
+		for i, child := range page.Children {
+			children[i] = pageID(child)
+		}
+		node := map[string]interface{}{
+			"id":        pageID(page.Page),
+			"page":      page.Page,
+			"keys":      page.Keys,
+			"children":  children,
+			"isLeaf":    page.IsLeaf,
+			"bytesUsed": page.BytesUsed,
+			"pageSize":  page.PageSize,
+		}
+		if page.Parent != 0 {
+			node["parent"] = pageID(page.Parent)
+		}
+		nodes[pageID(page.Page)] = node
+	}
+
+	rootID := ""
+	if sim.tree.Root != 0 {
+		rootID = pageID(sim.tree.Root)
+	}
+
+	return map[string]interface{}{
+		"nodes":     nodes,
+		"rootId":    rootID,
+		"order":     sim.tree.Order,
+		"keyType":   sim.keyKind,
+		"keyWidth":  sim.tree.KeyWidth,
+		"pageSize":  sim.tree.PageSize(),
+		"pageCount": pager.PageCount,
+		"freePages": free,
+		"reads":     pager.Reads,
+		"writes":    pager.Writes,
+	}
+}
+
+// ParseKey converts an operation parameter into a key of the simulation's key kind
+func (sim *DiskBTreeSimulation) ParseKey(value interface{}) (internal.Key, error) {
+	return internal.ParseKey(sim.keyKind, value)
+}
+
+// PrepareInsert generates steps for an insert operation
+func (sim *DiskBTreeSimulation) PrepareInsert(key internal.Key) {
+	sim.begin("insert",
+		fmt.Sprintf("Insert %s", key),
+		fmt.Sprintf("Inserting key %s. Every node visited is a page read; every node changed is a page write", key))
+
+	err := sim.tree.Insert(key)
+	sim.addTraceSteps()
+	if err != nil {
+		sim.addStep("Insert Failed", fmt.Sprintf("Insert rejected: %v", err),
+			[]protocol.Highlight{{Type: "key", ID: key.String(), Color: "#ef4444", Animation: "shake"}}, sim.GetVisualizationData())
+		return
+	}
+	sim.addSummary(fmt.Sprintf("Key %s inserted", key), key)
+}
+
+// PrepareSearch generates steps for a search operation
+func (sim *DiskBTreeSimulation) PrepareSearch(key internal.Key) {
+	sim.begin("search",
+		fmt.Sprintf("Search %s", key),
+		fmt.Sprintf("Searching for key %s, reading one page per level", key))
+
+	page, index, found, err := sim.tree.Search(key)
+	sim.addTraceSteps()
+	switch {
+	case err != nil:
+		sim.addStep("Search Failed", err.Error(), []protocol.Highlight{}, sim.GetVisualizationData())
+	case found:
+		sim.addStep("Key Found",
+			fmt.Sprintf("Key %s found in page %d at slot %d", key, page, index),
+			[]protocol.Highlight{
+				{Type: "node", ID: pageID(page), Color: "#10b981", Animation: "pulse"},
+				{Type: "key", ID: key.String(), Color: "#10b981", Animation: "pulse"},
+			}, sim.GetVisualizationData())
+	default:
+		sim.addStep("Key Not Found",
+			fmt.Sprintf("Key %s does not exist in the tree", key),
+			[]protocol.Highlight{}, sim.GetVisualizationData())
+	}
+	sim.addSummary("Search complete", nil)
+}
+
+// PrepareDelete generates steps for a delete operation
+func (sim *DiskBTreeSimulation) PrepareDelete(key internal.Key) {
+	sim.begin("delete",
+		fmt.Sprintf("Delete %s", key),
+		fmt.Sprintf("Deleting key %s. Merges return emptied pages to the free list", key))
+
+	deleted, err := sim.tree.Delete(key)
+	sim.addTraceSteps()
+	switch {
+	case err != nil:
+		sim.addStep("Delete Failed", err.Error(), []protocol.Highlight{}, sim.GetVisualizationData())
+		return
+	case !deleted:
+		sim.addStep("Key Not Found",
+			fmt.Sprintf("Key %s does not exist in the tree", key),
+			[]protocol.Highlight{}, sim.GetVisualizationData())
+		return
+	}
+	sim.addSummary(fmt.Sprintf("Key %s deleted", key), nil)
+}
+
+// PrepareRangeSearch generates steps for a range query
+func (sim *DiskBTreeSimulation) PrepareRangeSearch(start, end internal.Key) {
+	sim.begin("range",
+		fmt.Sprintf("Range Query [%s, %s]", start, end),
+		fmt.Sprintf("Finding all keys between %s and %s", start, end))
+
+	results, err := sim.tree.RangeSearch(start, end)
+	sim.addTraceSteps()
+	if err != nil {
+		sim.addStep("Range Query Failed", err.Error(), []protocol.Highlight{}, sim.GetVisualizationData())
+		return
+	}
+	highlights := []protocol.Highlight{}
+	for _, key := range results {
+		highlights = append(highlights, protocol.Highlight{
+			Type: "key", ID: key.String(), Color: "#10b981", Animation: "pulse",
+		})
+	}
+	sim.addStep("Range Query Complete",
+		fmt.Sprintf("Found %d keys in range: %v", len(results), results),
+		highlights, sim.GetVisualizationData())
+	sim.addSummary("Range query complete", nil)
+}
+
+// begin resets the step list and page trace for a new operation
+func (sim *DiskBTreeSimulation) begin(operation, title, description string) {
+	sim.operation = operation
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+	pager := sim.tree.Pager()
+	pager.ResetTrace()
+	sim.snapshots = sim.snapshots[:0]
+	pager.OnAccess = func(internal.PageAccess) {
+		sim.snapshots = append(sim.snapshots, sim.GetVisualizationData())
+	}
+
+	sim.addStep(title,
+		fmt.Sprintf("%s (page size %d bytes, %d-byte keys, order %d)",
+			description, sim.tree.PageSize(), sim.tree.KeyWidth, sim.tree.Order),
+		[]protocol.Highlight{}, sim.GetVisualizationData())
+}
+
+// addTraceSteps adds one step per page access recorded by the pager
+func (sim *DiskBTreeSimulation) addTraceSteps() {
+	for i, access := range sim.tree.Pager().Trace {
+		snapshot := sim.snapshots[i]
+		if access.Page == 0 {
+			if access.Op != "write" {
+				continue
+			}
+			sim.addStep("Write Meta Page",
+				fmt.Sprintf("Page 0 updated: root is page %d, free list head is page %d", sim.tree.Root, sim.tree.FreeHead),
+				[]protocol.Highlight{}, snapshot)
+			continue
+		}
+
+		id := pageID(access.Page)
+		switch access.Op {
+		case "read":
+			sim.addStep(fmt.Sprintf("Read Page %d", access.Page),
+				fmt.Sprintf("Load page %d from the file (%d bytes)", access.Page, sim.tree.PageSize()),
+				[]protocol.Highlight{{Type: "node", ID: id, Color: "#3b82f6", Animation: "pulse"}}, snapshot)
+		case "write":
+			sim.addStep(fmt.Sprintf("Write Page %d", access.Page),
+				fmt.Sprintf("Write page %d: %d keys, %d of %d bytes used",
+					access.Page, access.Keys, access.BytesUsed, sim.tree.PageSize()),
+				[]protocol.Highlight{{Type: "node", ID: id, Color: "#f59e0b", Animation: "pulse"}}, snapshot)
+		case "alloc":
+			sim.addStep(fmt.Sprintf("Allocate Page %d", access.Page),
+				fmt.Sprintf("Page %d allocated for a new node", access.Page),
+				[]protocol.Highlight{{Type: "node", ID: id, Color: "#10b981", Animation: "fadeIn"}}, snapshot)
+		case "free":
+			sim.addStep(fmt.Sprintf("Free Page %d", access.Page),
+				fmt.Sprintf("Page %d emptied by a merge and pushed onto the free list", access.Page),
+				[]protocol.Highlight{}, snapshot)
+		}
+	}
+}
+
+// addSummary closes an operation with its page I/O totals
+func (sim *DiskBTreeSimulation) addSummary(title string, key internal.Key) {
+	reads, writes := 0, 0
+	for _, access := range sim.tree.Pager().Trace {
+		switch access.Op {
+		case "read":
+			reads++
+		case "write":
+			writes++
+		}
+	}
+	highlights := []protocol.Highlight{}
+	if key != nil {
+		highlights = append(highlights, protocol.Highlight{
+			Type: "key", ID: key.String(), Color: "#10b981", Animation: "pulse",
+		})
+	}
+	sim.addStep(title,
+		fmt.Sprintf("%d page reads, %d page writes. The file holds %d pages", reads, writes, sim.tree.Pager().PageCount),
+		highlights, sim.GetVisualizationData())
+}
+
+func (sim *DiskBTreeSimulation) newTree() (*internal.DiskBTree, error) {
+	pager, err := internal.NewPager(internal.NewMemoryFile(), sim.pageSize, 0)
+	if err != nil {
+		return nil, err
+	}
+	return internal.CreateDiskBTree(pager, sim.keyKind, sim.keyWidth)
+}
+
+func (sim *DiskBTreeSimulation) addStep(title, description string, highlights []protocol.Highlight, data map[string]interface{}) {
+	step := engine.Step{
+		Index:       len(sim.steps),
+		Title:       title,
+		Description: description,
+		Highlights:  highlights,
+		Data:        data,
+	}
+	sim.steps = append(sim.steps, step)
+}
+
+// pageID is the node ID used for a page in visualizations
+func pageID(page uint32) string {
+	return fmt.Sprintf("page-%d", page)
+}
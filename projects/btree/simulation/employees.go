@@ -0,0 +1,285 @@
+package simulation
+
+import (
+	"fmt"
+
+	"github.com/ersantana/db-internals/packages/protocol"
+	"github.com/ersantana/db-internals/packages/simulation/engine"
+	"github.com/ersantana/db-internals/projects/btree/internal"
+)
+
+// EmployeesSimulation loads the employees table from employees.sql and
+// compares index scans against full table scans
+type EmployeesSimulation struct {
+	table       *internal.EmployeesTable
+	steps       []engine.Step
+	currentStep int
+	operation   string
+	seed        int64
+	rows        int
+	order       int
+}
+
+// NewEmployeesSimulation creates a new employees index simulation
+func NewEmployeesSimulation() *EmployeesSimulation {
+	sim := &EmployeesSimulation{
+		seed:        1,
+		rows:        10000,
+		order:       64,
+		steps:       make([]engine.Step, 0),
+		currentStep: -1,
+	}
+	sim.table, _ = internal.LoadEmployees(sim.seed, sim.rows, sim.order)
+	return sim
+}
+
+// Name returns the simulation name
+func (sim *EmployeesSimulation) Name() string {
+	return "Employees Secondary Index"
+}
+
+// Description returns the simulation description
+func (sim *EmployeesSimulation) Description() string {
+	return "Index scan vs full scan over the employees(id, name) table, counting index nodes and heap pages read"
+}
+
+// Initialize sets up the simulation with given config. rows defaults to
+// 10,000; the lecture's full table is internal.EmployeesRows.
+func (sim *EmployeesSimulation) Initialize(config map[string]interface{}) error {
+	sim.seed = 1
+	if seed, ok := config["seed"].(float64); ok {
+		sim.seed = int64(seed)
+	}
+	sim.rows = 10000
+	if rows, ok := config["rows"].(float64); ok {
+		if rows < 0 {
+			return fmt.Errorf("rows must not be negative, got %v", rows)
+		}
+		sim.rows = int(rows)
+	}
+	sim.order = 64
+	if o, ok := config["order"].(float64); ok {
+		sim.order = int(o)
+	}
+	return sim.Reset()
+}
+
+// Reset returns the simulation to initial state
+func (sim *EmployeesSimulation) Reset() error {
+	table, err := internal.LoadEmployees(sim.seed, sim.rows, sim.order)
+	if err != nil {
+		return err
+	}
+	sim.table = table
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+	return nil
+}
+
+// GenerateSteps returns all steps for current simulation
+func (sim *EmployeesSimulation) GenerateSteps() []engine.Step {
+	return sim.steps
+}
+
+// CurrentStep returns current step index
+func (sim *EmployeesSimulation) CurrentStep() int {
+	return sim.currentStep
+}
+
+// ExecuteStep executes a specific step
+func (sim *EmployeesSimulation) ExecuteStep(index int) engine.StepResult {
+	if index < 0 || index >= len(sim.steps) {
+		return engine.StepResult{
+			Success: false,
+			Error:   engine.ErrInvalidStepIndex,
+		}
+	}
+
+	sim.currentStep = index
+	step := sim.steps[index]
+
+	data := step.Data
+	if data == nil {
+		data = sim.GetVisualizationData()
+	}
+
+	return engine.StepResult{
+		Success:     true,
+		Highlights:  step.Highlights,
+		Data:        data,
+		Description: step.Description,
+	}
+}
+
+// CanStepForward returns true if can advance
+func (sim *EmployeesSimulation) CanStepForward() bool {
+	return sim.currentStep < len(sim.steps)-1
+}
+
+// CanStepBackward returns true if can go back
+func (sim *EmployeesSimulation) CanStepBackward() bool {
+	return sim.currentStep > 0
+}
+
+// GetState returns current table state
+func (sim *EmployeesSimulation) GetState() interface{} {
+	return map[string]interface{}{
+		"table":       sim.tableData(),
+		"operation":   sim.operation,
+		"currentStep": sim.currentStep,
+		"totalSteps":  len(sim.steps),
+	}
+}
+
+// GetVisualizationData returns the table and index shapes. The indexes are
+// too large to draw whole, so queries add only the nodes they visit.
+func (sim *EmployeesSimulation) GetVisualizationData() map[string]interface{} {
+	return map[string]interface{}{
+		"table": sim.tableData(),
+	}
+}
+
+// PrepareQuery generates steps for SELECT * FROM employees WHERE column = value,
+// run once through the column's index and once as a full scan
+func (sim *EmployeesSimulation) PrepareQuery(column string, value interface{}) error {
+	var kind internal.KeyKind = internal.KindInt
+	if column == "name" {
+		kind = internal.KindString
+	}
+	key, err := internal.ParseKey(kind, value)
+	if err != nil {
+		return err
+	}
+	index, err := sim.table.Index(column)
+	if err != nil {
+		return err
+	}
+
+	sim.operation = "query"
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+	query := fmt.Sprintf("SELECT * FROM employees WHERE %s = '%s'", column, key)
+	sim.addStep("Query", fmt.Sprintf("%s on %d rows in %d heap pages", query, sim.table.Rows, len(sim.table.Heap)),
+		[]protocol.Highlight{}, sim.GetVisualizationData())
+
+	indexScan, err := sim.table.IndexScan(column, key)
+	if err != nil {
+		return err
+	}
+	seqScan, err := sim.table.SeqScan(column, key)
+	if err != nil {
+		return err
+	}
+
+	// Index scan: descend, walk matching entries, fetch rows
+	path := index.Cursor()
+	path.Seek(key)
+	visited := []map[string]interface{}{}
+	nodeIDs := path.Path()
+	for depth, nodeID := range nodeIDs {
+		node := index.Nodes[nodeID]
+		visited = append(visited, map[string]interface{}{
+			"id":     node.ID,
+			"keys":   node.Keys,
+			"isLeaf": node.IsLeaf,
+		})
+		description := fmt.Sprintf("Read %s %s (%d keys) and follow the child whose range holds %s",
+			levelName(depth, node.IsLeaf), nodeID, len(node.Keys), key)
+		if depth == len(nodeIDs)-1 {
+			description = fmt.Sprintf("Read %s %s (%d keys) and position on the first entry >= %s",
+				levelName(depth, node.IsLeaf), nodeID, len(node.Keys), key)
+		}
+		sim.addStep(fmt.Sprintf("Index Scan: Read %s", nodeID), description,
+			[]protocol.Highlight{{Type: "node", ID: nodeID, Color: "#3b82f6", Animation: "pulse"}},
+			sim.queryData(query, visited, &indexScan, nil))
+	}
+
+	entries := fmt.Sprintf("%d matching entries", len(indexScan.Rows))
+	if len(indexScan.Rows) == 1 {
+		entries = "1 matching entry"
+	}
+	sim.addStep("Index Scan: Walk Entries",
+		fmt.Sprintf("Following the cursor through %s touched %d index nodes in total; each entry carries the tuple ID of its row",
+			entries, len(indexScan.IndexNodes)),
+		[]protocol.Highlight{}, sim.queryData(query, visited, &indexScan, nil))
+	sim.addStep("Index Scan: Fetch Rows",
+		fmt.Sprintf("Fetched %d rows from %d heap pages: %d page reads in total, %d index and %d heap",
+			len(indexScan.Rows), len(indexScan.HeapPages),
+			len(indexScan.IndexNodes)+len(indexScan.HeapPages), len(indexScan.IndexNodes), len(indexScan.HeapPages)),
+		rowHighlights(indexScan.Rows), sim.queryData(query, visited, &indexScan, nil))
+
+	sim.addStep("Full Scan",
+		fmt.Sprintf("Without the index, all %d heap pages are read and %d rows compared to find the same %d rows",
+			len(seqScan.HeapPages), seqScan.RowsExamined, len(seqScan.Rows)),
+		rowHighlights(seqScan.Rows), sim.queryData(query, visited, &indexScan, &seqScan))
+
+	indexReads := len(indexScan.IndexNodes) + len(indexScan.HeapPages)
+	verdict := fmt.Sprintf("The index scan reads %d pages against %d for the full scan", indexReads, len(seqScan.HeapPages))
+	if indexReads >= len(seqScan.HeapPages) {
+		verdict += ". The value matches so many rows spread over the heap that the full scan is cheaper, which is why planners fall back to it for unselective predicates"
+	}
+	sim.addStep("Comparison", verdict, []protocol.Highlight{}, sim.queryData(query, visited, &indexScan, &seqScan))
+	return nil
+}
+
+func (sim *EmployeesSimulation) tableData() map[string]interface{} {
+	return map[string]interface{}{
+		"rows":        sim.table.Rows,
+		"heapPages":   len(sim.table.Heap),
+		"rowsPerPage": internal.HeapRowsPerPage,
+		"order":       sim.order,
+		"seed":        sim.seed,
+		"indexes": map[string]interface{}{
+			"employees_pkey": sim.table.Primary.Stats(),
+			"employees_name": sim.table.ByName.Stats(),
+		},
+	}
+}
+
+func (sim *EmployeesSimulation) queryData(query string, path []map[string]interface{}, indexScan, seqScan *internal.ScanResult) map[string]interface{} {
+	data := map[string]interface{}{
+		"table":     sim.tableData(),
+		"query":     query,
+		"path":      append([]map[string]interface{}(nil), path...),
+		"indexScan": indexScan,
+	}
+	if seqScan != nil {
+		data["seqScan"] = map[string]interface{}{
+			"rows":         seqScan.Rows,
+			"heapPages":    len(seqScan.HeapPages),
+			"rowsExamined": seqScan.RowsExamined,
+		}
+	}
+	return data
+}
+
+func (sim *EmployeesSimulation) addStep(title, description string, highlights []protocol.Highlight, data map[string]interface{}) {
+	step := engine.Step{
+		Index:       len(sim.steps),
+		Title:       title,
+		Description: description,
+		Highlights:  highlights,
+		Data:        data,
+	}
+	sim.steps = append(sim.steps, step)
+}
+
+func levelName(depth int, leaf bool) string {
+	switch {
+	case leaf:
+		return "leaf"
+	case depth == 0:
+		return "root"
+	}
+	return "internal"
+}
+
+func rowHighlights(rows []internal.Employee) []protocol.Highlight {
+	highlights := []protocol.Highlight{}
+	for _, row := range rows {
+		highlights = append(highlights, protocol.Highlight{
+			Type: "key", ID: fmt.Sprintf("%d", row.ID), Color: "#10b981", Animation: "pulse",
+		})
+	}
+	return highlights
+}
@@ -0,0 +1,319 @@
+package simulation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ersantana/db-internals/packages/protocol"
+	"github.com/ersantana/db-internals/packages/simulation/engine"
+	"github.com/ersantana/db-internals/projects/btree/internal"
+)
+
+// LatchOperation is one logical operation run by an interleaved simulation.
+// Type is insert, delete, search, optimistic-insert or optimistic-delete.
+type LatchOperation struct {
+	Type string       `json:"type"`
+	Key  internal.Key `json:"key"`
+}
+
+// opColors tells concurrent operations apart in highlights
+var opColors = []string{"#3b82f6", "#f59e0b", "#8b5cf6", "#10b981", "#ec4899", "#14b8a6"}
+
+// ConcurrentBTreeSimulation interleaves several operations on a concurrent
+// B-Tree and shows the latches each one holds at every step
+type ConcurrentBTreeSimulation struct {
+	tree        *internal.ConcurrentBTree
+	steps       []engine.Step
+	currentStep int
+	operation   string
+	order       int
+	initialKeys []internal.Key
+}
+
+// NewConcurrentBTreeSimulation creates a new latch crabbing simulation
+func NewConcurrentBTreeSimulation() *ConcurrentBTreeSimulation {
+	return &ConcurrentBTreeSimulation{
+		tree:        internal.NewConcurrentBTree(4),
+		order:       4,
+		steps:       make([]engine.Step, 0),
+		currentStep: -1,
+	}
+}
+
+// Name returns the simulation name
+func (sim *ConcurrentBTreeSimulation) Name() string {
+	return "B-Tree Latch Crabbing"
+}
+
+// Description returns the simulation description
+func (sim *ConcurrentBTreeSimulation) Description() string {
+	return "Concurrent B-Tree operations interleaved one latch at a time, showing the latches each operation holds"
+}
+
+// Initialize sets up the simulation with given config
+func (sim *ConcurrentBTreeSimulation) Initialize(config map[string]interface{}) error {
+	sim.order = 4
+	if o, ok := config["order"].(float64); ok {
+		sim.order = int(o)
+	}
+
+	sim.initialKeys = nil
+	if values, ok := config["initialKeys"].([]interface{}); ok {
+		keys, err := internal.ParseKeys(internal.KindInt, values)
+		if err != nil {
+			return err
+		}
+		sim.initialKeys = keys
+	}
+	return sim.Reset()
+}
+
+// Reset returns the simulation to initial state
+func (sim *ConcurrentBTreeSimulation) Reset() error {
+	sim.tree = internal.NewConcurrentBTree(sim.order)
+	for _, key := range sim.initialKeys {
+		if err := sim.tree.Insert(key); err != nil {
+			return err
+		}
+	}
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+	return nil
+}
+
+// GenerateSteps returns all steps for current simulation
+func (sim *ConcurrentBTreeSimulation) GenerateSteps() []engine.Step {
+	return sim.steps
+}
+
+// CurrentStep returns current step index
+func (sim *ConcurrentBTreeSimulation) CurrentStep() int {
+	return sim.currentStep
+}
+
+// ExecuteStep executes a specific step
+func (sim *ConcurrentBTreeSimulation) ExecuteStep(index int) engine.StepResult {
+	if index < 0 || index >= len(sim.steps) {
+		return engine.StepResult{
+			Success: false,
+			Error:   engine.ErrInvalidStepIndex,
+		}
+	}
+
+	sim.currentStep = index
+	step := sim.steps[index]
+
+	data := step.Data
+	if data == nil {
+		data = sim.GetVisualizationData()
+	}
+
+	return engine.StepResult{
+		Success:     true,
+		Highlights:  step.Highlights,
+		Data:        data,
+		Description: step.Description,
+	}
+}
+
+// CanStepForward returns true if can advance
+func (sim *ConcurrentBTreeSimulation) CanStepForward() bool {
+	return sim.currentStep < len(sim.steps)-1
+}
+
+// CanStepBackward returns true if can go back
+func (sim *ConcurrentBTreeSimulation) CanStepBackward() bool {
+	return sim.currentStep > 0
+}
+
+// GetState returns current tree state
+func (sim *ConcurrentBTreeSimulation) GetState() interface{} {
+	return map[string]interface{}{
+		"tree":        sim.tree.Snapshot(),
+		"operation":   sim.operation,
+		"currentStep": sim.currentStep,
+		"totalSteps":  len(sim.steps),
+	}
+}
+
+// GetVisualizationData returns data for rendering with no latches held
+func (sim *ConcurrentBTreeSimulation) GetVisualizationData() map[string]interface{} {
+	return sim.snapshotData(nil, nil)
+}
+
+// ParseKey converts an operation parameter into a key
+func (sim *ConcurrentBTreeSimulation) ParseKey(value interface{}) (internal.Key, error) {
+	return internal.ParseKey(internal.KindInt, value)
+}
+
+// PrepareInterleaved runs the operations concurrently, advancing them
+// round-robin one latch event at a time, and records a step per event
+func (sim *ConcurrentBTreeSimulation) PrepareInterleaved(operations []LatchOperation) {
+	sim.operation = "interleave"
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+
+	labels := make([]string, len(operations))
+	descriptions := make([]string, len(operations))
+	results := make([]string, len(operations))
+	tasks := make([]func(*internal.LatchOp), len(operations))
+	for i, operation := range operations {
+		i, operation := i, operation
+		descriptions[i] = fmt.Sprintf("%s %s", operation.Type, operation.Key)
+		labels[i] = fmt.Sprintf("Op %d (%s)", i+1, descriptions[i])
+		tasks[i] = func(op *internal.LatchOp) {
+			results[i] = runLatchOperation(op, operation)
+		}
+	}
+
+	sim.addStep("Start Interleaved Operations",
+		fmt.Sprintf("Running %s concurrently on an order %d tree. Each turn one operation takes, releases or waits for a single latch",
+			strings.Join(descriptions, ", "), sim.tree.Order),
+		[]protocol.Highlight{}, sim.GetVisualizationData())
+
+	lastWait := make(map[int]string)
+	sim.tree.Interleave(tasks, func(event internal.LatchEvent, ops []*internal.LatchOp) {
+		// A blocked operation polls every turn; show only its first wait
+		if event.Action == internal.ActionWait {
+			if lastWait[event.Op] == event.NodeID {
+				return
+			}
+			lastWait[event.Op] = event.NodeID
+		} else {
+			delete(lastWait, event.Op)
+		}
+		for i, op := range ops {
+			if op.ID == event.Op {
+				sim.addLatchStep(event, labels[i], opColors[i%len(opColors)], sim.snapshotData(ops, labels))
+			}
+		}
+	})
+
+	for i := range operations {
+		results[i] = fmt.Sprintf("%s: %s", descriptions[i], results[i])
+	}
+	snapshot := sim.tree.Snapshot()
+	violations := 0
+	for _, check := range snapshot.CheckInvariants() {
+		violations += len(check.Violations)
+	}
+	sim.addStep("Operations Complete",
+		fmt.Sprintf("%s. All latches released; %d invariant violations", strings.Join(results, "; "), violations),
+		[]protocol.Highlight{}, sim.GetVisualizationData())
+}
+
+// runLatchOperation runs one operation and describes its outcome
+func runLatchOperation(op *internal.LatchOp, operation LatchOperation) string {
+	var err error
+	switch operation.Type {
+	case "insert":
+		err = op.Insert(operation.Key)
+	case "optimistic-insert":
+		err = op.OptimisticInsert(operation.Key)
+	case "delete":
+		return deleteOutcome(op.Delete(operation.Key))
+	case "optimistic-delete":
+		return deleteOutcome(op.OptimisticDelete(operation.Key))
+	case "search":
+		if op.Search(operation.Key) {
+			return "found"
+		}
+		return "not found"
+	default:
+		return fmt.Sprintf("unknown operation %q", operation.Type)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return "inserted"
+}
+
+func deleteOutcome(deleted bool) string {
+	if deleted {
+		return "deleted"
+	}
+	return "not found"
+}
+
+// addLatchStep records one latch event
+func (sim *ConcurrentBTreeSimulation) addLatchStep(event internal.LatchEvent, label, color string, data map[string]interface{}) {
+	highlights := []protocol.Highlight{}
+	if event.NodeID != "" && event.NodeID != internal.RootLatchID {
+		highlights = append(highlights, protocol.Highlight{Type: "node", ID: event.NodeID, Color: color, Animation: "pulse"})
+	}
+	target := event.NodeID
+	if target == internal.RootLatchID {
+		target = "the root pointer"
+	}
+
+	switch event.Action {
+	case internal.ActionAcquire:
+		sim.addStep(fmt.Sprintf("%s: Acquire %s Latch", label, latchModeTitle(event.Mode)),
+			fmt.Sprintf("%s takes a %s latch on %s", label, event.Mode, target), highlights, data)
+	case internal.ActionRelease:
+		sim.addStep(fmt.Sprintf("%s: Release %s Latch", label, latchModeTitle(event.Mode)),
+			fmt.Sprintf("%s releases its %s latch on %s", label, event.Mode, target), []protocol.Highlight{}, data)
+	case internal.ActionWait:
+		for i := range highlights {
+			highlights[i].Animation = "shake"
+		}
+		sim.addStep(fmt.Sprintf("%s: Wait", label),
+			fmt.Sprintf("%s needs a %s latch on %s, which another operation holds in a conflicting mode", label, event.Mode, target),
+			highlights, data)
+	case internal.ActionModify:
+		sim.addStep(fmt.Sprintf("%s: %s", label, strings.ToUpper(event.Detail[:1])+event.Detail[1:]),
+			fmt.Sprintf("%s, holding %s: %s", label, event.NodeID, event.Detail), highlights, data)
+	case internal.ActionRestart:
+		sim.addStep(fmt.Sprintf("%s: Restart", label),
+			fmt.Sprintf("%s gives up its optimistic attempt (%s) and restarts with write latch crabbing from the root", label, event.Detail),
+			highlights, data)
+	case internal.ActionDone:
+		sim.addStep(fmt.Sprintf("%s: Done", label),
+			fmt.Sprintf("%s finished and holds no latches", label), highlights, data)
+	}
+}
+
+// snapshotData copies the tree and the latches held by each operation
+func (sim *ConcurrentBTreeSimulation) snapshotData(ops []*internal.LatchOp, labels []string) map[string]interface{} {
+	tree := sim.tree.Snapshot()
+	nodes := make(map[string]interface{})
+	for id, node := range tree.Nodes {
+		nodes[id] = map[string]interface{}{
+			"id":       node.ID,
+			"keys":     node.Keys,
+			"children": node.Children,
+			"isLeaf":   node.IsLeaf,
+			"parent":   node.Parent,
+		}
+	}
+
+	latches := make(map[string][]internal.HeldLatch)
+	for i, op := range ops {
+		latches[labels[i]] = op.Held()
+	}
+	return map[string]interface{}{
+		"nodes":   nodes,
+		"rootId":  tree.RootID,
+		"order":   tree.Order,
+		"keyType": internal.KindInt,
+		"latches": latches,
+	}
+}
+
+func (sim *ConcurrentBTreeSimulation) addStep(title, description string, highlights []protocol.Highlight, data map[string]interface{}) {
+	step := engine.Step{
+		Index:       len(sim.steps),
+		Title:       title,
+		Description: description,
+		Highlights:  highlights,
+		Data:        data,
+	}
+	sim.steps = append(sim.steps, step)
+}
+
+func latchModeTitle(mode internal.LatchMode) string {
+	if mode == internal.LatchWrite {
+		return "Write"
+	}
+	return "Read"
+}
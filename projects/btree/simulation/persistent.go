@@ -0,0 +1,360 @@
+package simulation
+
+import (
+	"fmt"
+
+	"github.com/ersantana/db-internals/packages/protocol"
+	"github.com/ersantana/db-internals/packages/simulation/engine"
+	"github.com/ersantana/db-internals/projects/btree/internal"
+)
+
+// PersistentBTreeSimulation visualizes a copy-on-write B-Tree, showing which
+// nodes an update copies and which it shares with the previous version
+type PersistentBTreeSimulation struct {
+	tree        *internal.PersistentBTree
+	steps       []engine.Step
+	currentStep int
+	operation   string
+	order       int
+	initialKeys []internal.Key
+}
+
+// NewPersistentBTreeSimulation creates a new copy-on-write B-Tree simulation
+func NewPersistentBTreeSimulation() *PersistentBTreeSimulation {
+	return &PersistentBTreeSimulation{
+		tree:        internal.NewPersistentBTree(4),
+		order:       4,
+		steps:       make([]engine.Step, 0),
+		currentStep: -1,
+	}
+}
+
+// Name returns the simulation name
+func (sim *PersistentBTreeSimulation) Name() string {
+	return "Copy-on-Write B-Tree"
+}
+
+// Description returns the simulation description
+func (sim *PersistentBTreeSimulation) Description() string {
+	return "Persistent B-Tree where each update copies one root-to-leaf path and older versions stay readable"
+}
+
+// Initialize sets up the simulation with given config
+func (sim *PersistentBTreeSimulation) Initialize(config map[string]interface{}) error {
+	sim.order = 4
+	if o, ok := config["order"].(float64); ok {
+		sim.order = int(o)
+	}
+
+	sim.initialKeys = nil
+	if values, ok := config["initialKeys"].([]interface{}); ok {
+		keys, err := internal.ParseKeys(internal.KindInt, values)
+		if err != nil {
+			return err
+		}
+		sim.initialKeys = keys
+	}
+	return sim.Reset()
+}
+
+// Reset returns the simulation to initial state. Each initial key is its own
+// version, so there is history to look back at from the start.
+func (sim *PersistentBTreeSimulation) Reset() error {
+	sim.tree = internal.NewPersistentBTree(sim.order)
+	for _, key := range sim.initialKeys {
+		if _, err := sim.tree.Insert(key); err != nil {
+			return err
+		}
+	}
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+	return nil
+}
+
+// GenerateSteps returns all steps for current simulation
+func (sim *PersistentBTreeSimulation) GenerateSteps() []engine.Step {
+	return sim.steps
+}
+
+// CurrentStep returns current step index
+func (sim *PersistentBTreeSimulation) CurrentStep() int {
+	return sim.currentStep
+}
+
+// ExecuteStep executes a specific step
+func (sim *PersistentBTreeSimulation) ExecuteStep(index int) engine.StepResult {
+	if index < 0 || index >= len(sim.steps) {
+		return engine.StepResult{
+			Success: false,
+			Error:   engine.ErrInvalidStepIndex,
+		}
+	}
+
+	sim.currentStep = index
+	step := sim.steps[index]
+
+	data := step.Data
+	if data == nil {
+		data = sim.GetVisualizationData()
+	}
+
+	return engine.StepResult{
+		Success:     true,
+		Highlights:  step.Highlights,
+		Data:        data,
+		Description: step.Description,
+	}
+}
+
+// CanStepForward returns true if can advance
+func (sim *PersistentBTreeSimulation) CanStepForward() bool {
+	return sim.currentStep < len(sim.steps)-1
+}
+
+// CanStepBackward returns true if can go back
+func (sim *PersistentBTreeSimulation) CanStepBackward() bool {
+	return sim.currentStep > 0
+}
+
+// GetState returns current tree state
+func (sim *PersistentBTreeSimulation) GetState() interface{} {
+	return map[string]interface{}{
+		"latest":      sim.tree.Latest(),
+		"versions":    sim.tree.Versions(),
+		"operation":   sim.operation,
+		"currentStep": sim.currentStep,
+		"totalSteps":  len(sim.steps),
+	}
+}
+
+// GetVisualizationData returns data for rendering the latest version
+func (sim *PersistentBTreeSimulation) GetVisualizationData() map[string]interface{} {
+	return sim.versionData(sim.tree.Latest())
+}
+
+// ParseKey converts an operation parameter into a key
+func (sim *PersistentBTreeSimulation) ParseKey(value interface{}) (internal.Key, error) {
+	return internal.ParseKey(internal.KindInt, value)
+}
+
+// PrepareInsert generates steps for an insert that creates a new version
+func (sim *PersistentBTreeSimulation) PrepareInsert(key internal.Key) {
+	sim.begin("insert")
+	previous := sim.tree.Latest()
+	sim.addStep(fmt.Sprintf("Insert %s", key),
+		fmt.Sprintf("Inserting key %s on top of version %d. Nodes are never changed in place; the insert copies the path it modifies", key, previous),
+		[]protocol.Highlight{}, sim.versionData(previous))
+
+	version, err := sim.tree.Insert(key)
+	if err != nil {
+		sim.addStep("Insert Failed", fmt.Sprintf("Insert rejected: %v. No version was created", err),
+			[]protocol.Highlight{{Type: "key", ID: key.String(), Color: "#ef4444", Animation: "shake"}}, sim.versionData(previous))
+		return
+	}
+	sim.addVersionSteps(previous, version)
+}
+
+// PrepareDelete generates steps for a delete that creates a new version
+func (sim *PersistentBTreeSimulation) PrepareDelete(key internal.Key) {
+	sim.begin("delete")
+	previous := sim.tree.Latest()
+	sim.addStep(fmt.Sprintf("Delete %s", key),
+		fmt.Sprintf("Deleting key %s on top of version %d. Nodes are never changed in place; the delete copies the path it modifies and any sibling it borrows from or merges with", key, previous),
+		[]protocol.Highlight{}, sim.versionData(previous))
+
+	version, deleted := sim.tree.Delete(key)
+	if !deleted {
+		sim.addStep("Key Not Found",
+			fmt.Sprintf("Key %s does not exist in version %d. No version was created", key, previous),
+			[]protocol.Highlight{}, sim.versionData(previous))
+		return
+	}
+	sim.addVersionSteps(previous, version)
+}
+
+// PrepareSearch generates steps for a search in the given version, which may
+// be older than the latest one
+func (sim *PersistentBTreeSimulation) PrepareSearch(key internal.Key, version int) {
+	sim.begin("search")
+	if version < 0 {
+		version = sim.tree.Latest()
+	}
+	snapshot, err := sim.tree.Snapshot(version)
+	if err != nil {
+		sim.addStep("Search Failed", err.Error(), []protocol.Highlight{}, sim.GetVisualizationData())
+		return
+	}
+
+	sim.addStep(fmt.Sprintf("Search %s in Version %d", key, version),
+		fmt.Sprintf("Reading from the root of version %d (%s). Later updates copied their own paths, so this root still sees the tree as it was",
+			version, rootName(snapshot.RootID)),
+		[]protocol.Highlight{}, sim.versionData(version))
+
+	nodeID := snapshot.RootID
+	for nodeID != "" {
+		node := snapshot.Nodes[nodeID]
+		i := 0
+		for i < len(node.Keys) && key.Compare(node.Keys[i]) > 0 {
+			i++
+		}
+		if i < len(node.Keys) && node.Keys[i].Compare(key) == 0 {
+			sim.addStep("Key Found",
+				fmt.Sprintf("Key %s found in %s of version %d", key, nodeID, version),
+				[]protocol.Highlight{
+					{Type: "node", ID: nodeID, Color: "#10b981", Animation: "pulse"},
+					{Type: "key", ID: key.String(), Color: "#10b981", Animation: "pulse"},
+				}, sim.versionData(version))
+			return
+		}
+		sim.addStep(fmt.Sprintf("Visit %s", nodeID),
+			fmt.Sprintf("Node %s holds %v", nodeID, node.Keys),
+			[]protocol.Highlight{{Type: "node", ID: nodeID, Color: "#3b82f6", Animation: "pulse"}}, sim.versionData(version))
+		if node.IsLeaf {
+			break
+		}
+		nodeID = node.Children[i]
+	}
+	sim.addStep("Key Not Found",
+		fmt.Sprintf("Key %s does not exist in version %d", key, version),
+		[]protocol.Highlight{}, sim.versionData(version))
+}
+
+// PrepareShowVersion generates a step showing an older version of the tree
+func (sim *PersistentBTreeSimulation) PrepareShowVersion(version int) {
+	sim.begin("version")
+	record, err := sim.tree.Version(version)
+	if err != nil {
+		sim.addStep("Unknown Version", err.Error(), []protocol.Highlight{}, sim.GetVisualizationData())
+		return
+	}
+	sim.addStep(fmt.Sprintf("Version %d", version),
+		fmt.Sprintf("Version %d was created by %s and is rooted at %s. Highlighted nodes are still shared with the latest version %d",
+			version, record.Operation, rootName(record.RootID), sim.tree.Latest()),
+		sim.sharedWithLatest(version), sim.versionData(version))
+}
+
+// addVersionSteps walks through the nodes a new version copied and created
+func (sim *PersistentBTreeSimulation) addVersionSteps(previous, version int) {
+	record, _ := sim.tree.Version(version)
+	data := sim.versionData(version)
+	written, _ := sim.tree.NodeVersions(version)
+	before, _ := sim.tree.NodeVersions(previous)
+
+	// A copy that a later merge in the same update folded away never
+	// reaches the new version, so only surviving nodes are shown
+	copies := 0
+	for _, copy := range record.Copies {
+		if _, ok := written[copy.To]; !ok {
+			continue
+		}
+		copies++
+		sim.addStep(fmt.Sprintf("Copy %s", copy.From),
+			fmt.Sprintf("%s is on the modified path, so it is copied to %s. Version %d keeps pointing at %s",
+				copy.From, copy.To, previous, copy.From),
+			[]protocol.Highlight{{Type: "node", ID: copy.To, Color: "#f59e0b", Animation: "fadeIn"}}, data)
+	}
+	created := 0
+	for _, id := range record.Created {
+		if _, ok := written[id]; !ok {
+			continue
+		}
+		created++
+		sim.addStep(fmt.Sprintf("Create %s", id),
+			fmt.Sprintf("%s is a new node from a split or a growing root", id),
+			[]protocol.Highlight{{Type: "node", ID: id, Color: "#10b981", Animation: "fadeIn"}}, data)
+	}
+
+	shared := 0
+	highlights := []protocol.Highlight{}
+	for id, v := range written {
+		if v < version {
+			shared++
+			highlights = append(highlights, protocol.Highlight{Type: "node", ID: id, Color: "#9ca3af"})
+		}
+	}
+	sim.addStep(fmt.Sprintf("Version %d Committed", version),
+		fmt.Sprintf("New root %s: %d nodes copied, %d created and %d shared with version %d. Version %d is still readable from root %s, which reaches %d nodes",
+			rootName(record.RootID), copies, created, shared, previous,
+			previous, rootName(sim.rootOf(previous)), len(before)),
+		highlights, data)
+}
+
+// sharedWithLatest highlights the nodes of version that the latest version
+// still uses
+func (sim *PersistentBTreeSimulation) sharedWithLatest(version int) []protocol.Highlight {
+	old, _ := sim.tree.NodeVersions(version)
+	latest, _ := sim.tree.NodeVersions(sim.tree.Latest())
+	highlights := []protocol.Highlight{}
+	for id := range old {
+		if _, ok := latest[id]; ok {
+			highlights = append(highlights, protocol.Highlight{Type: "node", ID: id, Color: "#9ca3af"})
+		}
+	}
+	return highlights
+}
+
+// versionData renders one version. Each node carries the version that wrote
+// it and whether it is shared with an earlier version.
+func (sim *PersistentBTreeSimulation) versionData(version int) map[string]interface{} {
+	snapshot, _ := sim.tree.Snapshot(version)
+	written, _ := sim.tree.NodeVersions(version)
+
+	nodes := make(map[string]interface{})
+	copied := 0
+	for id, node := range snapshot.Nodes {
+		nodes[id] = map[string]interface{}{
+			"id":        node.ID,
+			"keys":      node.Keys,
+			"children":  node.Children,
+			"isLeaf":    node.IsLeaf,
+			"parent":    node.Parent,
+			"writtenIn": written[id],
+			"shared":    written[id] < version,
+		}
+		if written[id] == version {
+			copied++
+		}
+	}
+
+	return map[string]interface{}{
+		"nodes":       nodes,
+		"rootId":      snapshot.RootID,
+		"order":       sim.tree.Order,
+		"keyType":     internal.KindInt,
+		"version":     version,
+		"latest":      sim.tree.Latest(),
+		"versions":    sim.tree.Versions(),
+		"sharedNodes": len(nodes) - copied,
+		"copiedNodes": copied,
+	}
+}
+
+func (sim *PersistentBTreeSimulation) rootOf(version int) string {
+	record, _ := sim.tree.Version(version)
+	return record.RootID
+}
+
+func (sim *PersistentBTreeSimulation) begin(operation string) {
+	sim.operation = operation
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+}
+
+func (sim *PersistentBTreeSimulation) addStep(title, description string, highlights []protocol.Highlight, data map[string]interface{}) {
+	step := engine.Step{
+		Index:       len(sim.steps),
+		Title:       title,
+		Description: description,
+		Highlights:  highlights,
+		Data:        data,
+	}
+	sim.steps = append(sim.steps, step)
+}
+
+// rootName describes a root ID, which is empty for an empty version
+func rootName(id string) string {
+	if id == "" {
+		return "an empty tree"
+	}
+	return id
+}
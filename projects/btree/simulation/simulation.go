@@ -2,6 +2,7 @@ package simulation
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/ersantana/db-internals/packages/protocol"
 	"github.com/ersantana/db-internals/packages/simulation/engine"
@@ -14,7 +15,8 @@ type BTreeSimulation struct {
 	steps       []engine.Step
 	currentStep int
 	operation   string
-	operand     int
+	operand     internal.Key
+	keyKind     internal.KeyKind
 	searchPath  []string
 }
 
@@ -45,12 +47,41 @@ func (sim *BTreeSimulation) Initialize(config map[string]interface{}) error {
 		order = int(o)
 	}
 	sim.tree = internal.NewBTree(order)
+	if unique, ok := config["unique"].(bool); ok {
+		sim.tree.Unique = unique
+	}
+	if prefix, ok := config["prefixCompression"].(bool); ok {
+		sim.tree.Compression.Prefix = prefix
+	}
+	if truncate, ok := config["suffixTruncation"].(bool); ok {
+		sim.tree.Compression.SuffixTruncation = truncate
+	}
+	if name, ok := config["splitPolicy"].(string); ok {
+		policy, err := internal.ParseSplitPolicy(name)
+		if err != nil {
+			return err
+		}
+		sim.tree.Split.Policy = policy
+	}
+	if fill, ok := config["splitFillFactor"].(float64); ok {
+		sim.tree.Split.FillFactor = fill
+	}
+
+	// Key kind: int (default), string, bytes or composite
+	sim.keyKind = internal.KindInt
+	if kind, ok := config["keyType"].(string); ok && kind != "" {
+		sim.keyKind = internal.KeyKind(kind)
+	}
 
 	// Pre-populate if specified
-	if keys, ok := config["initialKeys"].([]interface{}); ok {
-		for _, k := range keys {
-			if key, ok := k.(float64); ok {
-				sim.tree.Insert(int(key))
+	if values, ok := config["initialKeys"].([]interface{}); ok {
+		keys, err := internal.ParseKeys(sim.keyKind, values)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := sim.tree.Insert(key); err != nil {
+				return err
 			}
 		}
 	}
@@ -62,7 +93,11 @@ func (sim *BTreeSimulation) Initialize(config map[string]interface{}) error {
 
 // Reset returns the simulation to initial state
 func (sim *BTreeSimulation) Reset() error {
+	unique, compression, split := sim.tree.Unique, sim.tree.Compression, sim.tree.Split
 	sim.tree = internal.NewBTree(sim.tree.Order)
+	sim.tree.Unique = unique
+	sim.tree.Compression = compression
+	sim.tree.Split = split
 	sim.steps = make([]engine.Step, 0)
 	sim.currentStep = -1
 	sim.searchPath = nil
@@ -91,10 +126,15 @@ func (sim *BTreeSimulation) ExecuteStep(index int) engine.StepResult {
 	sim.currentStep = index
 	step := sim.steps[index]
 
+	data := step.Data
+	if data == nil {
+		data = sim.GetVisualizationData()
+	}
+
 	return engine.StepResult{
 		Success:     true,
 		Highlights:  step.Highlights,
-		Data:        sim.GetVisualizationData(),
+		Data:        data,
 		Description: step.Description,
 	}
 }
@@ -113,6 +153,8 @@ func (sim *BTreeSimulation) CanStepBackward() bool {
 func (sim *BTreeSimulation) GetState() interface{} {
 	return map[string]interface{}{
 		"order":       sim.tree.Order,
+		"unique":      sim.tree.Unique,
+		"keyType":     sim.keyKind,
 		"rootId":      sim.tree.RootID,
 		"nodes":       sim.tree.Nodes,
 		"operation":   sim.operation,
@@ -123,27 +165,16 @@ func (sim *BTreeSimulation) GetState() interface{} {
 
 // GetVisualizationData returns data for rendering
 func (sim *BTreeSimulation) GetVisualizationData() map[string]interface{} {
-	nodes := make(map[string]interface{})
-	for id, node := range sim.tree.Nodes {
-		nodes[id] = map[string]interface{}{
-			"id":       node.ID,
-			"keys":     node.Keys,
-			"children": node.Children,
-			"isLeaf":   node.IsLeaf,
-			"parent":   node.Parent,
-		}
-	}
+	return sim.cloneTreeData(sim.tree)
+}
 
-	return map[string]interface{}{
-		"nodes":  nodes,
-		"rootId": sim.tree.RootID,
-		"order":  sim.tree.Order,
-		"path":   sim.searchPath,
-	}
+// ParseKey converts an operation parameter into a key of the simulation's key kind
+func (sim *BTreeSimulation) ParseKey(value interface{}) (internal.Key, error) {
+	return internal.ParseKey(sim.keyKind, value)
 }
 
 // PrepareInsert generates steps for an insert operation
-func (sim *BTreeSimulation) PrepareInsert(key int) {
+func (sim *BTreeSimulation) PrepareInsert(key internal.Key) {
 	sim.operation = "insert"
 	sim.operand = key
 	sim.steps = make([]engine.Step, 0)
@@ -155,37 +186,62 @@ func (sim *BTreeSimulation) PrepareInsert(key int) {
 
 	// Step 1: Start
 	sim.addStep(
-		fmt.Sprintf("Insert %d", key),
-		fmt.Sprintf("Starting insertion of key %d into the B-Tree", key),
+		fmt.Sprintf("Insert %s", key),
+		fmt.Sprintf("Starting insertion of key %s into the B-Tree", key),
 		[]protocol.Highlight{},
 		sim.cloneTreeData(treeCopy),
 	)
 
+	// Resolve the stored entry. Unique trees reject duplicates here.
+	entry, err := treeCopy.EntryFor(key)
+	if err != nil {
+		nodeID, _, _ := treeCopy.Search(key)
+		sim.addStep(
+			"Duplicate Key",
+			fmt.Sprintf("Insert rejected: %v", err),
+			[]protocol.Highlight{
+				{Type: "node", ID: nodeID, Color: "#ef4444", Animation: "shake"},
+				{Type: "key", ID: key.String(), Color: "#ef4444", Animation: "shake"},
+			},
+			sim.cloneTreeData(treeCopy),
+		)
+		return
+	}
+	if entry.Compare(key) != 0 {
+		sim.addStep(
+			"Assign Row ID",
+			fmt.Sprintf("Non-unique index: key %s is stored as entry %s so duplicates are ordered by row ID", key, entry),
+			[]protocol.Highlight{},
+			sim.cloneTreeData(treeCopy),
+		)
+	}
+
 	if treeCopy.RootID == "" {
 		// Empty tree
 		sim.addStep(
 			"Create Root",
-			fmt.Sprintf("Tree is empty. Creating root node with key %d", key),
+			fmt.Sprintf("Tree is empty. Creating root node with key %s", entry),
 			[]protocol.Highlight{{Type: "node", ID: "new-root", Color: "#10b981", Animation: "pulse"}},
 			sim.cloneTreeData(treeCopy),
 		)
-		treeCopy.Insert(key)
+		treeCopy.Insert(entry)
 		sim.addStep(
 			"Insertion Complete",
-			fmt.Sprintf("Key %d inserted as root", key),
+			fmt.Sprintf("Key %s inserted as root", key),
 			[]protocol.Highlight{{Type: "node", ID: treeCopy.RootID, Color: "#10b981", Animation: "pulse"}},
 			sim.cloneTreeData(treeCopy),
 		)
 	} else {
 		// Find insertion path
-		path := sim.findInsertionPath(treeCopy, key)
+		path := sim.findInsertionPath(treeCopy, entry)
 
 		// Traverse to insertion point
 		for i, nodeID := range path {
 			node := treeCopy.Nodes[nodeID]
+			sim.searchPath = path[:i+1]
 			sim.addStep(
 				fmt.Sprintf("Traverse to %s", nodeID),
-				fmt.Sprintf("Examining node with keys %v. Looking for position to insert %d", node.Keys, key),
+				fmt.Sprintf("Examining node with keys %v. Looking for position to insert %s", node.Keys, key),
 				[]protocol.Highlight{{Type: "node", ID: nodeID, Color: "#3b82f6", Animation: "pulse"}},
 				sim.cloneTreeData(treeCopy),
 			)
@@ -195,10 +251,10 @@ func (sim *BTreeSimulation) PrepareInsert(key int) {
 					// Simple insert
 					sim.addStep(
 						"Insert Key",
-						fmt.Sprintf("Leaf node has space. Inserting key %d", key),
+						fmt.Sprintf("Leaf node has space. Inserting key %s", entry),
 						[]protocol.Highlight{
 							{Type: "node", ID: nodeID, Color: "#10b981", Animation: "pulse"},
-							{Type: "key", ID: fmt.Sprintf("%d", key), Color: "#10b981", Animation: "pulse"},
+							{Type: "key", ID: entry.String(), Color: "#10b981", Animation: "pulse"},
 						},
 						sim.cloneTreeData(treeCopy),
 					)
@@ -214,54 +270,27 @@ func (sim *BTreeSimulation) PrepareInsert(key int) {
 			}
 		}
 
-		// Perform actual insertion
-		oldNodes := make(map[string]bool)
-		for id := range treeCopy.Nodes {
-			oldNodes[id] = true
-		}
-
-		treeCopy.Insert(key)
-
-		// Check for splits
-		newNodes := []string{}
-		for id := range treeCopy.Nodes {
-			if !oldNodes[id] {
-				newNodes = append(newNodes, id)
-			}
-		}
-
-		if len(newNodes) > 0 {
-			highlights := []protocol.Highlight{}
-			for _, id := range newNodes {
-				highlights = append(highlights, protocol.Highlight{
-					Type:      "node",
-					ID:        id,
-					Color:     "#f59e0b",
-					Animation: "fadeIn",
-				})
-			}
-			sim.addStep(
-				"Split Occurred",
-				fmt.Sprintf("Node split required. Created %d new node(s)", len(newNodes)),
-				highlights,
-				sim.cloneTreeData(treeCopy),
-			)
+		// Perform actual insertion, one step per split stage
+		treeCopy.Observer = func(event internal.TraceEvent) {
+			sim.addTraceStep(treeCopy, event)
 		}
+		treeCopy.Insert(entry)
+		treeCopy.Observer = nil
 
 		sim.addStep(
 			"Insertion Complete",
-			fmt.Sprintf("Key %d successfully inserted into the B-Tree", key),
-			[]protocol.Highlight{{Type: "key", ID: fmt.Sprintf("%d", key), Color: "#10b981", Animation: "pulse"}},
+			fmt.Sprintf("Key %s successfully inserted into the B-Tree", key),
+			[]protocol.Highlight{{Type: "key", ID: entry.String(), Color: "#10b981", Animation: "pulse"}},
 			sim.cloneTreeData(treeCopy),
 		)
 	}
 
 	// Apply to actual tree
-	sim.tree.Insert(key)
+	sim.tree.Insert(entry)
 }
 
 // PrepareSearch generates steps for a search operation
-func (sim *BTreeSimulation) PrepareSearch(key int) {
+func (sim *BTreeSimulation) PrepareSearch(key internal.Key) {
 	sim.operation = "search"
 	sim.operand = key
 	sim.steps = make([]engine.Step, 0)
@@ -269,8 +298,8 @@ func (sim *BTreeSimulation) PrepareSearch(key int) {
 	sim.searchPath = nil
 
 	sim.addStep(
-		fmt.Sprintf("Search for %d", key),
-		fmt.Sprintf("Starting search for key %d in the B-Tree", key),
+		fmt.Sprintf("Search for %s", key),
+		fmt.Sprintf("Starting search for key %s in the B-Tree", key),
 		[]protocol.Highlight{},
 		sim.cloneTreeData(sim.tree),
 	)
@@ -290,45 +319,67 @@ func (sim *BTreeSimulation) PrepareSearch(key int) {
 
 	sim.searchPath = path
 
-	if found {
+	if found && !sim.tree.Unique {
+		// Duplicates are contiguous in index order, possibly across several nodes
+		entries := sim.tree.RangeSearch(key, key)
+		highlights := []protocol.Highlight{}
+		for _, e := range entries {
+			highlights = append(highlights, protocol.Highlight{
+				Type:      "key",
+				ID:        e.String(),
+				Color:     "#10b981",
+				Animation: "pulse",
+			})
+		}
+		sim.addStep(
+			"Key Found!",
+			fmt.Sprintf("Key %s found with %d entries: %v", key, len(entries), entries),
+			highlights,
+			sim.cloneTreeData(sim.tree),
+		)
+	} else if found {
 		sim.addStep(
 			"Key Found!",
-			fmt.Sprintf("Key %d found in the B-Tree", key),
-			[]protocol.Highlight{{Type: "key", ID: fmt.Sprintf("%d", key), Color: "#10b981", Animation: "pulse"}},
+			fmt.Sprintf("Key %s found in the B-Tree", key),
+			[]protocol.Highlight{{Type: "key", ID: key.String(), Color: "#10b981", Animation: "pulse"}},
 			sim.cloneTreeData(sim.tree),
 		)
 	} else {
 		sim.addStep(
 			"Key Not Found",
-			fmt.Sprintf("Key %d does not exist in the B-Tree", key),
+			fmt.Sprintf("Key %s does not exist in the B-Tree", key),
 			[]protocol.Highlight{},
 			sim.cloneTreeData(sim.tree),
 		)
 	}
 }
 
-func (sim *BTreeSimulation) searchWithSteps(nodeID string, key int, path *[]string) bool {
+func (sim *BTreeSimulation) searchWithSteps(nodeID string, key internal.Key, path *[]string) bool {
 	node := sim.tree.Nodes[nodeID]
 	*path = append(*path, nodeID)
+	sim.searchPath = *path
 
 	// Find position
 	i := 0
-	for i < len(node.Keys) && key > node.Keys[i] {
+	for i < len(node.Keys) && key.Compare(node.Keys[i]) > 0 {
 		i++
 	}
 
+	// Bare keys match any duplicate entry of a non-unique tree
+	matches := i < len(node.Keys) && internal.EntryKey(node.Keys[i]).Compare(internal.EntryKey(key)) == 0
+
 	keyComparison := "greater than all keys"
 	if i < len(node.Keys) {
-		if key == node.Keys[i] {
+		if matches {
 			keyComparison = fmt.Sprintf("equal to key at position %d", i)
 		} else {
-			keyComparison = fmt.Sprintf("less than key %d at position %d", node.Keys[i], i)
+			keyComparison = fmt.Sprintf("less than key %s at position %d", node.Keys[i], i)
 		}
 	}
 
 	sim.addStep(
 		fmt.Sprintf("Examine %s", nodeID),
-		fmt.Sprintf("Comparing %d with keys %v. Result: %s", key, node.Keys, keyComparison),
+		fmt.Sprintf("Comparing %s with keys %v. Result: %s", key, node.Keys, keyComparison),
 		[]protocol.Highlight{
 			{Type: "node", ID: nodeID, Color: "#3b82f6", Animation: "pulse"},
 		},
@@ -336,7 +387,7 @@ func (sim *BTreeSimulation) searchWithSteps(nodeID string, key int, path *[]stri
 	)
 
 	// Check if found
-	if i < len(node.Keys) && key == node.Keys[i] {
+	if matches {
 		return true
 	}
 
@@ -360,7 +411,7 @@ func (sim *BTreeSimulation) searchWithSteps(nodeID string, key int, path *[]stri
 }
 
 // PrepareDelete generates steps for a delete operation
-func (sim *BTreeSimulation) PrepareDelete(key int) {
+func (sim *BTreeSimulation) PrepareDelete(key internal.Key) {
 	sim.operation = "delete"
 	sim.operand = key
 	sim.steps = make([]engine.Step, 0)
@@ -370,8 +421,8 @@ func (sim *BTreeSimulation) PrepareDelete(key int) {
 	treeCopy := sim.tree.Clone()
 
 	sim.addStep(
-		fmt.Sprintf("Delete %d", key),
-		fmt.Sprintf("Starting deletion of key %d from the B-Tree", key),
+		fmt.Sprintf("Delete %s", key),
+		fmt.Sprintf("Starting deletion of key %s from the B-Tree", key),
 		[]protocol.Highlight{},
 		sim.cloneTreeData(treeCopy),
 	)
@@ -381,17 +432,18 @@ func (sim *BTreeSimulation) PrepareDelete(key int) {
 	if !found {
 		sim.addStep(
 			"Key Not Found",
-			fmt.Sprintf("Key %d does not exist in the tree. Nothing to delete.", key),
+			fmt.Sprintf("Key %s does not exist in the tree. Nothing to delete.", key),
 			[]protocol.Highlight{},
 			sim.cloneTreeData(treeCopy),
 		)
 		return
 	}
 
+	entry := treeCopy.Nodes[nodeID].Keys[keyIndex]
 	sim.addStep(
 		"Key Found",
-		fmt.Sprintf("Found key %d at node %s, position %d", key, nodeID, keyIndex),
-		[]protocol.Highlight{{Type: "key", ID: fmt.Sprintf("%d", key), Color: "#ef4444", Animation: "pulse"}},
+		fmt.Sprintf("Found key %s at node %s, position %d", entry, nodeID, keyIndex),
+		[]protocol.Highlight{{Type: "key", ID: entry.String(), Color: "#ef4444", Animation: "pulse"}},
 		sim.cloneTreeData(treeCopy),
 	)
 
@@ -399,43 +451,48 @@ func (sim *BTreeSimulation) PrepareDelete(key int) {
 	if node.IsLeaf {
 		sim.addStep(
 			"Delete from Leaf",
-			fmt.Sprintf("Key %d is in a leaf node. Removing directly.", key),
+			fmt.Sprintf("Key %s is in a leaf node. Removing directly.", key),
 			[]protocol.Highlight{{Type: "node", ID: nodeID, Color: "#f59e0b", Animation: "pulse"}},
 			sim.cloneTreeData(treeCopy),
 		)
 	} else {
 		sim.addStep(
 			"Delete from Internal",
-			fmt.Sprintf("Key %d is in an internal node. Will replace with predecessor/successor.", key),
+			fmt.Sprintf("Key %s is in an internal node. Will replace with predecessor/successor.", key),
 			[]protocol.Highlight{{Type: "node", ID: nodeID, Color: "#f59e0b", Animation: "pulse"}},
 			sim.cloneTreeData(treeCopy),
 		)
 	}
 
-	// Perform deletion
-	treeCopy.Delete(key)
+	// Perform deletion of the exact entry found above, one step per
+	// borrow, merge and root change
+	treeCopy.Observer = func(event internal.TraceEvent) {
+		sim.addTraceStep(treeCopy, event)
+	}
+	treeCopy.Delete(entry)
+	treeCopy.Observer = nil
 
 	sim.addStep(
 		"Deletion Complete",
-		fmt.Sprintf("Key %d successfully deleted from the B-Tree", key),
+		fmt.Sprintf("Key %s successfully deleted from the B-Tree", entry),
 		[]protocol.Highlight{},
 		sim.cloneTreeData(treeCopy),
 	)
 
 	// Apply to actual tree
-	sim.tree.Delete(key)
+	sim.tree.Delete(entry)
 }
 
 // PrepareRangeSearch generates steps for a range search
-func (sim *BTreeSimulation) PrepareRangeSearch(start, end int) {
+func (sim *BTreeSimulation) PrepareRangeSearch(start, end internal.Key) {
 	sim.operation = "range"
 	sim.steps = make([]engine.Step, 0)
 	sim.currentStep = -1
 	sim.searchPath = nil
 
 	sim.addStep(
-		fmt.Sprintf("Range [%d, %d]", start, end),
-		fmt.Sprintf("Starting range search for keys between %d and %d", start, end),
+		fmt.Sprintf("Range [%s, %s]", start, end),
+		fmt.Sprintf("Starting range search for keys between %s and %s", start, end),
 		[]protocol.Highlight{},
 		sim.cloneTreeData(sim.tree),
 	)
@@ -447,7 +504,7 @@ func (sim *BTreeSimulation) PrepareRangeSearch(start, end int) {
 		for _, k := range results {
 			highlights = append(highlights, protocol.Highlight{
 				Type:  "key",
-				ID:    fmt.Sprintf("%d", k),
+				ID:    k.String(),
 				Color: "#10b981",
 			})
 		}
@@ -460,44 +517,409 @@ func (sim *BTreeSimulation) PrepareRangeSearch(start, end int) {
 	} else {
 		sim.addStep(
 			"No Results",
-			fmt.Sprintf("No keys found in range [%d, %d]", start, end),
+			fmt.Sprintf("No keys found in range [%s, %s]", start, end),
+			[]protocol.Highlight{},
+			sim.cloneTreeData(sim.tree),
+		)
+	}
+}
+
+// PrepareScan generates steps for an index scan over [start, end] that moves
+// a cursor one entry at a time, in descending order when reverse is set
+func (sim *BTreeSimulation) PrepareScan(start, end internal.Key, reverse bool) {
+	sim.operation = "scan"
+	sim.operand = nil
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+	sim.searchPath = nil
+
+	direction, seekKey := "forward", start
+	if reverse {
+		direction, seekKey = "reverse", end
+	}
+	sim.addStep(
+		fmt.Sprintf("Scan [%s, %s]", start, end),
+		fmt.Sprintf("Opening a %s cursor for keys between %s and %s", direction, start, end),
+		[]protocol.Highlight{},
+		sim.cloneTreeData(sim.tree),
+	)
+
+	cursor := sim.tree.Cursor()
+	var ok bool
+	if reverse {
+		ok = cursor.SeekLE(end)
+	} else {
+		ok = cursor.Seek(start)
+	}
+
+	path := cursor.Path()
+	highlights := []protocol.Highlight{}
+	for _, nodeID := range path {
+		highlights = append(highlights, protocol.Highlight{Type: "node", ID: nodeID, Color: "#3b82f6", Animation: "pulse"})
+	}
+	sim.searchPath = path
+	sim.addStep(
+		fmt.Sprintf("Seek %s", seekKey),
+		fmt.Sprintf("Descending from the root through %v to position the cursor", path),
+		highlights,
+		sim.cloneTreeData(sim.tree),
+	)
+
+	inRange := func(k internal.Key) bool {
+		if reverse {
+			return internal.EntryKey(k).Compare(internal.EntryKey(start)) >= 0
+		}
+		return internal.EntryKey(k).Compare(internal.EntryKey(end)) <= 0
+	}
+
+	count := 0
+	prevNode := ""
+	for ; ok && inRange(cursor.Key()); count++ {
+		key, nodeID := cursor.Key(), cursor.NodeID()
+		description := fmt.Sprintf("Cursor returns %s from %s", key, nodeID)
+		if prevNode != "" && nodeID != prevNode {
+			description = fmt.Sprintf("Cursor moves from %s to %s and returns %s", prevNode, nodeID, key)
+		}
+		sim.addStep(
+			fmt.Sprintf("Return %s", key),
+			description,
+			[]protocol.Highlight{
+				{Type: "node", ID: nodeID, Color: "#3b82f6"},
+				{Type: "key", ID: key.String(), Color: "#10b981", Animation: "pulse"},
+			},
+			sim.cloneTreeData(sim.tree),
+		)
+		prevNode = nodeID
+
+		if reverse {
+			ok = cursor.Prev()
+		} else {
+			ok = cursor.Next()
+		}
+	}
+
+	reason := "the end of the index"
+	if ok {
+		reason = fmt.Sprintf("%s, which is outside the range", cursor.Key())
+	}
+	sim.addStep(
+		"Scan Complete",
+		fmt.Sprintf("Returned %d keys. The cursor stopped at %s", count, reason),
+		[]protocol.Highlight{},
+		sim.cloneTreeData(sim.tree),
+	)
+}
+
+// PreparePrefixSearch generates steps for a prefix lookup, such as all
+// (last_name, id) entries for a given last name
+func (sim *BTreeSimulation) PreparePrefixSearch(prefix internal.Key) {
+	prefix = sim.tree.PrefixKey(prefix)
+	sim.operation = "prefix"
+	sim.operand = prefix
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+	sim.searchPath = nil
+
+	sim.addStep(
+		fmt.Sprintf("Prefix %s", prefix),
+		fmt.Sprintf("Starting prefix lookup for keys beginning with %s. Matching keys are contiguous, so the scan starts at the first key >= %s", prefix, prefix),
+		[]protocol.Highlight{},
+		sim.cloneTreeData(sim.tree),
+	)
+
+	// Descend to where the prefix would be inserted
+	path := sim.findInsertionPath(sim.tree, prefix)
+	for i, nodeID := range path {
+		node := sim.tree.Nodes[nodeID]
+		sim.searchPath = path[:i+1]
+		sim.addStep(
+			fmt.Sprintf("Descend to %s", nodeID),
+			fmt.Sprintf("Comparing prefix %s with keys %v", prefix, node.Keys),
+			[]protocol.Highlight{{Type: "node", ID: nodeID, Color: "#3b82f6", Animation: "pulse"}},
+			sim.cloneTreeData(sim.tree),
+		)
+	}
+
+	results := sim.tree.PrefixSearch(prefix)
+	if len(results) == 0 {
+		sim.addStep(
+			"No Results",
+			fmt.Sprintf("No keys start with %s", prefix),
 			[]protocol.Highlight{},
 			sim.cloneTreeData(sim.tree),
 		)
+		return
+	}
+
+	highlights := []protocol.Highlight{}
+	for _, k := range results {
+		highlights = append(highlights, protocol.Highlight{
+			Type:  "key",
+			ID:    k.String(),
+			Color: "#10b981",
+		})
+	}
+	sim.addStep(
+		"Prefix Search Complete",
+		fmt.Sprintf("Found %d keys with prefix %s: %v", len(results), prefix, results),
+		highlights,
+		sim.cloneTreeData(sim.tree),
+	)
+}
+
+// PrepareBulkLoad generates steps for building the tree bottom-up from a
+// batch of keys, as CREATE INDEX does, and compares the result with
+// inserting the same keys one at a time
+func (sim *BTreeSimulation) PrepareBulkLoad(keys []internal.Key, fillFactor float64) {
+	sim.operation = "bulkload"
+	sim.operand = nil
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+	sim.searchPath = nil
+
+	sorted := append([]internal.Key{}, keys...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Compare(sorted[j]) < 0
+	})
+
+	loaded := internal.NewBTree(sim.tree.Order)
+	loaded.Unique = sim.tree.Unique
+	loaded.Compression = sim.tree.Compression
+	loaded.Split = sim.tree.Split
+
+	sim.addStep(
+		fmt.Sprintf("Bulk Load %d keys", len(keys)),
+		fmt.Sprintf("Sorting %d keys, then building the tree bottom-up at fill factor %.0f%%", len(keys), fillFactor*100),
+		[]protocol.Highlight{},
+		sim.cloneTreeData(loaded),
+	)
+
+	if err := loaded.BulkLoad(sorted, fillFactor); err != nil {
+		sim.addStep(
+			"Bulk Load Failed",
+			err.Error(),
+			[]protocol.Highlight{},
+			sim.cloneTreeData(loaded),
+		)
+		return
+	}
+
+	levels := loaded.Levels()
+	for depth := len(levels) - 1; depth >= 0; depth-- {
+		level := levels[depth]
+		nodeKind := "internal"
+		if depth == len(levels)-1 {
+			nodeKind = "leaf"
+		}
+
+		for _, nodeID := range level {
+			node := loaded.Nodes[nodeID]
+			sim.addStep(
+				fmt.Sprintf("Pack %s %s", nodeKind, nodeID),
+				fmt.Sprintf("Packed %d of %d key slots with %v", len(node.Keys), loaded.Order-1, node.Keys),
+				[]protocol.Highlight{{Type: "node", ID: nodeID, Color: "#10b981", Animation: "fadeIn"}},
+				sim.cloneTreeData(loaded),
+			)
+		}
+
+		if depth == 0 {
+			break
+		}
+
+		// The keys between neighbouring nodes of this level went up to the parents
+		separators := []internal.Key{}
+		highlights := []protocol.Highlight{}
+		for _, parentID := range levels[depth-1] {
+			for _, k := range loaded.Nodes[parentID].Keys {
+				separators = append(separators, k)
+				highlights = append(highlights, protocol.Highlight{
+					Type:      "key",
+					ID:        k.String(),
+					Color:     "#f59e0b",
+					Animation: "pulse",
+				})
+			}
+		}
+		sim.addStep(
+			"Promote Separators",
+			fmt.Sprintf("Promoted %d separator keys %v between the %d %s nodes to the level above", len(separators), separators, len(level), nodeKind),
+			highlights,
+			sim.cloneTreeData(loaded),
+		)
+	}
+
+	sim.addStep(
+		"Root Created",
+		fmt.Sprintf("Single node %s left at the top level becomes the root. Height %d, %d nodes", loaded.RootID, loaded.Height(), len(loaded.Nodes)),
+		[]protocol.Highlight{{Type: "node", ID: loaded.RootID, Color: "#10b981", Animation: "pulse"}},
+		sim.cloneTreeData(loaded),
+	)
+
+	// Build the same keys top-down for comparison
+	incremental := internal.NewBTree(sim.tree.Order)
+	incremental.Unique = sim.tree.Unique
+	incremental.Compression = sim.tree.Compression
+	incremental.Split = sim.tree.Split
+	for _, k := range sorted {
+		incremental.Insert(k)
 	}
+	sim.addStep(
+		"Compare with Incremental Inserts",
+		fmt.Sprintf("Bulk load: %d nodes, height %d, fill factor %.0f%%. One-by-one inserts: %d nodes, height %d, fill factor %.0f%%",
+			len(loaded.Nodes), loaded.Height(), loaded.FillFactor()*100,
+			len(incremental.Nodes), incremental.Height(), incremental.FillFactor()*100),
+		[]protocol.Highlight{},
+		sim.cloneTreeData(loaded),
+	)
+
+	// Apply to actual tree
+	sim.tree = loaded
+}
+
+// addTraceStep turns a structural trace event into a step with highlights
+// on the nodes, edges and keys involved
+func (sim *BTreeSimulation) addTraceStep(tree *internal.BTree, event internal.TraceEvent) {
+	var title, description string
+	highlights := []protocol.Highlight{}
+	node := func(id, color, animation string) {
+		highlights = append(highlights, protocol.Highlight{Type: "node", ID: id, Color: color, Animation: animation})
+	}
+	edge := func(from, to, color string) {
+		highlights = append(highlights, protocol.Highlight{Type: "edge", ID: fmt.Sprintf("%s-%s", from, to), Color: color, Animation: "pulse"})
+	}
+	key := func(k internal.Key, color string) {
+		highlights = append(highlights, protocol.Highlight{Type: "key", ID: k.String(), Color: color, Animation: "pulse"})
+	}
+
+	switch event.Type {
+	case internal.EventRootGrown:
+		title = "Grow Root"
+		description = fmt.Sprintf("Root %s is full. New root %s is created above it, so the tree grows one level", event.NodeID, event.TargetID)
+		node(event.TargetID, "#10b981", "fadeIn")
+		node(event.NodeID, "#ef4444", "shake")
+		edge(event.TargetID, event.NodeID, "#10b981")
+	case internal.EventMedianChosen:
+		keys := tree.Nodes[event.NodeID].Keys
+		title = "Choose Median"
+		description = fmt.Sprintf("Node %s is full with %v. Median %s at position %d splits it in two", event.NodeID, keys, event.Key, event.Index)
+		if tree.Split.Policy == internal.SplitRightmost && event.Index > len(keys)/2 {
+			title = "Rightmost Split"
+			description = fmt.Sprintf("Node %s is full with %v and the new key goes past its last key on the right edge of the tree. It splits at position %d, keeping %d keys on the left so sequential inserts leave full nodes behind",
+				event.NodeID, keys, event.Index, event.Index)
+		} else if tree.Compression.SuffixTruncation && event.Index != len(keys)/2 {
+			title = "Choose Short Separator"
+			description = fmt.Sprintf("Node %s is full with %v. Suffix truncation promotes %s at position %d, the shortest key near the median, so the parent stores fewer bytes",
+				event.NodeID, keys, event.Key, event.Index)
+		}
+		node(event.NodeID, "#ef4444", "shake")
+		key(event.Key, "#f59e0b")
+	case internal.EventKeysMoved:
+		title = "Move Keys"
+		description = fmt.Sprintf("Keys %v right of the median move from %s into new node %s", event.Keys, event.NodeID, event.TargetID)
+		node(event.NodeID, "#3b82f6", "pulse")
+		node(event.TargetID, "#10b981", "fadeIn")
+		for _, k := range event.Keys {
+			key(k, "#10b981")
+		}
+	case internal.EventSeparatorPushed:
+		title = "Push Separator"
+		description = fmt.Sprintf("Median %s moves up into parent %s at position %d and separates the two halves", event.Key, event.ParentID, event.Index)
+		node(event.ParentID, "#f59e0b", "pulse")
+		edge(event.ParentID, event.NodeID, "#f59e0b")
+		key(event.Key, "#f59e0b")
+	case internal.EventBorrowLeft, internal.EventBorrowRight:
+		side := "left"
+		title = "Borrow from Left Sibling"
+		if event.Type == internal.EventBorrowRight {
+			side = "right"
+			title = "Borrow from Right Sibling"
+		}
+		description = fmt.Sprintf("%s is at minimum occupancy. Separator %s rotates down into it and %s moves up from %s sibling %s to replace it",
+			event.NodeID, event.Key, event.Separator, side, event.TargetID)
+		node(event.NodeID, "#10b981", "pulse")
+		node(event.TargetID, "#3b82f6", "pulse")
+		edge(event.ParentID, event.TargetID, "#f59e0b")
+		edge(event.ParentID, event.NodeID, "#f59e0b")
+		key(event.Key, "#10b981")
+		key(event.Separator, "#f59e0b")
+	case internal.EventMerged:
+		title = "Merge Nodes"
+		description = fmt.Sprintf("Siblings are at minimum occupancy. Separator %s comes down from %s and %s absorbs keys %v of %s, which is removed",
+			event.Key, event.ParentID, event.NodeID, event.Keys, event.TargetID)
+		node(event.NodeID, "#f59e0b", "pulse")
+		edge(event.ParentID, event.NodeID, "#f59e0b")
+		key(event.Key, "#f59e0b")
+	case internal.EventRedistributed:
+		title = "Redistribute to Sibling"
+		description = fmt.Sprintf("%s is full but sibling %s has room. Keys %v rotate into %s through parent %s, whose separator becomes %s, so no split is needed",
+			event.NodeID, event.TargetID, event.Keys, event.TargetID, event.ParentID, event.Separator)
+		node(event.NodeID, "#3b82f6", "pulse")
+		node(event.TargetID, "#10b981", "pulse")
+		edge(event.ParentID, event.TargetID, "#f59e0b")
+		key(event.Separator, "#f59e0b")
+		for _, k := range event.Keys {
+			key(k, "#10b981")
+		}
+	case internal.EventRootShrunk:
+		title = "Shrink Root"
+		description = fmt.Sprintf("Root %s has no keys left and is removed. %s becomes the root, so the tree loses one level", event.TargetID, event.NodeID)
+		node(event.NodeID, "#10b981", "pulse")
+	default:
+		return
+	}
+
+	// Invariants may not hold until the split or merge finishes
+	data := sim.cloneTreeData(tree)
+	data["inProgress"] = true
+	sim.addStep(title, description, highlights, data)
 }
 
 // Helper methods
-func (sim *BTreeSimulation) addStep(title, description string, highlights []protocol.Highlight, _ map[string]interface{}) {
+
+// addStep records a step with the tree snapshot it should render
+func (sim *BTreeSimulation) addStep(title, description string, highlights []protocol.Highlight, data map[string]interface{}) {
 	step := engine.Step{
 		Index:       len(sim.steps),
 		Title:       title,
 		Description: description,
 		Highlights:  highlights,
+		Data:        data,
 	}
 	sim.steps = append(sim.steps, step)
 }
 
+// cloneTreeData deep-copies the tree into visualization data, so the snapshot
+// stays fixed while later steps keep modifying the tree
 func (sim *BTreeSimulation) cloneTreeData(tree *internal.BTree) map[string]interface{} {
 	nodes := make(map[string]interface{})
 	for id, node := range tree.Nodes {
 		nodes[id] = map[string]interface{}{
 			"id":       node.ID,
-			"keys":     append([]int{}, node.Keys...),
+			"keys":     append([]internal.Key{}, node.Keys...),
 			"children": append([]string{}, node.Children...),
 			"isLeaf":   node.IsLeaf,
 			"parent":   node.Parent,
+			"layout":   tree.NodeLayout(id),
 		}
 	}
 	return map[string]interface{}{
-		"nodes":  nodes,
-		"rootId": tree.RootID,
-		"order":  tree.Order,
-		"path":   sim.searchPath,
+		"nodes":      nodes,
+		"rootId":     tree.RootID,
+		"order":      tree.Order,
+		"unique":     tree.Unique,
+		"keyType":    sim.keyKind,
+		"path":       append([]string(nil), sim.searchPath...),
+		"stats":      tree.Stats(),
+		"invariants": tree.CheckInvariants(),
+		"compression": map[string]interface{}{
+			"config": tree.Compression,
+			"stats":  tree.CompressionStats(internal.PageSize8K),
+		},
+		"split": tree.Split,
 	}
 }
 
-func (sim *BTreeSimulation) findInsertionPath(tree *internal.BTree, key int) []string {
+func (sim *BTreeSimulation) findInsertionPath(tree *internal.BTree, key internal.Key) []string {
 	path := []string{}
 	if tree.RootID == "" {
 		return path
@@ -512,7 +934,7 @@ func (sim *BTreeSimulation) findInsertionPath(tree *internal.BTree, key int) []s
 		}
 		// Find child to follow
 		i := 0
-		for i < len(node.Keys) && key > node.Keys[i] {
+		for i < len(node.Keys) && key.Compare(node.Keys[i]) > 0 {
 			i++
 		}
 		nodeID = node.Children[i]
@@ -0,0 +1,251 @@
+package simulation
+
+import (
+	"fmt"
+
+	"github.com/ersantana/db-internals/packages/protocol"
+	"github.com/ersantana/db-internals/packages/simulation/engine"
+	"github.com/ersantana/db-internals/projects/btree/internal"
+)
+
+// SplitPolicySimulation inserts the same keys into two B-Trees that differ
+// only in split policy, and compares their node counts and fill factors
+type SplitPolicySimulation struct {
+	trees       [2]*internal.BTree
+	steps       []engine.Step
+	currentStep int
+	operation   string
+	keyKind     internal.KeyKind
+}
+
+// NewSplitPolicySimulation creates a simulation comparing median splits
+// against rightmost splits
+func NewSplitPolicySimulation() *SplitPolicySimulation {
+	sim := &SplitPolicySimulation{
+		keyKind:     internal.KindInt,
+		steps:       make([]engine.Step, 0),
+		currentStep: -1,
+	}
+	sim.trees[0] = newPolicyTree(4, internal.SplitConfig{Policy: internal.SplitMedian})
+	sim.trees[1] = newPolicyTree(4, internal.SplitConfig{Policy: internal.SplitRightmost})
+	return sim
+}
+
+func newPolicyTree(order int, split internal.SplitConfig) *internal.BTree {
+	tree := internal.NewBTree(order)
+	tree.Split = split
+	return tree
+}
+
+// Name returns the simulation name
+func (sim *SplitPolicySimulation) Name() string {
+	return "B-Tree Split Policies"
+}
+
+// Description returns the simulation description
+func (sim *SplitPolicySimulation) Description() string {
+	return "Insert one key sequence under two split policies and compare node counts and fill factors"
+}
+
+// Initialize sets up the simulation with given config: order, keyType,
+// policies (two policy names, median and rightmost by default) and
+// fillFactor for rightmost splits
+func (sim *SplitPolicySimulation) Initialize(config map[string]interface{}) error {
+	order := 4
+	if o, ok := config["order"].(float64); ok {
+		order = int(o)
+	}
+	sim.keyKind = internal.KindInt
+	if kind, ok := config["keyType"].(string); ok && kind != "" {
+		sim.keyKind = internal.KeyKind(kind)
+	}
+
+	names := []interface{}{string(internal.SplitMedian), string(internal.SplitRightmost)}
+	if policies, ok := config["policies"].([]interface{}); ok {
+		if len(policies) != 2 {
+			return fmt.Errorf("policies must name exactly two split policies, got %d", len(policies))
+		}
+		names = policies
+	}
+	fill, _ := config["fillFactor"].(float64)
+	for i, name := range names {
+		s, _ := name.(string)
+		policy, err := internal.ParseSplitPolicy(s)
+		if err != nil {
+			return err
+		}
+		sim.trees[i] = newPolicyTree(order, internal.SplitConfig{Policy: policy, FillFactor: fill})
+	}
+	return sim.Reset()
+}
+
+// Reset empties both trees, keeping their order and policies
+func (sim *SplitPolicySimulation) Reset() error {
+	for i, tree := range sim.trees {
+		sim.trees[i] = newPolicyTree(tree.Order, tree.Split)
+	}
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+	return nil
+}
+
+// GenerateSteps returns all steps for current simulation
+func (sim *SplitPolicySimulation) GenerateSteps() []engine.Step {
+	return sim.steps
+}
+
+// CurrentStep returns current step index
+func (sim *SplitPolicySimulation) CurrentStep() int {
+	return sim.currentStep
+}
+
+// ExecuteStep executes a specific step
+func (sim *SplitPolicySimulation) ExecuteStep(index int) engine.StepResult {
+	if index < 0 || index >= len(sim.steps) {
+		return engine.StepResult{
+			Success: false,
+			Error:   engine.ErrInvalidStepIndex,
+		}
+	}
+
+	sim.currentStep = index
+	step := sim.steps[index]
+
+	data := step.Data
+	if data == nil {
+		data = sim.GetVisualizationData()
+	}
+
+	return engine.StepResult{
+		Success:     true,
+		Highlights:  step.Highlights,
+		Data:        data,
+		Description: step.Description,
+	}
+}
+
+// CanStepForward returns true if can advance
+func (sim *SplitPolicySimulation) CanStepForward() bool {
+	return sim.currentStep < len(sim.steps)-1
+}
+
+// CanStepBackward returns true if can go back
+func (sim *SplitPolicySimulation) CanStepBackward() bool {
+	return sim.currentStep > 0
+}
+
+// GetState returns current state of both trees
+func (sim *SplitPolicySimulation) GetState() interface{} {
+	return map[string]interface{}{
+		"trees":       sim.treesData(),
+		"operation":   sim.operation,
+		"currentStep": sim.currentStep,
+		"totalSteps":  len(sim.steps),
+	}
+}
+
+// GetVisualizationData returns both trees side by side
+func (sim *SplitPolicySimulation) GetVisualizationData() map[string]interface{} {
+	return map[string]interface{}{
+		"trees": sim.treesData(),
+	}
+}
+
+// ParseKey converts an operation parameter into a key of the simulation's key kind
+func (sim *SplitPolicySimulation) ParseKey(value interface{}) (internal.Key, error) {
+	return internal.ParseKey(sim.keyKind, value)
+}
+
+// PrepareCompare generates one step per key inserted into both trees, and a
+// final step comparing their shapes
+func (sim *SplitPolicySimulation) PrepareCompare(keys []internal.Key) {
+	sim.operation = "compare"
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+
+	a, b := sim.trees[0], sim.trees[1]
+	sim.addStep("Compare Split Policies",
+		fmt.Sprintf("Inserting %d keys into two order-%d B-Trees, one splitting with the %s policy and one with the %s policy",
+			len(keys), a.Order, a.Split.Policy, b.Split.Policy),
+		[]protocol.Highlight{}, sim.GetVisualizationData())
+
+	for _, key := range keys {
+		outcomes := make([]string, len(sim.trees))
+		highlights := []protocol.Highlight{}
+		for i, tree := range sim.trees {
+			before := tree.Stats()
+			if err := tree.Insert(key); err != nil {
+				outcomes[i] = fmt.Sprintf("%s rejects it: %v", tree.Split.Policy, err)
+				continue
+			}
+			after := tree.Stats()
+			outcomes[i] = fmt.Sprintf("%s has %d nodes at %.0f%% average fill", tree.Split.Policy, after.Nodes, after.AvgFill*100)
+			if splits := after.Splits - before.Splits; splits > 0 {
+				outcomes[i] += fmt.Sprintf(" after %d split(s)", splits)
+			}
+			if nodeID, _, found := tree.Search(key); found {
+				highlights = append(highlights, protocol.Highlight{Type: "node", ID: treeNodeID(i, nodeID), Color: "#10b981", Animation: "pulse"})
+			}
+		}
+		sim.addStep(fmt.Sprintf("Insert %s", key),
+			fmt.Sprintf("Inserted %s: %s; %s", key, outcomes[0], outcomes[1]),
+			highlights, sim.GetVisualizationData())
+	}
+
+	sa, sb := a.Stats(), b.Stats()
+	sim.addStep("Comparison",
+		fmt.Sprintf("%s: %d nodes, height %d, %.0f%% average fill, %d splits. %s: %d nodes, height %d, %.0f%% average fill, %d splits",
+			a.Split.Policy, sa.Nodes, sa.Height, sa.AvgFill*100, sa.Splits,
+			b.Split.Policy, sb.Nodes, sb.Height, sb.AvgFill*100, sb.Splits),
+		[]protocol.Highlight{}, sim.GetVisualizationData())
+}
+
+// treeNodeID prefixes a node ID with its tree's position, since both trees
+// number their nodes the same way
+func treeNodeID(tree int, nodeID string) string {
+	return fmt.Sprintf("tree-%d/%s", tree, nodeID)
+}
+
+func (sim *SplitPolicySimulation) treesData() []map[string]interface{} {
+	trees := make([]map[string]interface{}, 0, len(sim.trees))
+	for i, tree := range sim.trees {
+		nodes := make(map[string]interface{})
+		for id, node := range tree.Nodes {
+			children := make([]string, len(node.Children))
+			for j, child := range node.Children {
+				children[j] = treeNodeID(i, child)
+			}
+			nodes[treeNodeID(i, id)] = map[string]interface{}{
+				"id":       treeNodeID(i, node.ID),
+				"keys":     append([]internal.Key{}, node.Keys...),
+				"children": children,
+				"isLeaf":   node.IsLeaf,
+			}
+		}
+		rootID := ""
+		if tree.RootID != "" {
+			rootID = treeNodeID(i, tree.RootID)
+		}
+		trees = append(trees, map[string]interface{}{
+			"policy":     tree.Split,
+			"nodes":      nodes,
+			"rootId":     rootID,
+			"order":      tree.Order,
+			"keyType":    sim.keyKind,
+			"stats":      tree.Stats(),
+			"invariants": tree.CheckInvariants(),
+		})
+	}
+	return trees
+}
+
+func (sim *SplitPolicySimulation) addStep(title, description string, highlights []protocol.Highlight, data map[string]interface{}) {
+	step := engine.Step{
+		Index:       len(sim.steps),
+		Title:       title,
+		Description: description,
+		Highlights:  highlights,
+		Data:        data,
+	}
+	sim.steps = append(sim.steps, step)
+}
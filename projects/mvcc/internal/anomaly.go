@@ -0,0 +1,556 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Dependency kinds of the serialization graph
+const (
+	DepWriteWrite = "ww" // To installed the version after one From installed
+	DepWriteRead  = "wr" // To read a version From installed
+	DepReadWrite  = "rw" // To installed the version after the one From read
+)
+
+// Dependency is an edge From -> To of the serialization graph: From must
+// come before To in any equivalent serial order
+type Dependency struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Kind      string `json:"kind"`
+	RowID     string `json:"rowId"`
+	Predicate string `json:"predicate,omitempty"` // Prefix of a scan that did not find the row To inserted
+}
+
+// EdgeID identifies the From -> To edge, as RWConflict.EdgeID does
+func (d Dependency) EdgeID() string {
+	return d.From + "->" + d.To
+}
+
+func (d Dependency) String() string {
+	text := fmt.Sprintf("%s -%s-> %s on %s", d.From, d.Kind, d.To, d.RowID)
+	if d.Predicate != "" {
+		text += fmt.Sprintf(" (scan of %s)", d.Predicate)
+	}
+	return text
+}
+
+// AnomalyKind names an anomaly the checker recognizes
+type AnomalyKind string
+
+const (
+	AnomalyDirtyRead         AnomalyKind = "dirty-read"
+	AnomalyNonRepeatableRead AnomalyKind = "non-repeatable-read"
+	AnomalyPhantom           AnomalyKind = "phantom"
+	AnomalyLostUpdate        AnomalyKind = "lost-update"
+	AnomalyWriteSkew         AnomalyKind = "write-skew"
+	AnomalyReadOnly          AnomalyKind = "read-only-anomaly"
+	// AnomalyCycle is any other cycle in the serialization graph
+	AnomalyCycle AnomalyKind = "dependency-cycle"
+)
+
+var anomalyTitles = map[AnomalyKind]string{
+	AnomalyDirtyRead:         "Dirty Read",
+	AnomalyNonRepeatableRead: "Non-Repeatable Read",
+	AnomalyPhantom:           "Phantom",
+	AnomalyLostUpdate:        "Lost Update",
+	AnomalyWriteSkew:         "Write Skew",
+	AnomalyReadOnly:          "Read-Only Anomaly",
+	AnomalyCycle:             "Dependency Cycle",
+}
+
+// Title returns the kind as a heading, e.g. Write Skew
+func (k AnomalyKind) Title() string {
+	return anomalyTitles[k]
+}
+
+// preventedBy is the weakest level that rules each anomaly out. Snapshot
+// isolation is stronger than ANSI REPEATABLE READ: the transaction snapshot
+// hides phantoms, and write-write conflicts stop lost updates.
+var preventedBy = map[AnomalyKind]IsolationLevel{
+	AnomalyDirtyRead:         ReadCommitted,
+	AnomalyNonRepeatableRead: RepeatableRead,
+	AnomalyPhantom:           RepeatableRead,
+	AnomalyLostUpdate:        RepeatableRead,
+	AnomalyWriteSkew:         Serializable,
+	AnomalyReadOnly:          Serializable,
+	AnomalyCycle:             Serializable,
+}
+
+// Anomaly is one anomaly that occurred in a history
+type Anomaly struct {
+	Kind         AnomalyKind    `json:"kind"`
+	Transactions []string       `json:"transactions"`
+	RowID        string         `json:"rowId,omitempty"` // Row, or the prefix of a scan
+	Isolation    IsolationLevel `json:"isolation"`       // Weakest level among the transactions that let it happen
+	Allowed      bool           `json:"allowed"`         // Isolation permits it; if not, it is a bug
+	Description  string         `json:"description"`
+}
+
+// HistoryReport is the serialization graph of a history and the anomalies
+// found in it
+type HistoryReport struct {
+	Transactions []string     `json:"transactions"` // Committed, in commit order
+	ReadOnly     []string     `json:"readOnly"`
+	Dependencies []Dependency `json:"dependencies"`
+	Cycles       [][]string   `json:"cycles"`
+	Anomalies    []Anomaly    `json:"anomalies"`
+	// Serializable is true when the graph has no cycle and no transaction
+	// read data of one that aborted
+	Serializable bool     `json:"serializable"`
+	SerialOrder  []string `json:"serialOrder,omitempty"` // An equivalent serial order, when Serializable
+}
+
+// historyChecker builds a HistoryReport from the store's history
+type historyChecker struct {
+	s         *MVCCStore
+	report    HistoryReport
+	committed map[string]int            // Transaction -> its place in commit order
+	installs  map[string][]string       // Row -> committed transactions that changed it, in commit order
+	position  map[string]map[string]int // Row -> transaction -> its place in installs
+	edges     map[Dependency]bool
+}
+
+// CheckHistory builds the serialization graph of the committed transactions
+// from the executed history and reports the anomalies that occurred, each
+// with the isolation level that allowed it. The graph has a ww edge between
+// consecutive committed versions of a row, a wr edge from the writer of a
+// version to each transaction that read it, and an rw anti-dependency from
+// a reader to the transaction that installed the next version of what it
+// read, or the first version of a row its scan did not find.
+func (s *MVCCStore) CheckHistory() HistoryReport {
+	c := &historyChecker{
+		s: s,
+		report: HistoryReport{
+			Transactions: []string{},
+			ReadOnly:     []string{},
+			Dependencies: []Dependency{},
+			Cycles:       [][]string{},
+			Anomalies:    []Anomaly{},
+		},
+		committed: map[string]int{},
+		installs:  map[string][]string{},
+		position:  map[string]map[string]int{},
+		edges:     map[Dependency]bool{},
+	}
+	c.order()
+	c.dependencies()
+	c.findCycles()
+	c.readAnomalies()
+	c.lostUpdates()
+	c.cycleAnomalies()
+	c.verdict()
+	return c.report
+}
+
+// order lists the committed transactions and the order in which they
+// installed each row's versions. A transaction's writes in a subtransaction
+// that rolled back never count.
+func (c *historyChecker) order() {
+	for i := 1; i <= c.s.txSeq; i++ {
+		if tx := c.s.Transactions[fmt.Sprintf("tx-%d", i)]; tx != nil && tx.Status == TxCommitted {
+			c.report.Transactions = append(c.report.Transactions, tx.ID)
+		}
+	}
+	sort.SliceStable(c.report.Transactions, func(i, j int) bool {
+		return *c.s.Transactions[c.report.Transactions[i]].CommitTime < *c.s.Transactions[c.report.Transactions[j]].CommitTime
+	})
+	for i, id := range c.report.Transactions {
+		c.committed[id] = i
+	}
+
+	writers := map[string]bool{}
+	for _, event := range c.s.History {
+		if event.Op != OpWrite && event.Op != OpDelete {
+			continue
+		}
+		if _, ok := c.committed[event.TxID]; !ok {
+			continue
+		}
+		if sub := c.s.Transactions[event.TxID].subxact(event.Subxact); sub != nil && sub.Status == SubxactAborted {
+			continue
+		}
+		writers[event.TxID] = true
+		if !contains(c.installs[event.RowID], event.TxID) {
+			c.installs[event.RowID] = append(c.installs[event.RowID], event.TxID)
+		}
+	}
+	for rowID, txs := range c.installs {
+		sort.SliceStable(txs, func(i, j int) bool { return c.committed[txs[i]] < c.committed[txs[j]] })
+		c.position[rowID] = map[string]int{}
+		for i, id := range txs {
+			c.position[rowID][id] = i
+		}
+	}
+	for _, id := range c.report.Transactions {
+		if !writers[id] {
+			c.report.ReadOnly = append(c.report.ReadOnly, id)
+		}
+	}
+}
+
+func (c *historyChecker) addEdge(d Dependency) {
+	if d.From == d.To || c.edges[d] {
+		return
+	}
+	c.edges[d] = true
+	c.report.Dependencies = append(c.report.Dependencies, d)
+}
+
+// dependencies adds the edges of the graph
+func (c *historyChecker) dependencies() {
+	for _, rowID := range sortedKeys(c.installs) {
+		txs := c.installs[rowID]
+		for i := 1; i < len(txs); i++ {
+			c.addEdge(Dependency{From: txs[i-1], To: txs[i], Kind: DepWriteWrite, RowID: rowID})
+		}
+	}
+
+	for _, event := range c.s.History {
+		if _, ok := c.committed[event.TxID]; !ok || (event.Op != OpRead && event.Op != OpScan) {
+			continue
+		}
+		found := map[string]bool{}
+		for _, read := range event.Reads {
+			found[read.RowID] = true
+			pos, ok := c.position[read.RowID][read.Writer]
+			if !ok || read.Writer == event.TxID {
+				continue
+			}
+			c.addEdge(Dependency{From: read.Writer, To: event.TxID, Kind: DepWriteRead, RowID: read.RowID})
+			if txs := c.installs[read.RowID]; pos+1 < len(txs) {
+				c.addEdge(Dependency{From: event.TxID, To: txs[pos+1], Kind: DepReadWrite, RowID: read.RowID})
+			}
+		}
+		if event.Op != OpScan {
+			continue
+		}
+		// A row the scan did not find was inserted by the first transaction
+		// whose change its snapshot could not see
+		for _, rowID := range sortedKeys(c.installs) {
+			if found[rowID] || !strings.HasPrefix(rowID, event.RowID) {
+				continue
+			}
+			for _, id := range c.installs[rowID] {
+				if *c.s.Transactions[id].CommitTime > event.Snapshot {
+					c.addEdge(Dependency{From: event.TxID, To: id, Kind: DepReadWrite, RowID: rowID, Predicate: event.RowID})
+					break
+				}
+			}
+		}
+	}
+}
+
+// findCycles lists every elementary cycle of the graph once, starting from
+// its earliest committed transaction
+func (c *historyChecker) findCycles() {
+	next := map[string][]string{}
+	for _, d := range c.report.Dependencies {
+		if !contains(next[d.From], d.To) {
+			next[d.From] = append(next[d.From], d.To)
+		}
+	}
+	for _, targets := range next {
+		sort.Slice(targets, func(i, j int) bool { return c.committed[targets[i]] < c.committed[targets[j]] })
+	}
+
+	var walk func(start string, path []string)
+	walk = func(start string, path []string) {
+		for _, to := range next[path[len(path)-1]] {
+			switch {
+			case to == start:
+				c.report.Cycles = append(c.report.Cycles, append([]string{}, path...))
+			case c.committed[to] > c.committed[start] && !contains(path, to):
+				walk(start, append(path, to))
+			}
+		}
+	}
+	for _, id := range c.report.Transactions {
+		walk(id, []string{id})
+	}
+}
+
+// weakest returns the weakest isolation level among txIDs
+func (c *historyChecker) weakest(txIDs ...string) IsolationLevel {
+	weakest := Serializable
+	for _, id := range txIDs {
+		if level := c.s.Transactions[id].Isolation; levelIndex(level) < levelIndex(weakest) {
+			weakest = level
+		}
+	}
+	return weakest
+}
+
+func levelIndex(level IsolationLevel) int {
+	for i, l := range IsolationLevels {
+		if l == level {
+			return i
+		}
+	}
+	return len(IsolationLevels)
+}
+
+// addAnomaly records an anomaly, judging it against the weakest level of
+// the transactions at fault
+func (c *historyChecker) addAnomaly(kind AnomalyKind, txIDs []string, rowID string, atFault []string, description string) {
+	level := c.weakest(atFault...)
+	allowed := levelIndex(level) < levelIndex(preventedBy[kind])
+	if allowed {
+		description += fmt.Sprintf(". %s allows it", level.SQL())
+	} else {
+		description += fmt.Sprintf(". %s should have prevented it", level.SQL())
+	}
+	c.report.Anomalies = append(c.report.Anomalies, Anomaly{
+		Kind:         kind,
+		Transactions: txIDs,
+		RowID:        rowID,
+		Isolation:    level,
+		Allowed:      allowed,
+		Description:  description,
+	})
+}
+
+// readAnomalies finds what committed transactions read: dirty reads, rows
+// that changed between two reads and scans whose rows changed between two
+// scans of the same prefix
+func (c *historyChecker) readAnomalies() {
+	type seen struct {
+		read  ItemRead
+		event HistoryEvent
+	}
+	lastRead := map[string]map[string]seen{}         // Transaction -> row -> its last read of it
+	lastScan := map[string]map[string]HistoryEvent{} // Transaction -> prefix -> its last scan of it
+	reported := map[string]bool{}
+
+	for _, event := range c.s.History {
+		reader := event.TxID
+		if _, ok := c.committed[reader]; !ok || (event.Op != OpRead && event.Op != OpScan) {
+			continue
+		}
+		if lastRead[reader] == nil {
+			lastRead[reader], lastScan[reader] = map[string]seen{}, map[string]HistoryEvent{}
+		}
+
+		for _, read := range event.Reads {
+			if read.Uncommitted && !reported[reader+" dirty "+read.Version] {
+				reported[reader+" dirty "+read.Version] = true
+				description := fmt.Sprintf("%s read %s of %s while %s, which wrote it, had not committed", reader, read.Version, read.RowID, read.Writer)
+				if c.s.Transactions[read.Writer].Status == TxAborted {
+					description += fmt.Sprintf(". %s then aborted, so %s saw data that never existed", read.Writer, reader)
+				}
+				c.addAnomaly(AnomalyDirtyRead, []string{read.Writer, reader}, read.RowID, []string{reader}, description)
+			}
+			if read.Deleted {
+				continue
+			}
+			prev, ok := lastRead[reader][read.RowID]
+			lastRead[reader][read.RowID] = seen{read, event}
+			if !ok || prev.read.Version == read.Version || read.Writer == reader || reported[reader+" fuzzy "+read.RowID] {
+				continue
+			}
+			reported[reader+" fuzzy "+read.RowID] = true
+			c.addAnomaly(AnomalyNonRepeatableRead, []string{reader, read.Writer}, read.RowID, []string{reader},
+				fmt.Sprintf("%s read %s twice: first %s, then %s, which %s wrote in between", reader, read.RowID, prev.read.Version, read.Version, read.Writer))
+		}
+
+		if event.Op != OpScan {
+			continue
+		}
+		prev, ok := lastScan[reader][event.RowID]
+		lastScan[reader][event.RowID] = event
+		if !ok || reported[reader+" phantom "+event.RowID] {
+			continue
+		}
+		before, after := scannedRows(prev), scannedRows(event)
+		changes, writers := []string{}, []string{}
+		for _, read := range event.Reads {
+			_, was := before[read.RowID]
+			switch {
+			case read.Writer == reader:
+				continue
+			case !read.Deleted && !was:
+				changes = append(changes, fmt.Sprintf("%s appeared, inserted by %s", read.RowID, read.Writer))
+			case read.Deleted && was:
+				changes = append(changes, fmt.Sprintf("%s vanished, deleted by %s", read.RowID, read.Writer))
+			default:
+				continue
+			}
+			if !contains(writers, read.Writer) {
+				writers = append(writers, read.Writer)
+			}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		reported[reader+" phantom "+event.RowID] = true
+		c.addAnomaly(AnomalyPhantom, append([]string{reader}, writers...), event.RowID, []string{reader},
+			fmt.Sprintf("%s scanned %s twice and found %d row(s), then %d: %s", reader, event.RowID, len(before), len(after), strings.Join(changes, ", ")))
+	}
+}
+
+// scannedRows returns the rows a scan found, by row ID
+func scannedRows(event HistoryEvent) map[string]string {
+	rows := map[string]string{}
+	for _, read := range event.Reads {
+		if !read.Deleted {
+			rows[read.RowID] = read.Version
+		}
+	}
+	return rows
+}
+
+// lostUpdates finds transactions that read a row and then overwrote it
+// although another transaction had changed it in between, so that change
+// was silently lost
+func (c *historyChecker) lostUpdates() {
+	for _, id := range c.report.Transactions {
+		lastRead := map[string]ItemRead{}
+		checked := map[string]bool{}
+		for _, event := range c.s.History {
+			if event.TxID != id {
+				continue
+			}
+			switch event.Op {
+			case OpRead, OpScan:
+				for _, read := range event.Reads {
+					if !checked[read.RowID] {
+						lastRead[read.RowID] = read
+					}
+				}
+			case OpWrite, OpDelete:
+				read, ok := lastRead[event.RowID]
+				if !ok || checked[event.RowID] {
+					continue
+				}
+				checked[event.RowID] = true
+				from, ok := c.position[event.RowID][read.Writer]
+				to, wrote := c.position[event.RowID][id]
+				if !ok || !wrote || from >= to {
+					continue
+				}
+				for _, lost := range c.installs[event.RowID][from+1 : to] {
+					c.addAnomaly(AnomalyLostUpdate, []string{id, lost}, event.RowID, []string{id},
+						fmt.Sprintf("%s read %s as %s left it and then overwrote it, but %s changed it in between, so %s's update is lost",
+							id, event.RowID, read.Writer, lost, lost))
+				}
+			}
+		}
+	}
+}
+
+// between returns the dependencies from a to b
+func (c *historyChecker) between(a, b string) []Dependency {
+	deps := []Dependency{}
+	for _, d := range c.report.Dependencies {
+		if d.From == a && d.To == b {
+			deps = append(deps, d)
+		}
+	}
+	return deps
+}
+
+// cycleAnomalies classifies the cycles that no anomaly found so far
+// explains. A cycle through a read-only transaction is the read-only
+// anomaly, since such a transaction has only rw edges out; two transactions
+// joined only by rw anti-dependencies are write skew.
+func (c *historyChecker) cycleAnomalies() {
+	for _, cycle := range c.report.Cycles {
+		if c.explained(cycle) {
+			continue
+		}
+		edges := []string{}
+		rwOnly := true
+		for i, from := range cycle {
+			for _, d := range c.between(from, cycle[(i+1)%len(cycle)]) {
+				edges = append(edges, d.String())
+				rwOnly = rwOnly && d.Kind == DepReadWrite
+			}
+		}
+		path := fmt.Sprintf("the cycle %s -> %s: %s", strings.Join(cycle, " -> "), cycle[0], strings.Join(edges, ", "))
+
+		readOnly := ""
+		for _, id := range cycle {
+			if contains(c.report.ReadOnly, id) {
+				readOnly = id
+				break
+			}
+		}
+		switch {
+		case readOnly != "":
+			c.addAnomaly(AnomalyReadOnly, cycle, "", cycle,
+				fmt.Sprintf("%s only read, yet it saw a state no serial order produces, closing %s", readOnly, path))
+		case len(cycle) == 2 && rwOnly:
+			c.addAnomaly(AnomalyWriteSkew, cycle, "", cycle,
+				fmt.Sprintf("%s and %s each read what the other then changed, and neither saw the other's write, forming %s", cycle[0], cycle[1], path))
+		default:
+			c.addAnomaly(AnomalyCycle, cycle, "", cycle, fmt.Sprintf("No serial order satisfies %s", path))
+		}
+	}
+}
+
+// explained reports whether an anomaly already found involves exactly the
+// transactions of cycle
+func (c *historyChecker) explained(cycle []string) bool {
+	for _, a := range c.report.Anomalies {
+		if len(a.Transactions) != len(cycle) {
+			continue
+		}
+		same := true
+		for _, id := range cycle {
+			same = same && contains(a.Transactions, id)
+		}
+		if same {
+			return true
+		}
+	}
+	return false
+}
+
+// verdict decides whether the history is serializable and, if it is, finds
+// an equivalent serial order by sorting the graph topologically, taking
+// transactions in commit order where the graph leaves a choice
+func (c *historyChecker) verdict() {
+	for _, a := range c.report.Anomalies {
+		if a.Kind == AnomalyDirtyRead && c.s.Transactions[a.Transactions[0]].Status == TxAborted {
+			return
+		}
+	}
+	if len(c.report.Cycles) > 0 {
+		return
+	}
+	c.report.Serializable = true
+
+	incoming := map[string]int{}
+	next := map[string][]string{}
+	for d := range c.edges {
+		if !contains(next[d.From], d.To) {
+			next[d.From] = append(next[d.From], d.To)
+			incoming[d.To]++
+		}
+	}
+	order := []string{}
+	done := map[string]bool{}
+	for len(order) < len(c.report.Transactions) {
+		for _, id := range c.report.Transactions {
+			if !done[id] && incoming[id] == 0 {
+				done[id] = true
+				order = append(order, id)
+				for _, to := range next[id] {
+					incoming[to]--
+				}
+				break
+			}
+		}
+	}
+	c.report.SerialOrder = order
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrHistoryRemoved is returned by reads as of a timestamp before the GC
+// threshold, where VACUUM may have removed versions the read needs
+var ErrHistoryRemoved = errors.New("history removed by VACUUM")
+
+// explainAsOf decides whether ver was the committed state of its row at ts.
+// Reads as of a timestamp see what a snapshot taken then would have: only
+// commit times count, never when a write was made.
+func (s *MVCCStore) explainAsOf(ver *Version, ts int64) Visibility {
+	creator := s.Transactions[ver.CreatedBy]
+	switch {
+	case creator.Status != TxCommitted:
+		return Visibility{Visible: false, Rule: RuleUncommitted, Reason: fmt.Sprintf("Created by %s, which has not committed", ver.CreatedBy)}
+	case *creator.CommitTime > ts:
+		return Visibility{Visible: false, Rule: RuleCommittedAfter, Reason: fmt.Sprintf("Committed by %s at %d, after %d", ver.CreatedBy, *creator.CommitTime, ts)}
+	}
+	created := Visibility{Visible: true, Rule: RuleCommittedBefore, Reason: fmt.Sprintf("Committed by %s at %d, at or before %d", ver.CreatedBy, *creator.CommitTime, ts)}
+	if ver.DeletedBy == nil {
+		return created
+	}
+	deleter := s.Transactions[*ver.DeletedBy]
+	switch {
+	case deleter.Status != TxCommitted:
+		return created
+	case *deleter.CommitTime > ts:
+		created.Rule = RuleDeletedInvisibly
+		created.Reason += fmt.Sprintf(". %s deleted it, but committed at %d", *ver.DeletedBy, *deleter.CommitTime)
+		return created
+	}
+	return Visibility{Visible: false, Rule: RuleDeleted, Reason: fmt.Sprintf("Deleted by %s, committed at %d, at or before %d", *ver.DeletedBy, *deleter.CommitTime, ts)}
+}
+
+// checkAsOf rejects timestamps in the future and before the GC threshold
+func (s *MVCCStore) checkAsOf(ts int64) error {
+	if ts > s.GlobalTimestamp {
+		return fmt.Errorf("timestamp %d is in the future; the latest is %d", ts, s.GlobalTimestamp)
+	}
+	if ts < s.GCThreshold {
+		return fmt.Errorf("timestamp %d is before the GC threshold %d: %w", ts, s.GCThreshold, ErrHistoryRemoved)
+	}
+	return nil
+}
+
+// ReadAsOf returns the version of a row that was committed at timestamp ts,
+// outside any transaction
+func (s *MVCCStore) ReadAsOf(rowID string, ts int64) (*Version, error) {
+	ver, _, err := s.ReadAsOfExplained(rowID, ts)
+	return ver, err
+}
+
+// ReadAsOfExplained reads like ReadAsOf, and also returns the check of every
+// version it examined, newest first
+func (s *MVCCStore) ReadAsOfExplained(rowID string, ts int64) (*Version, []VersionCheck, error) {
+	if err := s.checkAsOf(ts); err != nil {
+		return nil, nil, err
+	}
+	row, ok := s.Rows[rowID]
+	if !ok {
+		return nil, nil, fmt.Errorf("row %s not found", rowID)
+	}
+
+	checks := []VersionCheck{}
+	for _, verID := range row.VersionChain {
+		ver := s.Versions[verID]
+		visibility := s.explainAsOf(ver, ts)
+		checks = append(checks, VersionCheck{VersionID: verID, Visibility: visibility})
+		switch {
+		case visibility.Visible:
+			return ver, checks, nil
+		case visibility.Rule == RuleDeleted:
+			return nil, checks, fmt.Errorf("row %s was deleted by %s at timestamp %d", rowID, *ver.DeletedBy, ts)
+		}
+	}
+	return nil, checks, fmt.Errorf("row %s did not exist at timestamp %d", rowID, ts)
+}
+
+// ScanAsOf returns the version of every row that existed at timestamp ts, by
+// row ID
+func (s *MVCCStore) ScanAsOf(ts int64) ([]*Version, error) {
+	if err := s.checkAsOf(ts); err != nil {
+		return nil, err
+	}
+	versions := []*Version{}
+	for _, rowID := range sortedRowIDs(s.Rows) {
+		if ver, _, err := s.ReadAsOfExplained(rowID, ts); err == nil {
+			versions = append(versions, ver)
+		}
+	}
+	return versions, nil
+}
+
+// CommittedAt returns the transactions that committed at timestamp ts
+func (s *MVCCStore) CommittedAt(ts int64) []string {
+	committed := []string{}
+	for i := 1; i <= s.txSeq; i++ {
+		if tx := s.Transactions[fmt.Sprintf("tx-%d", i)]; tx != nil && tx.CommitTime != nil && *tx.CommitTime == ts {
+			committed = append(committed, tx.ID)
+		}
+	}
+	return committed
+}
@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ConflictMode selects how the store resolves two transactions writing the
+// same row
+type ConflictMode string
+
+const (
+	// FirstUpdaterWins rejects a write to a row that a concurrent transaction
+	// has already written, as PostgreSQL does. With Blocking, a writer that
+	// finds the row held by an active transaction waits for it instead.
+	FirstUpdaterWins ConflictMode = "first-updater-wins"
+	// FirstCommitterWins lets concurrent writes proceed and fails the commit
+	// of any transaction whose rows another transaction committed first
+	FirstCommitterWins ConflictMode = "first-committer-wins"
+)
+
+// ErrSerializationFailure is PostgreSQL's SQLSTATE 40001. The transaction
+// that gets it has been aborted and must be retried.
+var ErrSerializationFailure = errors.New("could not serialize access due to concurrent update")
+
+// ErrDeadlock is returned when waiting would close a cycle of transactions
+// waiting on each other. The transaction that would wait is aborted.
+var ErrDeadlock = errors.New("deadlock detected")
+
+// ErrConcurrentDelete is returned when tx deletes a version another
+// transaction has already deleted, outside FirstCommitterWins. Like
+// ErrSerializationFailure, it aborts tx.
+var ErrConcurrentDelete = errors.New("could not serialize access due to concurrent delete")
+
+// ErrWouldBlock is returned by writes that must wait for another
+// transaction to finish
+var ErrWouldBlock = errors.New("row is locked by another transaction")
+
+// ConflictError is a write-write conflict on RowID between TxID and Holder
+type ConflictError struct {
+	TxID   string `json:"txId"`
+	RowID  string `json:"rowId"`
+	Holder string `json:"holder"`
+	Err    error  `json:"-"` // ErrSerializationFailure, ErrConcurrentDelete, ErrDependencies, ErrDeadlock or ErrWouldBlock
+	// Structure is the dangerous structure behind an ErrDependencies failure
+	Structure *DangerousStructure `json:"structure,omitempty"`
+}
+
+func (e *ConflictError) Error() string {
+	switch e.Err {
+	case ErrWouldBlock:
+		return fmt.Sprintf("%s waits for %s, which holds row %s", e.TxID, e.Holder, e.RowID)
+	case ErrDependencies:
+		return fmt.Sprintf("%s: %s is in %s and %s has committed; %s is aborted", e.Err, e.TxID, e.Structure, e.Holder, e.TxID)
+	case ErrConcurrentDelete:
+		return fmt.Sprintf("%s: %s deleted row %s first; %s is aborted", e.Err, e.Holder, e.RowID, e.TxID)
+	case ErrDeadlock:
+		return fmt.Sprintf("%s: %s waits for %s on row %s, which already waits for %s; %s is aborted",
+			e.Err, e.TxID, e.Holder, e.RowID, e.TxID, e.TxID)
+	}
+	return fmt.Sprintf("%s: %s wrote row %s after the snapshot of %s, which is aborted", e.Err, e.Holder, e.RowID, e.TxID)
+}
+
+func (e *ConflictError) Unwrap() []error {
+	if e.Err == ErrDependencies || e.Err == ErrConcurrentDelete {
+		return []error{e.Err, ErrSerializationFailure}
+	}
+	return []error{e.Err}
+}
+
+// checkWrite looks for a transaction that conflicts with tx writing row.
+// Under FirstUpdaterWins the newest version must not be written or deleted
+// by another active transaction, nor, unless tx's level takes a snapshot per
+// statement, by one that committed after tx's snapshot. A conflict aborts tx
+// unless it can wait.
+func (s *MVCCStore) checkWrite(tx *Transaction, row *Row) error {
+	tx.WaitingFor = ""
+	if s.ConflictMode == FirstCommitterWins || len(row.VersionChain) == 0 {
+		return nil
+	}
+	head := s.Versions[row.VersionChain[0]]
+
+	writers := []string{head.CreatedBy}
+	if head.DeletedBy != nil {
+		writers = append(writers, *head.DeletedBy)
+	}
+	for _, writer := range writers {
+		if writer == tx.ID {
+			continue
+		}
+		other := s.Transactions[writer]
+		switch {
+		case other.Status == TxActive:
+			if !s.Blocking {
+				return s.fail(tx, row.ID, writer, ErrSerializationFailure)
+			}
+			if s.waitsFor(writer, tx.ID) {
+				return s.fail(tx, row.ID, writer, ErrDeadlock)
+			}
+			tx.WaitingFor = writer
+			return &ConflictError{TxID: tx.ID, RowID: row.ID, Holder: writer, Err: ErrWouldBlock}
+		case other.Status == TxCommitted && !tx.Isolation.statementSnapshot() && *other.CommitTime > tx.Snapshot.Timestamp:
+			return s.fail(tx, row.ID, writer, ErrSerializationFailure)
+		}
+	}
+	return nil
+}
+
+// checkCommit applies FirstCommitterWins: tx fails if another transaction
+// committed a write to one of its rows after tx's snapshot. Levels with a
+// snapshot per statement write over the newest version and are exempt.
+func (s *MVCCStore) checkCommit(tx *Transaction) error {
+	if s.ConflictMode != FirstCommitterWins || tx.Isolation.statementSnapshot() {
+		return nil
+	}
+	for _, rowID := range tx.WriteSet {
+		row := s.Rows[rowID]
+		if row == nil {
+			continue
+		}
+		for _, verID := range row.VersionChain {
+			ver := s.Versions[verID]
+			writers := []string{ver.CreatedBy}
+			if ver.DeletedBy != nil {
+				writers = append(writers, *ver.DeletedBy)
+			}
+			for _, writer := range writers {
+				other := s.Transactions[writer]
+				if writer != tx.ID && other.Status == TxCommitted && *other.CommitTime > tx.StartTime {
+					return s.fail(tx, rowID, writer, ErrSerializationFailure)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// CompetingDelete is one transaction's delete of a version
+type CompetingDelete struct {
+	TxID    string `json:"txId"`
+	At      int64  `json:"at"`
+	Subxact string `json:"subxact,omitempty"`
+	Xid     uint32 `json:"xid"`
+	Cid     int    `json:"cid"`
+}
+
+// markDeleted makes d the delete ver carries
+func (ver *Version) markDeleted(d CompetingDelete) {
+	ver.DeletedBy = &d.TxID
+	ver.DeletedAt = &d.At
+	ver.DeletedIn = d.Subxact
+	ver.Header.setXmax(d.Xid, d.Cid)
+}
+
+// competingDelete returns txID's delete of ver if it competes with the one
+// ver carries
+func (ver *Version) competingDelete(txID string) *CompetingDelete {
+	for i := range ver.CompetingDeletes {
+		if ver.CompetingDeletes[i].TxID == txID {
+			return &ver.CompetingDeletes[i]
+		}
+	}
+	return nil
+}
+
+// dropDeletes undoes the deletes of ver that rolled back. When the delete
+// ver carries is one of them, the oldest competing delete takes its place.
+func (ver *Version) dropDeletes(rolledBack func(CompetingDelete) bool) {
+	var kept []CompetingDelete
+	for _, d := range ver.CompetingDeletes {
+		if !rolledBack(d) {
+			kept = append(kept, d)
+		}
+	}
+	if ver.DeletedBy != nil && rolledBack(CompetingDelete{TxID: *ver.DeletedBy, Subxact: ver.DeletedIn}) {
+		ver.DeletedBy, ver.DeletedAt, ver.DeletedIn = nil, nil, ""
+		if len(kept) > 0 {
+			ver.markDeleted(kept[0])
+			kept = kept[1:]
+		}
+	}
+	ver.CompetingDeletes = kept
+}
+
+// settleDeletes runs as tx commits under FirstCommitterWins: each version
+// tx deleted in competition now carries tx's delete, and the delete it
+// displaces fails when its transaction tries to commit
+func (s *MVCCStore) settleDeletes(tx *Transaction) {
+	for _, rowID := range tx.WriteSet {
+		row := s.Rows[rowID]
+		if row == nil {
+			continue
+		}
+		for _, verID := range row.VersionChain {
+			ver := s.Versions[verID]
+			d := ver.competingDelete(tx.ID)
+			if d == nil {
+				continue
+			}
+			won := *d
+			*d = CompetingDelete{TxID: *ver.DeletedBy, At: *ver.DeletedAt, Subxact: ver.DeletedIn, Xid: ver.Header.Xmax, Cid: ver.Header.Cmax}
+			ver.markDeleted(won)
+		}
+	}
+}
+
+// waitsFor reports whether from waits, directly or through other waiting
+// transactions, for to
+func (s *MVCCStore) waitsFor(from, to string) bool {
+	seen := map[string]bool{}
+	for from != "" && !seen[from] {
+		if from == to {
+			return true
+		}
+		seen[from] = true
+		from = s.Transactions[from].WaitingFor
+	}
+	return false
+}
+
+// fail aborts tx and returns the conflict that caused it
+func (s *MVCCStore) fail(tx *Transaction, rowID, holder string, err error) error {
+	s.Abort(tx.ID)
+	return &ConflictError{TxID: tx.ID, RowID: rowID, Holder: holder, Err: err}
+}
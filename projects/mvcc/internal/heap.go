@@ -0,0 +1,268 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VisibilityModel selects how the store decides which versions a transaction
+// sees
+type VisibilityModel string
+
+const (
+	// ModelTimestamp compares commit timestamps against the snapshot timestamp
+	ModelTimestamp VisibilityModel = "timestamp"
+	// ModelPostgres follows PostgreSQL's HeapTupleSatisfiesMVCC: tuple headers
+	// carry xmin and xmax, the commit log records each transaction's state,
+	// and a snapshot is xmin, xmax and the list of in-progress transactions.
+	// READ UNCOMMITTED behaves as READ COMMITTED, as in PostgreSQL.
+	ModelPostgres VisibilityModel = "postgres"
+)
+
+// XidStatus is a transaction's state in the commit log
+type XidStatus string
+
+const (
+	XidInProgress XidStatus = "in-progress"
+	XidCommitted  XidStatus = "committed"
+	XidAborted    XidStatus = "aborted"
+	// XidSubCommitted is a released subtransaction whose transaction is
+	// still in progress: readers treat it as in progress
+	XidSubCommitted XidStatus = "sub-committed"
+)
+
+// Hint bits, cached in t_infomask the first time a reader resolves xmin or
+// xmax through the commit log
+const (
+	HeapXminCommitted = "HEAP_XMIN_COMMITTED"
+	HeapXminInvalid   = "HEAP_XMIN_INVALID"
+	HeapXmaxCommitted = "HEAP_XMAX_COMMITTED"
+	HeapXmaxInvalid   = "HEAP_XMAX_INVALID"
+)
+
+// TupleHeader is the part of a PostgreSQL heap tuple header that MVCC uses,
+// as pageinspect's heap_page_items shows it. Transaction IDs are the sequence
+// numbers of the store's transactions, so tx-3 is xid 3.
+type TupleHeader struct {
+	Xmin     uint32   `json:"xmin"`
+	Xmax     uint32   `json:"xmax"` // 0 until a transaction updates or deletes the tuple
+	Cmin     int      `json:"cmin"`
+	Cmax     int      `json:"cmax"`
+	Ctid     string   `json:"ctid"`     // This tuple, or the version that replaced it
+	Infomask []string `json:"infomask"` // Hint bits
+}
+
+func (h *TupleHeader) hasHint(hint string) bool {
+	return contains(h.Infomask, hint)
+}
+
+func (h *TupleHeader) setHint(hint string) {
+	if !h.hasHint(hint) {
+		h.Infomask = append(h.Infomask, hint)
+		sort.Strings(h.Infomask)
+	}
+}
+
+// setXmax marks the tuple updated or deleted by xid, clearing hint bits left
+// by an earlier xmax that aborted
+func (h *TupleHeader) setXmax(xid uint32, cid int) {
+	h.Xmax = xid
+	h.Cmax = cid
+	infomask := []string{}
+	for _, hint := range h.Infomask {
+		if hint != HeapXmaxCommitted && hint != HeapXmaxInvalid {
+			infomask = append(infomask, hint)
+		}
+	}
+	h.Infomask = infomask
+}
+
+// PGSnapshot is a PostgreSQL snapshot. Transactions below Xmin had finished
+// when it was taken, those at or above Xmax had not started, and Xip lists
+// those in between that were still in progress, with Subxip listing their
+// subtransactions. Curcid is the command ID of the statement using it.
+type PGSnapshot struct {
+	Xmin   uint32   `json:"xmin"`
+	Xmax   uint32   `json:"xmax"`
+	Xip    []uint32 `json:"xip"`
+	Subxip []uint32 `json:"subxip"`
+	Curcid int      `json:"curcid"`
+}
+
+// String formats the snapshot as pg_current_snapshot() does, xmin:xmax:xip
+func (snap PGSnapshot) String() string {
+	xip := make([]string, len(snap.Xip))
+	for i, xid := range snap.Xip {
+		xip[i] = fmt.Sprint(xid)
+	}
+	return fmt.Sprintf("%d:%d:%s", snap.Xmin, snap.Xmax, strings.Join(xip, ","))
+}
+
+// inProgress is XidInMVCCSnapshot: whether xid counts as still running for
+// the snapshot, with the comparison that decided it
+func (snap PGSnapshot) inProgress(xid uint32) (bool, string) {
+	switch {
+	case xid < snap.Xmin:
+		return false, fmt.Sprintf("%d < snapshot xmin %d, so it finished before the snapshot", xid, snap.Xmin)
+	case xid >= snap.Xmax:
+		return true, fmt.Sprintf("%d >= snapshot xmax %d, so it started after the snapshot", xid, snap.Xmax)
+	}
+	for _, running := range snap.Xip {
+		if running == xid {
+			return true, fmt.Sprintf("%d is in xip [%s], so it was in progress when the snapshot was taken", xid, snap)
+		}
+	}
+	for _, running := range snap.Subxip {
+		if running == xid {
+			return true, fmt.Sprintf("%d is in subxip, a subtransaction of a transaction in progress when the snapshot was taken", xid)
+		}
+	}
+	return false, fmt.Sprintf("%d is between snapshot xmin %d and xmax %d but not in xip, so it finished before the snapshot", xid, snap.Xmin, snap.Xmax)
+}
+
+// takePGSnapshot builds tx's snapshot from the transactions in progress. Its
+// own xid counts towards Xmin but is left out of Xip, and its own
+// subtransactions out of Subxip.
+func (s *MVCCStore) takePGSnapshot(tx *Transaction) PGSnapshot {
+	snap := PGSnapshot{Xmin: tx.Xid, Xmax: uint32(s.txSeq) + 1, Xip: []uint32{}, Subxip: []uint32{}, Curcid: tx.PGSnapshot.Curcid}
+	for _, id := range s.ActiveTransactions() {
+		other := s.Transactions[id]
+		if other.Xid < snap.Xmin {
+			snap.Xmin = other.Xid
+		}
+		if other.ID == tx.ID {
+			continue
+		}
+		snap.Xip = append(snap.Xip, other.Xid)
+		for _, sub := range other.Subxacts {
+			if sub.Status != SubxactAborted {
+				snap.Subxip = append(snap.Subxip, sub.Xid)
+			}
+		}
+	}
+	return snap
+}
+
+// explainHeap is HeapTupleSatisfiesMVCC. It reports every check it makes in
+// Steps, and the hint bits a reader sets on the tuple in Hints.
+func (s *MVCCStore) explainHeap(tx *Transaction, ver *Version) Visibility {
+	h := &ver.Header
+	snap := tx.PGSnapshot
+	v := Visibility{Steps: []string{}, Hints: []string{}}
+	step := func(format string, args ...interface{}) {
+		v.Steps = append(v.Steps, fmt.Sprintf(format, args...))
+	}
+	verdict := func(visible bool, rule, format string, args ...interface{}) Visibility {
+		v.Visible, v.Rule, v.Reason = visible, rule, fmt.Sprintf(format, args...)
+		return v
+	}
+
+	// Did the inserting transaction commit before the snapshot?
+	step("Snapshot %s, curcid %d; tuple %s has xmin %d, xmax %d", snap, snap.Curcid, h.Ctid, h.Xmin, h.Xmax)
+	insertRule, inserted := RuleCommittedBefore, fmt.Sprintf("Inserted by xid %d, visible to the snapshot", h.Xmin)
+	switch {
+	case h.hasHint(HeapXminInvalid):
+		step("t_infomask has HEAP_XMIN_INVALID")
+		return verdict(false, RuleAborted, "Inserted by xid %d, which aborted", h.Xmin)
+	case tx.isCurrentXid(h.Xmin):
+		if h.Xmin != tx.Xid {
+			step("xmin %d is one of our own subtransactions, which has not rolled back", h.Xmin)
+		}
+		if h.Cmin >= snap.Curcid {
+			step("xmin %d is our own xid and cmin %d >= curcid %d", h.Xmin, h.Cmin, snap.Curcid)
+			return verdict(false, RuleLaterCommand, "Inserted by this statement or a later one of our own transaction")
+		}
+		step("xmin %d is our own xid and cmin %d < curcid %d, so an earlier command of ours inserted it", h.Xmin, h.Cmin, snap.Curcid)
+		insertRule, inserted = RuleOwnWrite, "Inserted by an earlier command of our own transaction"
+	default:
+		running, why := snap.inProgress(h.Xmin)
+		step("xmin %s", why)
+		if running {
+			switch s.Clog[h.Xmin] {
+			case XidCommitted:
+				return verdict(false, RuleCommittedAfter, "Inserted by xid %d, which the snapshot treats as in progress although it has since committed", h.Xmin)
+			case XidSubCommitted:
+				return verdict(false, RuleUncommitted, "Inserted by subtransaction %d, which is sub-committed, but its transaction has not committed", h.Xmin)
+			}
+			return verdict(false, RuleUncommitted, "Inserted by xid %d, which has not committed", h.Xmin)
+		}
+		if h.hasHint(HeapXminCommitted) {
+			step("t_infomask has HEAP_XMIN_COMMITTED, so the clog is not consulted")
+			break
+		}
+		status := s.Clog[h.Xmin]
+		step("clog[%d] = %s", h.Xmin, status)
+		if status != XidCommitted {
+			v.Hints = append(v.Hints, HeapXminInvalid)
+			step("Set hint bit HEAP_XMIN_INVALID")
+			return verdict(false, RuleAborted, "Inserted by xid %d, which aborted", h.Xmin)
+		}
+		v.Hints = append(v.Hints, HeapXminCommitted)
+		step("Set hint bit HEAP_XMIN_COMMITTED so later readers skip the clog")
+	}
+
+	// Was it deleted or updated by a transaction the snapshot can see?
+	rolledBack := tx.rolledBackSubxact(h.Xmax)
+	switch {
+	case h.Xmax == 0:
+		step("xmax is 0: no transaction updated or deleted the tuple")
+		return verdict(true, insertRule, "%s, and never updated or deleted", inserted)
+	case h.hasHint(HeapXmaxInvalid):
+		step("t_infomask has HEAP_XMAX_INVALID: xmax %d aborted", h.Xmax)
+		return verdict(true, insertRule, "%s; the update or delete by xid %d aborted", inserted, h.Xmax)
+	case rolledBack != nil:
+		// PostgreSQL's "deleting subtransaction must have aborted"
+		step("xmax %d is our own subtransaction %s, which rolled back to savepoint %s", h.Xmax, rolledBack.ID, rolledBack.Savepoint)
+		v.Hints = append(v.Hints, HeapXmaxInvalid)
+		step("Set hint bit HEAP_XMAX_INVALID")
+		return verdict(true, insertRule, "%s; the update or delete by our own subtransaction %d rolled back", inserted, h.Xmax)
+	case tx.isCurrentXid(h.Xmax):
+		if h.Cmax >= snap.Curcid {
+			step("xmax %d is our own xid and cmax %d >= curcid %d", h.Xmax, h.Cmax, snap.Curcid)
+			return verdict(true, RuleDeletedInvisibly, "Updated or deleted by this statement or a later one of our own transaction")
+		}
+		step("xmax %d is our own xid and cmax %d < curcid %d", h.Xmax, h.Cmax, snap.Curcid)
+		return verdict(false, RuleDeleted, "Updated or deleted by an earlier command of our own transaction")
+	}
+	running, why := snap.inProgress(h.Xmax)
+	step("xmax %s", why)
+	if running {
+		return verdict(true, RuleDeletedInvisibly, "Updated or deleted by xid %d, which the snapshot treats as in progress", h.Xmax)
+	}
+	if h.hasHint(HeapXmaxCommitted) {
+		step("t_infomask has HEAP_XMAX_COMMITTED, so the clog is not consulted")
+	} else {
+		status := s.Clog[h.Xmax]
+		step("clog[%d] = %s", h.Xmax, status)
+		if status != XidCommitted {
+			v.Hints = append(v.Hints, HeapXmaxInvalid)
+			step("Set hint bit HEAP_XMAX_INVALID")
+			return verdict(true, insertRule, "%s; the update or delete by xid %d aborted", inserted, h.Xmax)
+		}
+		v.Hints = append(v.Hints, HeapXmaxCommitted)
+		step("Set hint bit HEAP_XMAX_COMMITTED")
+	}
+	return verdict(false, RuleDeleted, "Updated or deleted by xid %d, which committed before the snapshot", h.Xmax)
+}
+
+// HeapTuple is one line of a heap page, in the shape of pageinspect's
+// heap_page_items
+type HeapTuple struct {
+	Lp        int         `json:"lp"`
+	VersionID string      `json:"versionId"`
+	RowID     string      `json:"rowId"`
+	Header    TupleHeader `json:"header"`
+}
+
+// HeapPage lists every stored version as a heap tuple, in insertion order
+func (s *MVCCStore) HeapPage() []HeapTuple {
+	tuples := []HeapTuple{}
+	for _, ver := range s.Versions {
+		var lp int
+		fmt.Sscanf(ver.ID, "ver-%d", &lp)
+		tuples = append(tuples, HeapTuple{Lp: lp, VersionID: ver.ID, RowID: ver.RowID, Header: ver.Header})
+	}
+	sort.Slice(tuples, func(i, j int) bool { return tuples[i].Lp < tuples[j].Lp })
+	return tuples
+}
@@ -0,0 +1,66 @@
+package internal
+
+// History operations
+const (
+	OpRead   = "read"
+	OpScan   = "scan"
+	OpWrite  = "write"
+	OpDelete = "delete"
+	OpCommit = "commit"
+	OpAbort  = "abort"
+)
+
+// ItemRead is a row a read or scan saw: the version and the transaction
+// that wrote it. A scan that finds a row deleted has read the delete, and
+// Writer is the deleter.
+type ItemRead struct {
+	RowID       string `json:"rowId"`
+	Version     string `json:"version"`
+	Writer      string `json:"writer"`
+	Deleted     bool   `json:"deleted,omitempty"`
+	Uncommitted bool   `json:"uncommitted,omitempty"` // Writer had not committed: a dirty read
+}
+
+// HistoryEvent is one operation of the history the store has executed.
+// Only operations that succeed are recorded.
+type HistoryEvent struct {
+	Seq      int        `json:"seq"`
+	TxID     string     `json:"txId"`
+	Op       string     `json:"op"`
+	RowID    string     `json:"rowId,omitempty"`    // Row, or the prefix a scan covered
+	Version  string     `json:"version,omitempty"`  // Version a write created or a delete marked
+	Subxact  string     `json:"subxact,omitempty"`  // Subtransaction that wrote or deleted
+	Snapshot int64      `json:"snapshot,omitempty"` // Timestamp of a scan's snapshot
+	Reads    []ItemRead `json:"reads,omitempty"`
+}
+
+// record appends an operation to the history
+func (s *MVCCStore) record(event HistoryEvent) {
+	event.Seq = len(s.History) + 1
+	s.History = append(s.History, event)
+}
+
+// itemRead describes tx reading ver
+func (s *MVCCStore) itemRead(tx *Transaction, ver *Version) ItemRead {
+	return ItemRead{
+		RowID:       ver.RowID,
+		Version:     ver.ID,
+		Writer:      ver.CreatedBy,
+		Uncommitted: ver.CreatedBy != tx.ID && s.Transactions[ver.CreatedBy].Status != TxCommitted,
+	}
+}
+
+// deleteRead describes tx finding the row of ver deleted
+func (s *MVCCStore) deleteRead(tx *Transaction, ver *Version) ItemRead {
+	deleter := *ver.DeletedBy
+	if ver.competingDelete(tx.ID) != nil {
+		deleter = tx.ID
+	}
+	return ItemRead{
+		RowID:       ver.RowID,
+		Version:     ver.ID,
+		Writer:      deleter,
+		Deleted:     true,
+		Uncommitted: deleter != tx.ID && s.Transactions[deleter].Status != TxCommitted,
+	}
+}
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IsolationLevel selects which versions a transaction sees and which
+// conflicts abort it
+type IsolationLevel string
+
+const (
+	// ReadUncommitted sees the newest version of a row that has not been
+	// aborted, including other transactions' uncommitted writes
+	ReadUncommitted IsolationLevel = "read-uncommitted"
+	// ReadCommitted takes a fresh snapshot for every statement, so it sees
+	// whatever committed before the statement began. A write to a row that
+	// a concurrent transaction updated applies to the newest version.
+	ReadCommitted IsolationLevel = "read-committed"
+	// RepeatableRead is snapshot isolation: one snapshot taken at BEGIN, and
+	// a serialization failure when writing a row changed since then
+	RepeatableRead IsolationLevel = "repeatable-read"
+	// Serializable is serializable snapshot isolation: RepeatableRead plus
+	// tracking of rw-antidependencies between serializable transactions, so
+	// a commit that could complete a cycle, as in write skew, fails instead
+	Serializable IsolationLevel = "serializable"
+)
+
+// IsolationLevels lists the levels from weakest to strongest
+var IsolationLevels = []IsolationLevel{ReadUncommitted, ReadCommitted, RepeatableRead, Serializable}
+
+// ParseIsolationLevel accepts a level's name in either form, e.g.
+// "read-committed" or "READ COMMITTED". "snapshot" names RepeatableRead.
+func ParseIsolationLevel(name string) (IsolationLevel, error) {
+	normalized := strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(name, "-", " "))), "-")
+	if normalized == "snapshot" {
+		return RepeatableRead, nil
+	}
+	for _, level := range IsolationLevels {
+		if IsolationLevel(normalized) == level {
+			return level, nil
+		}
+	}
+	return "", fmt.Errorf("unknown isolation level %q", name)
+}
+
+// SQL returns the level as written in SQL, e.g. READ COMMITTED
+func (l IsolationLevel) SQL() string {
+	return strings.ToUpper(strings.ReplaceAll(string(l), "-", " "))
+}
+
+// statementSnapshot is a fresh snapshot per statement
+func (l IsolationLevel) statementSnapshot() bool {
+	return l == ReadCommitted || l == ReadUncommitted
+}
+
+// Visibility rules, as reported by Explain
+const (
+	RuleOwnWrite          = "own-write"          // Created by the reading transaction
+	RuleDirtyRead         = "dirty-read"         // Uncommitted, but READ UNCOMMITTED sees it
+	RuleUncommitted       = "uncommitted"        // Creator is still active
+	RuleAborted           = "aborted"            // Creator rolled back
+	RuleCommittedBefore   = "committed-before"   // Creator committed at or before the snapshot
+	RuleCommittedAfter    = "committed-after"    // Creator committed after the snapshot
+	RuleDeleted           = "deleted"            // A delete the reader can see removed it
+	RuleDeletedInvisibly  = "deleted-invisibly"  // Deleted, but the reader cannot see the delete yet
+	RuleConcurrentCreator = "concurrent-creator" // Creator was active when the snapshot was taken
+	RuleLaterCommand      = "later-command"      // Inserted by this or a later command of the reader
+)
+
+// Visibility is whether a version is visible to a transaction, the rule that
+// decided it, and a sentence explaining it. Under ModelPostgres it also lists
+// each check made and the hint bits the check sets.
+type Visibility struct {
+	Visible bool     `json:"visible"`
+	Rule    string   `json:"rule"`
+	Reason  string   `json:"reason"`
+	Steps   []string `json:"steps,omitempty"`
+	Hints   []string `json:"hints,omitempty"`
+}
+
+// Explain decides whether ver is visible to tx under the store's visibility
+// model, tx's isolation level and its current snapshot. It does not set hint
+// bits; reads do.
+func (s *MVCCStore) Explain(tx *Transaction, ver *Version) Visibility {
+	if d := ver.competingDelete(tx.ID); d != nil {
+		return Visibility{Visible: false, Rule: RuleDeleted, Reason: fmt.Sprintf("Deleted by %s itself at %d, competing with %s's delete of the same version; the first to commit wins", tx.ID, d.At, *ver.DeletedBy)}
+	}
+	if s.Model == ModelPostgres {
+		return s.explainHeap(tx, ver)
+	}
+	level := tx.Isolation.SQL()
+	snap := tx.Snapshot.Timestamp
+	creator := s.Transactions[ver.CreatedBy]
+
+	var created Visibility
+	switch {
+	case ver.CreatedBy == tx.ID && ver.CreatedIn != "":
+		created = Visibility{Visible: true, Rule: RuleOwnWrite, Reason: fmt.Sprintf("Created by %s's subtransaction %s, and a transaction sees the writes of its subtransactions until they roll back", tx.ID, ver.CreatedIn)}
+	case ver.CreatedBy == tx.ID:
+		created = Visibility{Visible: true, Rule: RuleOwnWrite, Reason: fmt.Sprintf("Created by %s itself, and a transaction always sees its own writes", tx.ID)}
+	case creator.Status == TxAborted:
+		return Visibility{Visible: false, Rule: RuleAborted, Reason: fmt.Sprintf("Created by %s, which aborted, so no transaction sees it", ver.CreatedBy)}
+	case creator.Status == TxActive && tx.Isolation == ReadUncommitted:
+		created = Visibility{Visible: true, Rule: RuleDirtyRead, Reason: fmt.Sprintf("Created by %s, which has not committed; %s reads uncommitted versions", ver.CreatedBy, level)}
+	case creator.Status == TxActive:
+		if sub := creator.subxact(ver.CreatedIn); sub != nil && sub.Status == SubxactCommitted {
+			return Visibility{Visible: false, Rule: RuleUncommitted, Reason: fmt.Sprintf("Created by subtransaction %s, sub-committed when %s released savepoint %s, but %s has not committed; %s only sees committed versions",
+				sub.ID, ver.CreatedBy, sub.Savepoint, ver.CreatedBy, level)}
+		}
+		return Visibility{Visible: false, Rule: RuleUncommitted, Reason: fmt.Sprintf("Created by %s, which has not committed; %s only sees committed versions", ver.CreatedBy, level)}
+	case tx.Isolation == ReadUncommitted:
+		created = Visibility{Visible: true, Rule: RuleCommittedBefore, Reason: fmt.Sprintf("Committed by %s at %d; %s sees the newest version", ver.CreatedBy, *creator.CommitTime, level)}
+	case *creator.CommitTime > snap && contains(tx.Snapshot.Concurrent, ver.CreatedBy):
+		return Visibility{Visible: false, Rule: RuleConcurrentCreator, Reason: fmt.Sprintf("Committed by %s at %d, but %s was active when %s's %s was taken at %d",
+			ver.CreatedBy, *creator.CommitTime, ver.CreatedBy, tx.ID, tx.SnapshotKind(), snap)}
+	case *creator.CommitTime > snap:
+		return Visibility{Visible: false, Rule: RuleCommittedAfter, Reason: fmt.Sprintf("Committed by %s at %d, after %s's %s at %d",
+			ver.CreatedBy, *creator.CommitTime, tx.ID, tx.SnapshotKind(), snap)}
+	default:
+		created = Visibility{Visible: true, Rule: RuleCommittedBefore, Reason: fmt.Sprintf("Committed by %s at %d, at or before %s's %s at %d",
+			ver.CreatedBy, *creator.CommitTime, tx.ID, tx.SnapshotKind(), snap)}
+	}
+
+	if ver.DeletedBy == nil {
+		return created
+	}
+	deleterID := *ver.DeletedBy
+	deleter := s.Transactions[deleterID]
+	var reason string
+	switch {
+	case deleterID == tx.ID:
+		reason = fmt.Sprintf("Deleted by %s itself at %d", deleterID, *ver.DeletedAt)
+	case deleter.Status == TxAborted:
+		return created
+	case deleter.Status == TxActive && tx.Isolation == ReadUncommitted:
+		reason = fmt.Sprintf("Deleted by %s at %d, which has not committed; %s sees the delete", deleterID, *ver.DeletedAt, level)
+	case deleter.Status == TxActive:
+		created.Rule = RuleDeletedInvisibly
+		created.Reason += fmt.Sprintf(". %s deleted it at %d but has not committed", deleterID, *ver.DeletedAt)
+		return created
+	case tx.Isolation == ReadUncommitted:
+		reason = fmt.Sprintf("Deleted by %s, committed at %d", deleterID, *deleter.CommitTime)
+	case *deleter.CommitTime > snap:
+		created.Rule = RuleDeletedInvisibly
+		created.Reason += fmt.Sprintf(". %s's delete committed at %d, after the %s", deleterID, *deleter.CommitTime, tx.SnapshotKind())
+		return created
+	default:
+		reason = fmt.Sprintf("Deleted by %s, committed at %d, at or before %s's %s at %d",
+			deleterID, *deleter.CommitTime, tx.ID, tx.SnapshotKind(), snap)
+	}
+	return Visibility{Visible: false, Rule: RuleDeleted, Reason: reason}
+}
+
+// SnapshotKind names the snapshot tx reads through
+func (tx *Transaction) SnapshotKind() string {
+	if tx.Isolation.statementSnapshot() {
+		return "statement snapshot"
+	}
+	return "transaction snapshot"
+}
+
+func contains(ids []string, id string) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
+
+// takeSnapshot captures the current timestamp and active transactions,
+// other than tx itself
+func (s *MVCCStore) takeSnapshot(tx *Transaction) Snapshot {
+	concurrent := []string{}
+	for _, id := range s.ActiveTransactions() {
+		if id != tx.ID {
+			concurrent = append(concurrent, id)
+		}
+	}
+	return Snapshot{Timestamp: s.GlobalTimestamp, Concurrent: concurrent}
+}
+
+// beginStatement refreshes the snapshot of levels that take one per
+// statement, and gives the statement the next command ID
+func (s *MVCCStore) beginStatement(tx *Transaction) {
+	if tx.Isolation.statementSnapshot() {
+		tx.Snapshot = s.takeSnapshot(tx)
+		tx.PGSnapshot = s.takePGSnapshot(tx)
+	}
+	tx.PGSnapshot.Curcid = tx.CommandID
+	tx.CommandID++
+}
@@ -2,6 +2,8 @@ package internal
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 )
 
 // TransactionStatus represents the state of a transaction
@@ -13,6 +15,14 @@ const (
 	TxAborted   TransactionStatus = "aborted"
 )
 
+// Snapshot is what a transaction can see: versions committed at or before
+// Timestamp. Concurrent lists the transactions still active when it was
+// taken, whose changes it never sees.
+type Snapshot struct {
+	Timestamp  int64    `json:"timestamp"`
+	Concurrent []string `json:"concurrent"`
+}
+
 // Transaction represents a database transaction
 type Transaction struct {
 	ID         string            `json:"id"`
@@ -20,7 +30,16 @@ type Transaction struct {
 	CommitTime *int64            `json:"commitTime,omitempty"`
 	Status     TransactionStatus `json:"status"`
 	ReadSet    []string          `json:"readSet"`
+	ScanSet    []string          `json:"scanSet"` // Row ID prefixes it scanned
 	WriteSet   []string          `json:"writeSet"`
+	Isolation  IsolationLevel    `json:"isolation"`
+	Snapshot   Snapshot          `json:"snapshot"`             // Refreshed per statement under ReadCommitted and ReadUncommitted
+	WaitingFor string            `json:"waitingFor,omitempty"` // Transaction holding a row this one must write
+	Xid        uint32            `json:"xid"`
+	PGSnapshot PGSnapshot        `json:"pgSnapshot"` // Taken alongside Snapshot, for ModelPostgres
+	CommandID  int               `json:"commandId"`  // ID of the next statement
+	Subxacts   []Subtransaction  `json:"subxacts"`   // In the order their savepoints were set
+	seq        int
 }
 
 // Version represents a version of a row
@@ -33,6 +52,12 @@ type Version struct {
 	DeletedBy *string                `json:"deletedBy,omitempty"`
 	DeletedAt *int64                 `json:"deletedAt,omitempty"`
 	Prev      *string                `json:"prev,omitempty"`
+	Header    TupleHeader            `json:"header"`
+	CreatedIn string                 `json:"createdIn,omitempty"` // Subtransaction that wrote it
+	DeletedIn string                 `json:"deletedIn,omitempty"` // Subtransaction that deleted it
+	// CompetingDeletes are deletes of this version by transactions other
+	// than DeletedBy, kept under FirstCommitterWins until one commits
+	CompetingDeletes []CompetingDelete `json:"competingDeletes,omitempty"`
 }
 
 // Row represents a logical row with its version chain
@@ -42,15 +67,23 @@ type Row struct {
 	VersionChain   []string `json:"versionChain"`
 }
 
-// MVCCStore manages MVCC state
+// MVCCStore manages MVCC state. Any number of transactions may be active at
+// once, each reading through its own snapshot.
 type MVCCStore struct {
-	Transactions      map[string]*Transaction `json:"transactions"`
-	Versions          map[string]*Version     `json:"versions"`
-	Rows              map[string]*Row         `json:"rows"`
-	GlobalTimestamp   int64                   `json:"globalTimestamp"`
-	ActiveTransaction string                  `json:"activeTransaction,omitempty"`
-	txSeq             int
-	verSeq            int
+	Transactions    map[string]*Transaction `json:"transactions"`
+	Versions        map[string]*Version     `json:"versions"`
+	Rows            map[string]*Row         `json:"rows"`
+	GlobalTimestamp int64                   `json:"globalTimestamp"`
+	GCThreshold     int64                   `json:"gcThreshold"` // Reads as of an earlier timestamp may miss versions VACUUM removed
+	RWConflicts     []RWConflict            `json:"rwConflicts"` // Between serializable transactions
+	Clog            map[uint32]XidStatus    `json:"clog"`
+	Model           VisibilityModel         `json:"model"`
+	ConflictMode    ConflictMode            `json:"conflictMode"`
+	Isolation       IsolationLevel          `json:"isolation"` // Level of transactions begun without one
+	Blocking        bool                    `json:"blocking"`  // Writers wait for row holders instead of failing
+	History         []HistoryEvent          `json:"history"`   // Every operation that succeeded, in order
+	txSeq           int
+	verSeq          int
 }
 
 // NewMVCCStore creates a new MVCC store
@@ -60,25 +93,48 @@ func NewMVCCStore() *MVCCStore {
 		Versions:        make(map[string]*Version),
 		Rows:            make(map[string]*Row),
 		GlobalTimestamp: 1,
+		RWConflicts:     []RWConflict{},
+		Clog:            make(map[uint32]XidStatus),
+		Model:           ModelTimestamp,
+		ConflictMode:    FirstUpdaterWins,
+		Isolation:       RepeatableRead,
+		Blocking:        true,
+		History:         []HistoryEvent{},
 	}
 }
 
 // Clone creates a deep copy of the store
 func (s *MVCCStore) Clone() *MVCCStore {
 	clone := &MVCCStore{
-		Transactions:      make(map[string]*Transaction),
-		Versions:          make(map[string]*Version),
-		Rows:              make(map[string]*Row),
-		GlobalTimestamp:   s.GlobalTimestamp,
-		ActiveTransaction: s.ActiveTransaction,
-		txSeq:             s.txSeq,
-		verSeq:            s.verSeq,
+		Transactions:    make(map[string]*Transaction),
+		Versions:        make(map[string]*Version),
+		Rows:            make(map[string]*Row),
+		GlobalTimestamp: s.GlobalTimestamp,
+		GCThreshold:     s.GCThreshold,
+		RWConflicts:     append([]RWConflict{}, s.RWConflicts...),
+		Clog:            make(map[uint32]XidStatus),
+		Model:           s.Model,
+		ConflictMode:    s.ConflictMode,
+		Isolation:       s.Isolation,
+		Blocking:        s.Blocking,
+		History:         append([]HistoryEvent{}, s.History...),
+		txSeq:           s.txSeq,
+		verSeq:          s.verSeq,
 	}
 
 	for id, tx := range s.Transactions {
 		txCopy := *tx
 		txCopy.ReadSet = append([]string{}, tx.ReadSet...)
 		txCopy.WriteSet = append([]string{}, tx.WriteSet...)
+		txCopy.ScanSet = append([]string{}, tx.ScanSet...)
+		txCopy.Snapshot.Concurrent = append([]string{}, tx.Snapshot.Concurrent...)
+		txCopy.PGSnapshot.Xip = append([]uint32{}, tx.PGSnapshot.Xip...)
+		txCopy.PGSnapshot.Subxip = append([]uint32{}, tx.PGSnapshot.Subxip...)
+		txCopy.Subxacts = make([]Subtransaction, len(tx.Subxacts))
+		for i, sub := range tx.Subxacts {
+			sub.Discarded = append([]string{}, sub.Discarded...)
+			txCopy.Subxacts[i] = sub
+		}
 		clone.Transactions[id] = &txCopy
 	}
 
@@ -88,6 +144,8 @@ func (s *MVCCStore) Clone() *MVCCStore {
 		for k, v := range ver.Data {
 			verCopy.Data[k] = v
 		}
+		verCopy.Header.Infomask = append([]string{}, ver.Header.Infomask...)
+		verCopy.CompetingDeletes = append([]CompetingDelete(nil), ver.CompetingDeletes...)
 		clone.Versions[id] = &verCopy
 	}
 
@@ -97,11 +155,20 @@ func (s *MVCCStore) Clone() *MVCCStore {
 		clone.Rows[id] = &rowCopy
 	}
 
+	for xid, status := range s.Clog {
+		clone.Clog[xid] = status
+	}
+
 	return clone
 }
 
-// BeginTransaction starts a new transaction
-func (s *MVCCStore) BeginTransaction() *Transaction {
+// BeginTransaction starts a new transaction at the given isolation level, or
+// the store's if it is empty, with a snapshot of the current timestamp. Other
+// transactions stay active alongside it.
+func (s *MVCCStore) BeginTransaction(level IsolationLevel) *Transaction {
+	if level == "" {
+		level = s.Isolation
+	}
 	s.txSeq++
 	txID := fmt.Sprintf("tx-%d", s.txSeq)
 
@@ -111,42 +178,155 @@ func (s *MVCCStore) BeginTransaction() *Transaction {
 		Status:    TxActive,
 		ReadSet:   []string{},
 		WriteSet:  []string{},
-	}
+		ScanSet:   []string{},
+		Subxacts:  []Subtransaction{},
+		Isolation: level,
+		Snapshot: Snapshot{
+			Timestamp:  s.GlobalTimestamp,
+			Concurrent: s.ActiveTransactions(),
+		},
+		Xid: uint32(s.txSeq),
+		seq: s.txSeq,
+	}
+	tx.PGSnapshot = s.takePGSnapshot(tx)
 
 	s.Transactions[txID] = tx
-	s.ActiveTransaction = txID
+	s.Clog[tx.Xid] = XidInProgress
 	return tx
 }
 
+// ActiveTransactions returns the IDs of all active transactions in the order
+// they began
+func (s *MVCCStore) ActiveTransactions() []string {
+	active := []*Transaction{}
+	for _, tx := range s.Transactions {
+		if tx.Status == TxActive {
+			active = append(active, tx)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].seq < active[j].seq })
+
+	ids := make([]string, len(active))
+	for i, tx := range active {
+		ids[i] = tx.ID
+	}
+	return ids
+}
+
 // Read reads a row within a transaction
 func (s *MVCCStore) Read(txID string, rowID string) (*Version, error) {
+	ver, _, err := s.ReadExplained(txID, rowID)
+	return ver, err
+}
+
+// VersionCheck is the visibility of one version a read examined
+type VersionCheck struct {
+	VersionID  string     `json:"versionId"`
+	Visibility Visibility `json:"visibility"`
+}
+
+// ReadExplained reads a row like Read, and also returns the check of every
+// version it examined, newest first
+func (s *MVCCStore) ReadExplained(txID string, rowID string) (*Version, []VersionCheck, error) {
 	tx, ok := s.Transactions[txID]
 	if !ok {
-		return nil, fmt.Errorf("transaction %s not found", txID)
+		return nil, nil, fmt.Errorf("transaction %s not found", txID)
 	}
 
 	if tx.Status != TxActive {
-		return nil, fmt.Errorf("transaction %s is not active", txID)
+		return nil, nil, fmt.Errorf("transaction %s is not active", txID)
 	}
 
+	// A read that finds nothing still depends on the row staying absent,
+	// so a later insert by a concurrent transaction is an rw-antidependency
+	tx.ReadSet = append(tx.ReadSet, rowID)
 	row, ok := s.Rows[rowID]
 	if !ok {
-		return nil, fmt.Errorf("row %s not found", rowID)
+		return nil, nil, fmt.Errorf("row %s not found", rowID)
+	}
+
+	s.beginStatement(tx)
+	ver, checks, err := s.findVisible(tx, row)
+	if err != nil {
+		s.trackRead(tx, rowID, nil, row.VersionChain[:len(checks)])
+		return nil, checks, err
+	}
+	s.trackRead(tx, rowID, ver, row.VersionChain[:len(checks)-1])
+	s.record(HistoryEvent{TxID: txID, Op: OpRead, RowID: rowID, Reads: []ItemRead{s.itemRead(tx, ver)}})
+	return ver, checks, nil
+}
+
+// Scan reads every row whose ID starts with prefix, returning the version
+// of each that tx sees, by row ID. It is a predicate read: under
+// Serializable, a concurrent write to any row with the prefix, even one that
+// inserts a new row, is an rw-antidependency, as PostgreSQL's predicate
+// locks make it.
+func (s *MVCCStore) Scan(txID, prefix string) ([]*Version, error) {
+	tx, err := s.activeTransaction(txID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.beginStatement(tx)
+	tx.ScanSet = append(tx.ScanSet, prefix)
+	versions := []*Version{}
+	reads := []ItemRead{}
+	for _, rowID := range sortedRowIDs(s.Rows) {
+		if !strings.HasPrefix(rowID, prefix) {
+			continue
+		}
+		row := s.Rows[rowID]
+		ver, checks, err := s.findVisible(tx, row)
+		if err != nil {
+			s.trackRead(tx, rowID, nil, row.VersionChain[:len(checks)])
+			if n := len(checks); n > 0 && checks[n-1].Visibility.Rule == RuleDeleted {
+				if last := s.Versions[checks[n-1].VersionID]; last.DeletedBy != nil {
+					reads = append(reads, s.deleteRead(tx, last))
+				}
+			}
+			continue
+		}
+		tx.ReadSet = append(tx.ReadSet, rowID)
+		s.trackRead(tx, rowID, ver, row.VersionChain[:len(checks)-1])
+		versions = append(versions, ver)
+		reads = append(reads, s.itemRead(tx, ver))
 	}
+	s.record(HistoryEvent{TxID: txID, Op: OpScan, RowID: prefix, Snapshot: tx.Snapshot.Timestamp, Reads: reads})
+	return versions, nil
+}
 
-	// Find visible version using snapshot isolation
+// findVisible walks row's version chain from the newest version and returns
+// the first one visible under tx's level, with the check of each version it
+// examined. Checks set their hint bits. A delete visible to tx hides the row
+// entirely, so the walk stops at it rather than reach older versions.
+func (s *MVCCStore) findVisible(tx *Transaction, row *Row) (*Version, []VersionCheck, error) {
+	checks := []VersionCheck{}
 	for _, verID := range row.VersionChain {
 		ver := s.Versions[verID]
-		if s.isVisible(tx, ver) {
-			tx.ReadSet = append(tx.ReadSet, rowID)
-			return ver, nil
+		visibility := s.Explain(tx, ver)
+		for _, hint := range visibility.Hints {
+			ver.Header.setHint(hint)
+		}
+		checks = append(checks, VersionCheck{VersionID: verID, Visibility: visibility})
+		switch {
+		case visibility.Visible:
+			return ver, checks, nil
+		case visibility.Rule == RuleDeleted && ver.competingDelete(tx.ID) != nil:
+			return nil, checks, fmt.Errorf("row %s was deleted by %s", row.ID, tx.ID)
+		case visibility.Rule == RuleDeleted && ver.DeletedBy != nil:
+			return nil, checks, fmt.Errorf("row %s was deleted by %s", row.ID, *ver.DeletedBy)
+		case visibility.Rule == RuleDeleted:
+			return nil, checks, fmt.Errorf("row %s was deleted", row.ID)
 		}
 	}
 
-	return nil, fmt.Errorf("no visible version for row %s", rowID)
+	return nil, checks, fmt.Errorf("no visible version for row %s", row.ID)
 }
 
-// Write writes a new version within a transaction
+// Write writes a new version within a transaction. A write that conflicts
+// with a concurrent writer returns a *ConflictError: ErrWouldBlock leaves the
+// transaction waiting and the write can be retried once the holder ends;
+// ErrSerializationFailure and ErrDeadlock abort the transaction.
 func (s *MVCCStore) Write(txID string, rowID string, data map[string]interface{}) (*Version, error) {
 	tx, ok := s.Transactions[txID]
 	if !ok {
@@ -157,10 +337,17 @@ func (s *MVCCStore) Write(txID string, rowID string, data map[string]interface{}
 		return nil, fmt.Errorf("transaction %s is not active", txID)
 	}
 
+	s.beginStatement(tx)
+	row, exists := s.Rows[rowID]
+	if exists {
+		if err := s.checkWrite(tx, row); err != nil {
+			return nil, err
+		}
+	}
+
 	s.verSeq++
 	verID := fmt.Sprintf("ver-%d", s.verSeq)
 
-	row, exists := s.Rows[rowID]
 	if !exists {
 		// Create new row
 		row = &Row{
@@ -171,8 +358,17 @@ func (s *MVCCStore) Write(txID string, rowID string, data map[string]interface{}
 	}
 
 	var prevVer *string
+	xid, subxact := tx.currentXid()
+	ctid := fmt.Sprintf("(0,%d)", s.verSeq)
 	if len(row.VersionChain) > 0 {
 		prevVer = &row.VersionChain[0]
+		// A tuple whose delete is live or committed keeps its deleter's
+		// xmax, and the write inserts a fresh tuple rather than updating it
+		prev := &s.Versions[*prevVer].Header
+		if prev.Xmax == 0 || s.Clog[prev.Xmax] == XidAborted {
+			prev.setXmax(xid, tx.PGSnapshot.Curcid)
+			prev.Ctid = ctid
+		}
 	}
 
 	version := &Version{
@@ -182,41 +378,71 @@ func (s *MVCCStore) Write(txID string, rowID string, data map[string]interface{}
 		CreatedBy: txID,
 		CreatedAt: s.GlobalTimestamp,
 		Prev:      prevVer,
+		CreatedIn: subxact,
+		Header: TupleHeader{
+			Xmin:     xid,
+			Cmin:     tx.PGSnapshot.Curcid,
+			Ctid:     ctid,
+			Infomask: []string{},
+		},
 	}
 
 	s.Versions[verID] = version
 	row.VersionChain = append([]string{verID}, row.VersionChain...)
 	row.CurrentVersion = verID
 	tx.WriteSet = append(tx.WriteSet, rowID)
+	s.trackWrite(tx, rowID)
+	s.record(HistoryEvent{TxID: txID, Op: OpWrite, RowID: rowID, Version: verID, Subxact: subxact})
 
 	return version, nil
 }
 
-// Delete marks a version as deleted
-func (s *MVCCStore) Delete(txID string, rowID string) error {
+// Delete marks the version of a row that the transaction sees as deleted by
+// it, and returns that version. The version stays in the chain as a
+// tombstone: snapshots that see the delete find no row, older ones still
+// read the version. Conflicts are handled as in Write, except that under
+// FirstCommitterWins concurrent deletes of one version all proceed and the
+// first to commit wins.
+func (s *MVCCStore) Delete(txID string, rowID string) (*Version, error) {
 	tx, ok := s.Transactions[txID]
 	if !ok {
-		return fmt.Errorf("transaction %s not found", txID)
+		return nil, fmt.Errorf("transaction %s not found", txID)
 	}
 
 	if tx.Status != TxActive {
-		return fmt.Errorf("transaction %s is not active", txID)
+		return nil, fmt.Errorf("transaction %s is not active", txID)
 	}
 
 	row, ok := s.Rows[rowID]
 	if !ok {
-		return fmt.Errorf("row %s not found", rowID)
+		return nil, fmt.Errorf("row %s not found", rowID)
+	}
+	s.beginStatement(tx)
+	if err := s.checkWrite(tx, row); err != nil {
+		return nil, err
 	}
 
-	if len(row.VersionChain) > 0 {
-		ver := s.Versions[row.VersionChain[0]]
-		deletedAt := s.GlobalTimestamp
-		ver.DeletedBy = &txID
-		ver.DeletedAt = &deletedAt
+	ver, _, err := s.findVisible(tx, row)
+	if err != nil {
+		return nil, err
+	}
+	xid, subxact := tx.currentXid()
+	d := CompetingDelete{TxID: txID, At: s.GlobalTimestamp, Subxact: subxact, Xid: xid, Cid: tx.PGSnapshot.Curcid}
+	switch {
+	case ver.DeletedBy == nil:
+		ver.markDeleted(d)
+	case s.ConflictMode == FirstCommitterWins:
+		// Another delete of the same version is only seen here when
+		// conflicts are checked at commit: both stand until one commits
+		ver.CompetingDeletes = append(ver.CompetingDeletes, d)
+	default:
+		return nil, s.fail(tx, rowID, *ver.DeletedBy, ErrConcurrentDelete)
 	}
 
 	tx.WriteSet = append(tx.WriteSet, rowID)
-	return nil
+	s.trackWrite(tx, rowID)
+	s.record(HistoryEvent{TxID: txID, Op: OpDelete, RowID: rowID, Version: ver.ID, Subxact: subxact})
+	return ver, nil
 }
 
 // Commit commits a transaction
@@ -229,15 +455,22 @@ func (s *MVCCStore) Commit(txID string) error {
 	if tx.Status != TxActive {
 		return fmt.Errorf("transaction %s is not active", txID)
 	}
+	if err := s.checkCommit(tx); err != nil {
+		return err
+	}
+	if err := s.checkDependencies(tx); err != nil {
+		return err
+	}
 
+	tx.WaitingFor = ""
 	s.GlobalTimestamp++
 	commitTime := s.GlobalTimestamp
 	tx.CommitTime = &commitTime
 	tx.Status = TxCommitted
-
-	if s.ActiveTransaction == txID {
-		s.ActiveTransaction = ""
-	}
+	s.Clog[tx.Xid] = XidCommitted
+	s.endSubxacts(tx, XidCommitted)
+	s.settleDeletes(tx)
+	s.record(HistoryEvent{TxID: txID, Op: OpCommit})
 
 	return nil
 }
@@ -254,13 +487,22 @@ func (s *MVCCStore) Abort(txID string) error {
 	}
 
 	tx.Status = TxAborted
+	tx.WaitingFor = ""
+	s.Clog[tx.Xid] = XidAborted
+	s.endSubxacts(tx, XidAborted)
+	s.record(HistoryEvent{TxID: txID, Op: OpAbort})
 
-	// Remove uncommitted versions
+	// Remove uncommitted versions and undo deletes. Like PostgreSQL, the
+	// tuple header keeps the aborted xmax; readers mark it invalid.
 	for _, rowID := range tx.WriteSet {
 		row := s.Rows[rowID]
+		if row == nil {
+			continue
+		}
 		newChain := []string{}
 		for _, verID := range row.VersionChain {
 			ver := s.Versions[verID]
+			ver.dropDeletes(func(d CompetingDelete) bool { return d.TxID == txID })
 			if ver.CreatedBy != txID {
 				newChain = append(newChain, verID)
 			} else {
@@ -275,43 +517,11 @@ func (s *MVCCStore) Abort(txID string) error {
 		}
 	}
 
-	if s.ActiveTransaction == txID {
-		s.ActiveTransaction = ""
-	}
-
 	return nil
 }
 
-// isVisible checks if a version is visible to a transaction
-func (s *MVCCStore) isVisible(tx *Transaction, ver *Version) bool {
-	creatorTx := s.Transactions[ver.CreatedBy]
-
-	// Version created by this transaction is visible
-	if ver.CreatedBy == tx.ID {
-		return true
-	}
-
-	// Version must be committed before our snapshot
-	if creatorTx.Status != TxCommitted {
-		return false
-	}
-
-	if creatorTx.CommitTime == nil || *creatorTx.CommitTime > tx.StartTime {
-		return false
-	}
-
-	// Check if deleted before our snapshot
-	if ver.DeletedBy != nil && ver.DeletedAt != nil {
-		deleterTx := s.Transactions[*ver.DeletedBy]
-		if deleterTx.Status == TxCommitted && *deleterTx.CommitTime <= tx.StartTime {
-			return false
-		}
-	}
-
-	return true
-}
-
-// GetVisibleVersions returns all versions visible to a transaction
+// GetVisibleVersions returns the version of each row a transaction sees,
+// by row ID. Rows it sees deleted, or cannot see at all, are left out.
 func (s *MVCCStore) GetVisibleVersions(txID string) []string {
 	tx, ok := s.Transactions[txID]
 	if !ok {
@@ -319,79 +529,22 @@ func (s *MVCCStore) GetVisibleVersions(txID string) []string {
 	}
 
 	visible := []string{}
-	for _, row := range s.Rows {
-		for _, verID := range row.VersionChain {
-			ver := s.Versions[verID]
-			if s.isVisible(tx, ver) {
-				visible = append(visible, verID)
-				break // Only first visible version per row
-			}
+	for _, rowID := range sortedRowIDs(s.Rows) {
+		if ver, _, err := s.findVisible(tx, s.Rows[rowID]); err == nil {
+			visible = append(visible, ver.ID)
 		}
 	}
 
 	return visible
 }
 
-// GarbageCollect removes old versions that are no longer needed
+// GarbageCollect removes versions no snapshot can read, and returns them.
+// Vacuum also explains why each version stays or goes.
 func (s *MVCCStore) GarbageCollect() []string {
-	oldestActiveStart := s.GlobalTimestamp
-	for _, tx := range s.Transactions {
-		if tx.Status == TxActive && tx.StartTime < oldestActiveStart {
-			oldestActiveStart = tx.StartTime
-		}
-	}
-
-	removed := []string{}
-	for _, row := range s.Rows {
-		foundVisible := false
-		newChain := []string{}
-
-		for _, verID := range row.VersionChain {
-			ver := s.Versions[verID]
-
-			// Keep if might be needed by active transactions
-			creatorTx := s.Transactions[ver.CreatedBy]
-			if creatorTx.Status == TxCommitted && creatorTx.CommitTime != nil {
-				if *creatorTx.CommitTime < oldestActiveStart && foundVisible {
-					// Safe to remove
-					removed = append(removed, verID)
-					delete(s.Versions, verID)
-					continue
-				}
-				foundVisible = true
-			}
-
-			newChain = append(newChain, verID)
-		}
-
-		row.VersionChain = newChain
-	}
-
-	return removed
+	return s.Vacuum().Removed
 }
 
 // InsertInitialData adds some initial rows for testing
 func (s *MVCCStore) InsertInitialData() {
-	// Create a committed transaction for initial data
-	tx := s.BeginTransaction()
-
-	s.Write(tx.ID, "users:1", map[string]interface{}{
-		"id":    1,
-		"name":  "Alice",
-		"email": "alice@example.com",
-	})
-
-	s.Write(tx.ID, "users:2", map[string]interface{}{
-		"id":    2,
-		"name":  "Bob",
-		"email": "bob@example.com",
-	})
-
-	s.Write(tx.ID, "products:1", map[string]interface{}{
-		"id":    1,
-		"name":  "Widget",
-		"price": 9.99,
-	})
-
-	s.Commit(tx.ID)
+	InsertInitialData(s)
 }
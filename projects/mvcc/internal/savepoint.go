@@ -0,0 +1,282 @@
+package internal
+
+import "fmt"
+
+// SubxactStatus is the state of a subtransaction
+type SubxactStatus string
+
+const (
+	SubxactActive SubxactStatus = "active"
+	// SubxactCommitted is a released savepoint: its changes now belong to
+	// the enclosing (sub)transaction and commit or abort with it
+	SubxactCommitted SubxactStatus = "sub-committed"
+	SubxactAborted   SubxactStatus = "aborted" // Rolled back to its savepoint
+)
+
+// Subtransaction is the work a transaction does after a savepoint. Like a
+// PostgreSQL subtransaction it has its own xid, which the tuple headers of
+// its writes carry, so rolling back to the savepoint discards exactly those
+// writes. IDs are "sub-" and the xid, which comes from the same sequence as
+// transaction xids.
+type Subtransaction struct {
+	ID        string        `json:"id"`
+	Savepoint string        `json:"savepoint"`
+	Xid       uint32        `json:"xid"`
+	Parent    string        `json:"parent"` // Enclosing subtransaction, or the transaction
+	Status    SubxactStatus `json:"status"`
+	Discarded []string      `json:"discarded,omitempty"` // Versions removed when it rolled back
+}
+
+// currentSubxact returns tx's innermost active subtransaction, or nil
+func (tx *Transaction) currentSubxact() *Subtransaction {
+	for i := len(tx.Subxacts) - 1; i >= 0; i-- {
+		if tx.Subxacts[i].Status == SubxactActive {
+			return &tx.Subxacts[i]
+		}
+	}
+	return nil
+}
+
+// currentXid is the xid that tx's next write carries: that of its innermost
+// active subtransaction, or its own
+func (tx *Transaction) currentXid() (uint32, string) {
+	if sub := tx.currentSubxact(); sub != nil {
+		return sub.Xid, sub.ID
+	}
+	return tx.Xid, ""
+}
+
+// isCurrentXid is TransactionIdIsCurrentTransactionId: xid is tx's own or
+// one of its subtransactions that has not rolled back
+func (tx *Transaction) isCurrentXid(xid uint32) bool {
+	if xid == tx.Xid {
+		return true
+	}
+	for _, sub := range tx.Subxacts {
+		if sub.Xid == xid {
+			return sub.Status != SubxactAborted
+		}
+	}
+	return false
+}
+
+// rolledBackSubxact returns the subtransaction of tx with xid if it rolled
+// back, or nil
+func (tx *Transaction) rolledBackSubxact(xid uint32) *Subtransaction {
+	for i := range tx.Subxacts {
+		if tx.Subxacts[i].Xid == xid && tx.Subxacts[i].Status == SubxactAborted {
+			return &tx.Subxacts[i]
+		}
+	}
+	return nil
+}
+
+// subxact returns the subtransaction of tx with the given ID, or nil
+func (tx *Transaction) subxact(id string) *Subtransaction {
+	for i := range tx.Subxacts {
+		if tx.Subxacts[i].ID == id {
+			return &tx.Subxacts[i]
+		}
+	}
+	return nil
+}
+
+// savepoint returns the index of the innermost active subtransaction begun
+// by a savepoint called name. As in PostgreSQL, a name can be reused and
+// the latest one wins.
+func (tx *Transaction) savepoint(name string) (int, error) {
+	for i := len(tx.Subxacts) - 1; i >= 0; i-- {
+		if tx.Subxacts[i].Savepoint == name && tx.Subxacts[i].Status == SubxactActive {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("savepoint %q does not exist", name)
+}
+
+func (s *MVCCStore) activeTransaction(txID string) (*Transaction, error) {
+	tx, ok := s.Transactions[txID]
+	if !ok {
+		return nil, fmt.Errorf("transaction %s not found", txID)
+	}
+	if tx.Status != TxActive {
+		return nil, fmt.Errorf("transaction %s is not active", txID)
+	}
+	return tx, nil
+}
+
+// Savepoint begins a subtransaction named name inside tx's innermost one
+func (s *MVCCStore) Savepoint(txID, name string) (*Subtransaction, error) {
+	tx, err := s.activeTransaction(txID)
+	if err != nil {
+		return nil, err
+	}
+	return s.beginSubxact(tx, name), nil
+}
+
+func (s *MVCCStore) beginSubxact(tx *Transaction, name string) *Subtransaction {
+	parent := tx.ID
+	if sub := tx.currentSubxact(); sub != nil {
+		parent = sub.ID
+	}
+	s.txSeq++
+	tx.Subxacts = append(tx.Subxacts, Subtransaction{
+		ID:        fmt.Sprintf("sub-%d", s.txSeq),
+		Savepoint: name,
+		Xid:       uint32(s.txSeq),
+		Parent:    parent,
+		Status:    SubxactActive,
+	})
+	s.Clog[uint32(s.txSeq)] = XidInProgress
+	return &tx.Subxacts[len(tx.Subxacts)-1]
+}
+
+// RollbackToSavepoint aborts the subtransaction begun by savepoint name and
+// everything nested in it, including released savepoints: their versions
+// are removed and their deletes undone. The rest of the transaction stays.
+// As in PostgreSQL the savepoint remains, with a new subtransaction, which
+// is returned.
+func (s *MVCCStore) RollbackToSavepoint(txID, name string) (*Subtransaction, error) {
+	tx, err := s.activeTransaction(txID)
+	if err != nil {
+		return nil, err
+	}
+	start, err := tx.savepoint(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Everything begun after an active subtransaction is nested in it
+	aborted := map[string]*Subtransaction{}
+	for i := start; i < len(tx.Subxacts); i++ {
+		sub := &tx.Subxacts[i]
+		if sub.Status != SubxactAborted {
+			sub.Status = SubxactAborted
+			s.Clog[sub.Xid] = XidAborted
+			aborted[sub.ID] = sub
+		}
+	}
+
+	for _, rowID := range tx.WriteSet {
+		row := s.Rows[rowID]
+		if row == nil {
+			continue
+		}
+		chain := []string{}
+		for _, verID := range row.VersionChain {
+			ver := s.Versions[verID]
+			ver.dropDeletes(func(d CompetingDelete) bool { return aborted[d.Subxact] != nil })
+			if sub := aborted[ver.CreatedIn]; sub != nil {
+				sub.Discarded = append(sub.Discarded, verID)
+				delete(s.Versions, verID)
+				continue
+			}
+			chain = append(chain, verID)
+		}
+		row.VersionChain = chain
+		if len(chain) > 0 {
+			row.CurrentVersion = chain[0]
+		} else {
+			delete(s.Rows, rowID)
+		}
+	}
+
+	return s.beginSubxact(tx, name), nil
+}
+
+// ReleaseSavepoint ends the subtransaction begun by savepoint name, and any
+// nested in it, keeping their changes. They are sub-committed: the
+// transaction sees them as its own, but no one else does until it commits.
+func (s *MVCCStore) ReleaseSavepoint(txID, name string) (*Subtransaction, error) {
+	tx, err := s.activeTransaction(txID)
+	if err != nil {
+		return nil, err
+	}
+	start, err := tx.savepoint(name)
+	if err != nil {
+		return nil, err
+	}
+	for i := start; i < len(tx.Subxacts); i++ {
+		if sub := &tx.Subxacts[i]; sub.Status == SubxactActive {
+			sub.Status = SubxactCommitted
+			s.Clog[sub.Xid] = XidSubCommitted
+		}
+	}
+	return &tx.Subxacts[start], nil
+}
+
+// endSubxacts records tx's subtransactions in the commit log as tx ends.
+// Sub-committed and still active ones share its fate; rolled back ones
+// stay aborted.
+func (s *MVCCStore) endSubxacts(tx *Transaction, status XidStatus) {
+	for i := range tx.Subxacts {
+		sub := &tx.Subxacts[i]
+		if sub.Status == SubxactAborted {
+			continue
+		}
+		s.Clog[sub.Xid] = status
+		if status == XidAborted {
+			sub.Status = SubxactAborted
+		}
+	}
+}
+
+// SubxactNode is a transaction or subtransaction in a transaction's
+// subtransaction tree, with the versions it wrote that still exist
+type SubxactNode struct {
+	ID        string         `json:"id"`
+	Savepoint string         `json:"savepoint,omitempty"`
+	Xid       uint32         `json:"xid"`
+	Status    string         `json:"status"`
+	Versions  []string       `json:"versions"`
+	Discarded []string       `json:"discarded,omitempty"`
+	Children  []*SubxactNode `json:"children"`
+}
+
+// SubxactTree returns the subtransaction tree of txID, or nil if it never
+// set a savepoint
+func (s *MVCCStore) SubxactTree(txID string) *SubxactNode {
+	tx := s.Transactions[txID]
+	if tx == nil || len(tx.Subxacts) == 0 {
+		return nil
+	}
+	root := &SubxactNode{ID: tx.ID, Xid: tx.Xid, Status: string(tx.Status), Versions: []string{}, Children: []*SubxactNode{}}
+	nodes := map[string]*SubxactNode{tx.ID: root}
+	for _, sub := range tx.Subxacts {
+		node := &SubxactNode{
+			ID:        sub.ID,
+			Savepoint: sub.Savepoint,
+			Xid:       sub.Xid,
+			Status:    string(sub.Status),
+			Versions:  []string{},
+			Discarded: sub.Discarded,
+			Children:  []*SubxactNode{},
+		}
+		nodes[sub.ID] = node
+		nodes[sub.Parent].Children = append(nodes[sub.Parent].Children, node)
+	}
+
+	for _, rowID := range sortedRowIDs(s.Rows) {
+		for _, verID := range s.Rows[rowID].VersionChain {
+			if ver := s.Versions[verID]; ver.CreatedBy == txID {
+				owner := nodes[txID]
+				if ver.CreatedIn != "" {
+					owner = nodes[ver.CreatedIn]
+				}
+				owner.Versions = append(owner.Versions, verID)
+			}
+		}
+	}
+	return root
+}
+
+// SubxactTrees returns the subtransaction tree of every transaction that
+// set a savepoint
+func (s *MVCCStore) SubxactTrees() map[string]*SubxactNode {
+	trees := map[string]*SubxactNode{}
+	for id := range s.Transactions {
+		if tree := s.SubxactTree(id); tree != nil {
+			trees[id] = tree
+		}
+	}
+	return trees
+}
@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Script commands
+const (
+	CmdBegin  = "BEGIN"
+	CmdRead   = "READ"
+	CmdScan   = "SCAN"
+	CmdWrite  = "WRITE"
+	CmdDelete = "DELETE"
+	CmdCommit = "COMMIT"
+	CmdAbort  = "ABORT"
+	CmdVacuum = "VACUUM"
+
+	CmdSavepoint  = "SAVEPOINT"
+	CmdRollbackTo = "ROLLBACK TO SAVEPOINT"
+	CmdRelease    = "RELEASE SAVEPOINT"
+)
+
+// Statement is one line of an interleaving script: a session and the command
+// it issues. Sessions are names like T1 that map to whichever transaction
+// the session began last.
+type Statement struct {
+	Session string `json:"session"`
+	Command string `json:"command"`
+	// Isolation is the level a BEGIN asks for, empty for the store's default
+	Isolation IsolationLevel         `json:"isolation,omitempty"`
+	Row       string                 `json:"row,omitempty"` // Or the row ID prefix of a SCAN
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Savepoint string                 `json:"savepoint,omitempty"`
+	AsOf      int64                  `json:"asOf,omitempty"` // Timestamp of a READ ... AS OF, outside any transaction
+}
+
+// NeedsTransaction reports whether the statement runs in the session's open
+// transaction
+func (st Statement) NeedsTransaction() bool {
+	return st.Command != CmdBegin && st.Command != CmdVacuum && st.AsOf == 0
+}
+
+func (st Statement) String() string {
+	text := st.Session + ": " + st.Command
+	if st.Isolation != "" {
+		text += " ISOLATION LEVEL " + st.Isolation.SQL()
+	}
+	if st.Row != "" {
+		text += " " + st.Row
+	}
+	if st.Savepoint != "" {
+		text += " " + st.Savepoint
+	}
+	if st.AsOf != 0 {
+		text += fmt.Sprintf(" AS OF %d", st.AsOf)
+	}
+	for _, field := range sortedFields(st.Data) {
+		text += fmt.Sprintf(" %s=%v", field, st.Data[field])
+	}
+	return text
+}
+
+// ParseScript reads an interleaving script. Statements are separated by
+// semicolons or newlines and look like
+//
+//	T1: BEGIN; T2: BEGIN ISOLATION LEVEL READ COMMITTED
+//	T1: WRITE users:1 name=Carol
+//	T2: READ users:1
+//	T3: READ users:1 AS OF 2
+//	T2: SCAN users:
+//	T1: SAVEPOINT a; T1: DELETE users:2; T1: ROLLBACK TO a; T1: RELEASE a
+//	T1: COMMIT; T2: ABORT
+//	V: VACUUM
+//
+// Commands are case-insensitive and ROLLBACK is accepted for ABORT, while
+// ROLLBACK TO and RELEASE take a savepoint name, with or without the word
+// SAVEPOINT. READ ... AS OF reads the row as it was committed at a past
+// timestamp and needs no transaction. SCAN reads every row whose ID starts
+// with a prefix. BEGIN takes an optional isolation level, with or without
+// ISOLATION LEVEL. WRITE takes field=value pairs; numeric values become
+// numbers. Text after -- on a line is a comment. VACUUM, like PostgreSQL's,
+// cannot run inside a transaction, so its session must have none open.
+func ParseScript(script string) ([]Statement, error) {
+	statements := []Statement{}
+	for lineNo, line := range strings.Split(script, "\n") {
+		if i := strings.Index(line, "--"); i >= 0 {
+			line = line[:i]
+		}
+		for _, text := range strings.Split(line, ";") {
+			text = strings.TrimSpace(text)
+			if text == "" {
+				continue
+			}
+			st, err := parseStatement(text)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo+1, err)
+			}
+			statements = append(statements, st)
+		}
+	}
+	return statements, nil
+}
+
+func parseStatement(text string) (Statement, error) {
+	session, rest, ok := strings.Cut(text, ":")
+	session = strings.TrimSpace(session)
+	if !ok || session == "" || strings.ContainsAny(session, " \t") {
+		return Statement{}, fmt.Errorf("%q does not start with a session name like T1:", text)
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return Statement{}, fmt.Errorf("%q has no command", text)
+	}
+
+	st := Statement{Session: session, Command: strings.ToUpper(fields[0])}
+	args := fields[1:]
+	switch {
+	case st.Command == "ROLLBACK" && len(args) > 0 && strings.EqualFold(args[0], "to"):
+		st.Command, args = CmdRollbackTo, savepointArgs(args[1:])
+	case st.Command == "ROLLBACK":
+		st.Command = CmdAbort
+	case st.Command == "RELEASE":
+		st.Command, args = CmdRelease, savepointArgs(args)
+	}
+
+	switch st.Command {
+	case CmdBegin:
+		if len(args) >= 2 && strings.EqualFold(args[0], "isolation") && strings.EqualFold(args[1], "level") {
+			args = args[2:]
+		}
+		if len(args) > 0 {
+			level, err := ParseIsolationLevel(strings.Join(args, " "))
+			if err != nil {
+				return Statement{}, err
+			}
+			st.Isolation = level
+		}
+	case CmdCommit, CmdAbort, CmdVacuum:
+		if len(args) != 0 {
+			return Statement{}, fmt.Errorf("%s takes no arguments", st.Command)
+		}
+	case CmdRead:
+		if len(args) == 4 && strings.EqualFold(args[1], "as") && strings.EqualFold(args[2], "of") {
+			ts, err := strconv.ParseInt(args[3], 10, 64)
+			if err != nil || ts < 1 {
+				return Statement{}, fmt.Errorf("AS OF takes a timestamp of 1 or more, not %q", args[3])
+			}
+			st.AsOf, args = ts, args[:1]
+		}
+		if len(args) != 1 {
+			return Statement{}, fmt.Errorf("READ takes a row ID and an optional AS OF timestamp")
+		}
+		st.Row = args[0]
+	case CmdDelete:
+		if len(args) != 1 {
+			return Statement{}, fmt.Errorf("%s takes a row ID", st.Command)
+		}
+		st.Row = args[0]
+	case CmdScan:
+		if len(args) != 1 {
+			return Statement{}, fmt.Errorf("SCAN takes a row ID prefix")
+		}
+		st.Row = args[0]
+	case CmdSavepoint, CmdRollbackTo, CmdRelease:
+		if len(args) != 1 {
+			return Statement{}, fmt.Errorf("%s takes a savepoint name", st.Command)
+		}
+		st.Savepoint = args[0]
+	case CmdWrite:
+		if len(args) == 0 {
+			return Statement{}, fmt.Errorf("WRITE takes a row ID")
+		}
+		st.Row = args[0]
+		st.Data = map[string]interface{}{}
+		for _, pair := range args[1:] {
+			field, value, ok := strings.Cut(pair, "=")
+			if !ok || field == "" {
+				return Statement{}, fmt.Errorf("WRITE value %q is not field=value", pair)
+			}
+			st.Data[field] = parseValue(value)
+		}
+		if len(st.Data) == 0 {
+			st.Data["writtenBy"] = session
+		}
+	default:
+		return Statement{}, fmt.Errorf("unknown command %q", fields[0])
+	}
+	return st, nil
+}
+
+// savepointArgs drops the optional SAVEPOINT before a savepoint name
+func savepointArgs(args []string) []string {
+	if len(args) > 0 && strings.EqualFold(args[0], "savepoint") {
+		return args[1:]
+	}
+	return args
+}
+
+// parseValue returns a number for numeric text, and the text without
+// surrounding quotes otherwise
+func parseValue(value string) interface{} {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	return strings.Trim(value, `"'`)
+}
+
+func sortedFields(data map[string]interface{}) []string {
+	fields := make([]string, 0, len(data))
+	for field := range data {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
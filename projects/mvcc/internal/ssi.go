@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDependencies is the serialization failure raised by serializable
+// snapshot isolation when a transaction is part of a dangerous structure.
+// A *ConflictError carrying it also matches ErrSerializationFailure.
+var ErrDependencies = errors.New("could not serialize access due to read/write dependencies among transactions")
+
+// RWConflict is an rw-antidependency Reader -> Writer: Reader read a version
+// of RowID that Writer, running concurrently, replaced or deleted. Reader
+// must therefore come before Writer in any equivalent serial order.
+type RWConflict struct {
+	Reader string `json:"reader"`
+	Writer string `json:"writer"`
+	RowID  string `json:"rowId"`
+}
+
+// EdgeID identifies the Reader -> Writer edge of the dependency graph.
+// Conflicts on different rows between the same pair share an edge.
+func (c RWConflict) EdgeID() string {
+	return c.Reader + "->" + c.Writer
+}
+
+// DangerousStructure is two consecutive rw-antidependencies
+// In -> Pivot -> Out. Every cycle in the serialization graph of snapshot
+// isolation contains one, so breaking them keeps execution serializable.
+// In and Out may be the same transaction, as in write skew.
+type DangerousStructure struct {
+	In    string `json:"in"`
+	Pivot string `json:"pivot"`
+	Out   string `json:"out"`
+}
+
+// Edges returns the edge IDs of the structure's two rw-antidependencies
+func (d DangerousStructure) Edges() []string {
+	return []string{d.In + "->" + d.Pivot, d.Pivot + "->" + d.Out}
+}
+
+func (d DangerousStructure) String() string {
+	return fmt.Sprintf("%s -rw-> %s -rw-> %s", d.In, d.Pivot, d.Out)
+}
+
+// DependencyGraph is the serializable transactions and the rw-antidependencies
+// between them
+type DependencyGraph struct {
+	Transactions []string             `json:"transactions"` // In the order they began
+	Conflicts    []RWConflict         `json:"conflicts"`
+	Dangerous    []DangerousStructure `json:"dangerous"`
+}
+
+// DependencyGraph returns the current graph. Aborted transactions keep their
+// edges so a failure can be shown, but never form dangerous structures.
+func (s *MVCCStore) DependencyGraph() DependencyGraph {
+	graph := DependencyGraph{
+		Transactions: []string{},
+		Conflicts:    append([]RWConflict{}, s.RWConflicts...),
+		Dangerous:    s.DangerousStructures(),
+	}
+	for i := 1; i <= s.txSeq; i++ {
+		id := fmt.Sprintf("tx-%d", i)
+		if tx := s.Transactions[id]; tx != nil && tx.Isolation == Serializable {
+			graph.Transactions = append(graph.Transactions, id)
+		}
+	}
+	return graph
+}
+
+// concurrent reports whether a and b overlapped: neither committed before
+// the other's snapshot was taken
+func concurrent(a, b *Transaction) bool {
+	if a.Status == TxCommitted && *a.CommitTime <= b.Snapshot.Timestamp {
+		return false
+	}
+	return !(b.Status == TxCommitted && *b.CommitTime <= a.Snapshot.Timestamp)
+}
+
+// addConflict records reader -> writer on row, once
+func (s *MVCCStore) addConflict(reader, writer, rowID string) {
+	for _, c := range s.RWConflicts {
+		if c.Reader == reader && c.Writer == writer && c.RowID == rowID {
+			return
+		}
+	}
+	s.RWConflicts = append(s.RWConflicts, RWConflict{Reader: reader, Writer: writer, RowID: rowID})
+}
+
+// trackRead records tx -> W for every concurrent serializable W that tx's
+// snapshot hid from it: the creators of the newer versions of row it skipped,
+// and the deleter of the version it read, if it found one
+func (s *MVCCStore) trackRead(tx *Transaction, rowID string, ver *Version, skipped []string) {
+	if tx.Isolation != Serializable {
+		return
+	}
+	writers := []string{}
+	for _, verID := range skipped {
+		writers = append(writers, s.Versions[verID].CreatedBy)
+	}
+	if ver != nil && ver.DeletedBy != nil {
+		writers = append(writers, *ver.DeletedBy)
+		for _, d := range ver.CompetingDeletes {
+			writers = append(writers, d.TxID)
+		}
+	}
+	for _, id := range writers {
+		writer := s.Transactions[id]
+		if id != tx.ID && writer.Isolation == Serializable && writer.Status != TxAborted && concurrent(tx, writer) {
+			s.addConflict(tx.ID, id, rowID)
+		}
+	}
+}
+
+// trackWrite records R -> tx for every concurrent serializable R that read
+// the row tx is replacing or deleting, or scanned a prefix that covers it
+func (s *MVCCStore) trackWrite(tx *Transaction, rowID string) {
+	if tx.Isolation != Serializable {
+		return
+	}
+	for i := 1; i <= s.txSeq; i++ {
+		reader := s.Transactions[fmt.Sprintf("tx-%d", i)]
+		if reader == nil || reader.ID == tx.ID || reader.Isolation != Serializable || reader.Status == TxAborted {
+			continue
+		}
+		if (contains(reader.ReadSet, rowID) || reader.scanned(rowID)) && concurrent(reader, tx) {
+			s.addConflict(reader.ID, tx.ID, rowID)
+		}
+	}
+}
+
+// scanned reports whether one of tx's scans covered rowID
+func (tx *Transaction) scanned(rowID string) bool {
+	for _, prefix := range tx.ScanSet {
+		if strings.HasPrefix(rowID, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// DangerousStructures returns every In -> Pivot -> Out among transactions
+// that have not aborted
+func (s *MVCCStore) DangerousStructures() []DangerousStructure {
+	live := []RWConflict{}
+	seen := map[string]bool{}
+	for _, c := range s.RWConflicts {
+		if seen[c.EdgeID()] || s.Transactions[c.Reader].Status == TxAborted || s.Transactions[c.Writer].Status == TxAborted {
+			continue
+		}
+		seen[c.EdgeID()] = true
+		live = append(live, c)
+	}
+
+	structures := []DangerousStructure{}
+	for _, in := range live {
+		for _, out := range live {
+			if in.Writer == out.Reader {
+				structures = append(structures, DangerousStructure{In: in.Reader, Pivot: in.Writer, Out: out.Writer})
+			}
+		}
+	}
+	return structures
+}
+
+// checkDependencies applies serializable snapshot isolation at commit. A
+// dangerous structure can only complete a cycle once Out has committed, so
+// tx fails when it is In or Pivot of a structure whose Out already
+// committed. When tx is itself Out it commits, and the others fail later.
+func (s *MVCCStore) checkDependencies(tx *Transaction) error {
+	if tx.Isolation != Serializable {
+		return nil
+	}
+	for _, d := range s.DangerousStructures() {
+		if d.Out == tx.ID || (d.In != tx.ID && d.Pivot != tx.ID) {
+			continue
+		}
+		if s.Transactions[d.Out].Status != TxCommitted {
+			continue
+		}
+		s.Abort(tx.ID)
+		return &ConflictError{TxID: tx.ID, Holder: d.Out, Err: ErrDependencies, Structure: &d}
+	}
+	return nil
+}
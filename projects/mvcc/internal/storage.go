@@ -0,0 +1,115 @@
+package internal
+
+// Storage is a strategy for keeping the versions of rows. MVCCStore is
+// append-only: every change adds a version to a newest-first chain, as in
+// PostgreSQL. UndoStore updates rows in place and keeps before-images in an
+// undo log, as InnoDB and Oracle do. Both give transactions the same
+// snapshots, so a workload reads the same data from either; what differs is
+// where old versions live, what a read costs and how they are cleaned up.
+type Storage interface {
+	Strategy() string
+	BeginTransaction(level IsolationLevel) *Transaction
+	ReadRow(txID, rowID string) (RowRead, error)
+	WriteRow(txID, rowID string, data map[string]interface{}) error
+	DeleteRow(txID, rowID string) error
+	Commit(txID string) error
+	Abort(txID string) error
+	Cleanup() Cleanup
+	Footprint() Footprint
+}
+
+// Storage strategies
+const (
+	StrategyAppendOnly = "append-only"
+	StrategyInPlace    = "in-place"
+)
+
+// RowRead is the result of a read and what it cost
+type RowRead struct {
+	Data   map[string]interface{} `json:"data"`
+	Source string                 `json:"source"` // Version or undo record the data came from
+	Path   []string               `json:"path"`   // Everything the read examined, in order
+}
+
+// Cleanup is what a VACUUM or purge reclaimed
+type Cleanup struct {
+	Horizon int64    `json:"horizon"`
+	HeldBy  string   `json:"heldBy,omitempty"`
+	Removed []string `json:"removed"` // Versions, undo records and rows
+	Kept    int      `json:"kept"`    // Old versions still needed by some snapshot
+}
+
+// Footprint is how much a store keeps
+type Footprint struct {
+	Rows        int `json:"rows"`        // Rows in the table, including deleted ones not yet cleaned up
+	Tuples      int `json:"tuples"`      // Row images in the table
+	UndoRecords int `json:"undoRecords"` // Before-images in the undo log
+}
+
+// InsertInitialData adds some initial rows in one committed transaction
+func InsertInitialData(st Storage) {
+	tx := st.BeginTransaction("")
+	st.WriteRow(tx.ID, "users:1", map[string]interface{}{
+		"id":    1,
+		"name":  "Alice",
+		"email": "alice@example.com",
+	})
+	st.WriteRow(tx.ID, "users:2", map[string]interface{}{
+		"id":    2,
+		"name":  "Bob",
+		"email": "bob@example.com",
+	})
+	st.WriteRow(tx.ID, "products:1", map[string]interface{}{
+		"id":    1,
+		"name":  "Widget",
+		"price": 9.99,
+	})
+	st.Commit(tx.ID)
+}
+
+// Strategy names MVCCStore's strategy
+func (s *MVCCStore) Strategy() string {
+	return StrategyAppendOnly
+}
+
+// ReadRow reads like Read, reporting every version the read examined
+func (s *MVCCStore) ReadRow(txID, rowID string) (RowRead, error) {
+	ver, checks, err := s.ReadExplained(txID, rowID)
+	read := RowRead{Path: []string{}}
+	for _, check := range checks {
+		read.Path = append(read.Path, check.VersionID)
+	}
+	if err != nil {
+		return read, err
+	}
+	read.Data, read.Source = ver.Data, ver.ID
+	return read, nil
+}
+
+// WriteRow writes like Write
+func (s *MVCCStore) WriteRow(txID, rowID string, data map[string]interface{}) error {
+	_, err := s.Write(txID, rowID, data)
+	return err
+}
+
+// DeleteRow deletes like Delete
+func (s *MVCCStore) DeleteRow(txID, rowID string) error {
+	_, err := s.Delete(txID, rowID)
+	return err
+}
+
+// Cleanup runs VACUUM
+func (s *MVCCStore) Cleanup() Cleanup {
+	report := s.Vacuum()
+	return Cleanup{
+		Horizon: report.Horizon,
+		HeldBy:  report.HeldBy,
+		Removed: append(append([]string{}, report.Removed...), report.RemovedRows...),
+		Kept:    report.After.DeadTuples,
+	}
+}
+
+// Footprint counts the store's rows and versions
+func (s *MVCCStore) Footprint() Footprint {
+	return Footprint{Rows: len(s.Rows), Tuples: len(s.Versions)}
+}
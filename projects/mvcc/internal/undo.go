@@ -0,0 +1,389 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+)
+
+// UndoRow is a row stored in place, with its newest image: the data, the
+// transaction that wrote it, and a roll pointer to the undo record holding
+// the image before that. A delete only marks the row, as in InnoDB.
+type UndoRow struct {
+	ID      string                 `json:"id"`
+	Data    map[string]interface{} `json:"data"`
+	Deleted bool                   `json:"deleted"`
+	TxID    string                 `json:"txId"`              // Last writer, like InnoDB's DB_TRX_ID
+	RollPtr string                 `json:"rollPtr,omitempty"` // Newest undo record, like DB_ROLL_PTR
+}
+
+// UndoRecord is the before-image of a row, logged when TxID changed it. A
+// reader whose snapshot cannot see TxID's change applies it to get the row
+// as it was. Absent images undo inserts.
+type UndoRecord struct {
+	ID      string                 `json:"id"`
+	RowID   string                 `json:"rowId"`
+	TxID    string                 `json:"txId"` // Transaction whose change this undoes
+	Data    map[string]interface{} `json:"data,omitempty"`
+	Deleted bool                   `json:"deleted"`
+	Absent  bool                   `json:"absent"`           // The row did not exist before TxID's insert
+	Writer  string                 `json:"writer,omitempty"` // Transaction that wrote the before-image
+	Prev    string                 `json:"prev,omitempty"`   // Next older undo record of the row
+}
+
+// UndoStore is the in-place strategy: the table holds one image per row,
+// and the undo log holds what readers with older snapshots and rollbacks
+// need. Transactions see the same snapshots as in MVCCStore under the
+// timestamp model. Writers never wait: a write to a row another active
+// transaction changed fails, as in MVCCStore without blocking. There is no
+// serializable snapshot isolation, so SERIALIZABLE behaves as REPEATABLE
+// READ.
+type UndoStore struct {
+	Transactions    map[string]*Transaction `json:"transactions"`
+	Rows            map[string]*UndoRow     `json:"rows"`
+	Undo            map[string]*UndoRecord  `json:"undo"`
+	GlobalTimestamp int64                   `json:"globalTimestamp"`
+	Isolation       IsolationLevel          `json:"isolation"`    // Level of transactions begun without one
+	RollbackCost    map[string]int          `json:"rollbackCost"` // Undo records each aborted transaction applied
+	txSeq           int
+	undoSeq         int
+}
+
+// NewUndoStore creates an empty in-place store
+func NewUndoStore() *UndoStore {
+	return &UndoStore{
+		Transactions:    make(map[string]*Transaction),
+		Rows:            make(map[string]*UndoRow),
+		Undo:            make(map[string]*UndoRecord),
+		GlobalTimestamp: 1,
+		Isolation:       RepeatableRead,
+		RollbackCost:    make(map[string]int),
+	}
+}
+
+// Strategy names UndoStore's strategy
+func (u *UndoStore) Strategy() string {
+	return StrategyInPlace
+}
+
+// activeTransactions returns the IDs of the active transactions in the
+// order they began
+func (u *UndoStore) activeTransactions() []string {
+	active := []*Transaction{}
+	for _, tx := range u.Transactions {
+		if tx.Status == TxActive {
+			active = append(active, tx)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].seq < active[j].seq })
+	ids := make([]string, len(active))
+	for i, tx := range active {
+		ids[i] = tx.ID
+	}
+	return ids
+}
+
+// BeginTransaction starts a transaction with a snapshot of the current
+// timestamp
+func (u *UndoStore) BeginTransaction(level IsolationLevel) *Transaction {
+	if level == "" {
+		level = u.Isolation
+	}
+	u.txSeq++
+	tx := &Transaction{
+		ID:        fmt.Sprintf("tx-%d", u.txSeq),
+		StartTime: u.GlobalTimestamp,
+		Status:    TxActive,
+		ReadSet:   []string{},
+		ScanSet:   []string{},
+		WriteSet:  []string{},
+		Subxacts:  []Subtransaction{},
+		Isolation: level,
+		Snapshot:  Snapshot{Timestamp: u.GlobalTimestamp, Concurrent: u.activeTransactions()},
+		Xid:       uint32(u.txSeq),
+		seq:       u.txSeq,
+	}
+	u.Transactions[tx.ID] = tx
+	return tx
+}
+
+func (u *UndoStore) activeTransaction(txID string) (*Transaction, error) {
+	tx, ok := u.Transactions[txID]
+	if !ok {
+		return nil, fmt.Errorf("transaction %s not found", txID)
+	}
+	if tx.Status != TxActive {
+		return nil, fmt.Errorf("transaction %s is not active", txID)
+	}
+	return tx, nil
+}
+
+// beginStatement refreshes the snapshot of levels that take one per
+// statement
+func (u *UndoStore) beginStatement(tx *Transaction) {
+	if tx.Isolation.statementSnapshot() {
+		concurrent := []string{}
+		for _, id := range u.activeTransactions() {
+			if id != tx.ID {
+				concurrent = append(concurrent, id)
+			}
+		}
+		tx.Snapshot = Snapshot{Timestamp: u.GlobalTimestamp, Concurrent: concurrent}
+	}
+}
+
+// sees reports whether tx's snapshot includes the change writer made
+func (u *UndoStore) sees(tx *Transaction, writer string) bool {
+	if writer == tx.ID {
+		return true
+	}
+	other := u.Transactions[writer]
+	switch {
+	case other.Status == TxActive:
+		return tx.Isolation == ReadUncommitted
+	case other.Status == TxCommitted:
+		return tx.Isolation == ReadUncommitted || *other.CommitTime <= tx.Snapshot.Timestamp
+	}
+	return false
+}
+
+// ReadRow reads the row image tx's snapshot sees, starting from the row in
+// place and applying undo records until it reaches one it can see
+func (u *UndoStore) ReadRow(txID, rowID string) (RowRead, error) {
+	tx, err := u.activeTransaction(txID)
+	if err != nil {
+		return RowRead{}, err
+	}
+	row, ok := u.Rows[rowID]
+	if !ok {
+		return RowRead{}, fmt.Errorf("row %s not found", rowID)
+	}
+	u.beginStatement(tx)
+
+	read := RowRead{Path: []string{rowID}}
+	data, deleted, writer, source := row.Data, row.Deleted, row.TxID, rowID
+	for next := row.RollPtr; !u.sees(tx, writer); {
+		if next == "" {
+			return read, fmt.Errorf("no visible version for row %s", rowID)
+		}
+		rec := u.Undo[next]
+		read.Path = append(read.Path, rec.ID)
+		if rec.Absent {
+			return read, fmt.Errorf("row %s did not exist for %s", rowID, txID)
+		}
+		data, deleted, writer, source = rec.Data, rec.Deleted, rec.Writer, rec.ID
+		next = rec.Prev
+	}
+	if deleted {
+		return read, fmt.Errorf("row %s was deleted by %s", rowID, writer)
+	}
+	tx.ReadSet = append(tx.ReadSet, rowID)
+	read.Data, read.Source = data, source
+	return read, nil
+}
+
+// checkWrite fails tx if another transaction holds the row, or, under
+// transaction snapshots, committed a change to it that tx cannot see
+func (u *UndoStore) checkWrite(tx *Transaction, row *UndoRow) error {
+	if row.TxID == tx.ID {
+		return nil
+	}
+	writer := u.Transactions[row.TxID]
+	if writer.Status == TxActive || (!tx.Isolation.statementSnapshot() && !u.sees(tx, row.TxID)) {
+		u.Abort(tx.ID)
+		return &ConflictError{TxID: tx.ID, RowID: row.ID, Holder: row.TxID, Err: ErrSerializationFailure}
+	}
+	return nil
+}
+
+// logUndo saves the row's current image as an undo record of tx's change
+func (u *UndoStore) logUndo(tx *Transaction, row *UndoRow) {
+	u.undoSeq++
+	rec := &UndoRecord{
+		ID:      fmt.Sprintf("undo-%d", u.undoSeq),
+		RowID:   row.ID,
+		TxID:    tx.ID,
+		Data:    row.Data,
+		Deleted: row.Deleted,
+		Writer:  row.TxID,
+		Prev:    row.RollPtr,
+	}
+	u.Undo[rec.ID] = rec
+	row.RollPtr = rec.ID
+	tx.WriteSet = append(tx.WriteSet, row.ID)
+}
+
+// WriteRow overwrites the row in place, logging its before-image first
+func (u *UndoStore) WriteRow(txID, rowID string, data map[string]interface{}) error {
+	tx, err := u.activeTransaction(txID)
+	if err != nil {
+		return err
+	}
+	u.beginStatement(tx)
+
+	row, exists := u.Rows[rowID]
+	if !exists {
+		u.undoSeq++
+		rec := &UndoRecord{ID: fmt.Sprintf("undo-%d", u.undoSeq), RowID: rowID, TxID: tx.ID, Absent: true}
+		u.Undo[rec.ID] = rec
+		u.Rows[rowID] = &UndoRow{ID: rowID, Data: data, TxID: tx.ID, RollPtr: rec.ID}
+		tx.WriteSet = append(tx.WriteSet, rowID)
+		return nil
+	}
+	if err := u.checkWrite(tx, row); err != nil {
+		return err
+	}
+	u.logUndo(tx, row)
+	row.Data, row.Deleted, row.TxID = data, false, tx.ID
+	return nil
+}
+
+// DeleteRow delete-marks the row tx sees, logging its before-image first
+func (u *UndoStore) DeleteRow(txID, rowID string) error {
+	if _, err := u.ReadRow(txID, rowID); err != nil {
+		return err
+	}
+	tx, row := u.Transactions[txID], u.Rows[rowID]
+	if err := u.checkWrite(tx, row); err != nil {
+		return err
+	}
+	u.logUndo(tx, row)
+	row.Deleted, row.TxID = true, tx.ID
+	return nil
+}
+
+// Commit commits a transaction. Its undo records stay for older snapshots
+// until purge.
+func (u *UndoStore) Commit(txID string) error {
+	tx, err := u.activeTransaction(txID)
+	if err != nil {
+		return err
+	}
+	u.GlobalTimestamp++
+	commitTime := u.GlobalTimestamp
+	tx.CommitTime = &commitTime
+	tx.Status = TxCommitted
+	return nil
+}
+
+// Abort rolls a transaction back by applying its undo records to the rows
+// it changed, newest first, which costs one step per change
+func (u *UndoStore) Abort(txID string) error {
+	tx, err := u.activeTransaction(txID)
+	if err != nil {
+		return err
+	}
+	tx.Status = TxAborted
+
+	for _, rowID := range tx.WriteSet {
+		for row := u.Rows[rowID]; row != nil && row.TxID == txID; row = u.Rows[rowID] {
+			rec := u.Undo[row.RollPtr]
+			delete(u.Undo, rec.ID)
+			u.RollbackCost[txID]++
+			if rec.Absent {
+				delete(u.Rows, rowID)
+				continue
+			}
+			row.Data, row.Deleted, row.TxID, row.RollPtr = rec.Data, rec.Deleted, rec.Writer, rec.Prev
+		}
+	}
+	return nil
+}
+
+// Cleanup purges undo records no snapshot needs: once the change a record
+// undoes committed at or before the horizon, every snapshot sees it, so the
+// record and every older one of the row can go. Delete-marked rows whose
+// delete every snapshot sees are removed too.
+func (u *UndoStore) Cleanup() Cleanup {
+	horizon, heldBy := u.GlobalTimestamp, ""
+	for _, id := range u.activeTransactions() {
+		if tx := u.Transactions[id]; tx.Snapshot.Timestamp < horizon {
+			horizon, heldBy = tx.Snapshot.Timestamp, id
+		}
+	}
+	cleanup := Cleanup{Horizon: horizon, HeldBy: heldBy, Removed: []string{}}
+	visibleToAll := func(txID string) bool {
+		tx := u.Transactions[txID]
+		return tx.Status == TxCommitted && *tx.CommitTime <= horizon
+	}
+
+	rowIDs := make([]string, 0, len(u.Rows))
+	for id := range u.Rows {
+		rowIDs = append(rowIDs, id)
+	}
+	sort.Strings(rowIDs)
+
+	for _, rowID := range rowIDs {
+		row := u.Rows[rowID]
+		// The newest record that must stay, if any, keeps the chain pointer
+		var keep *UndoRecord
+		for next := row.RollPtr; next != ""; {
+			rec := u.Undo[next]
+			next = rec.Prev
+			if !visibleToAll(rec.TxID) {
+				keep = rec
+				continue
+			}
+			for purge := rec; purge != nil; purge = u.Undo[purge.Prev] {
+				cleanup.Removed = append(cleanup.Removed, purge.ID)
+				delete(u.Undo, purge.ID)
+			}
+			if keep != nil {
+				keep.Prev = ""
+			} else {
+				row.RollPtr = ""
+			}
+			break
+		}
+		if row.Deleted && row.RollPtr == "" && visibleToAll(row.TxID) {
+			delete(u.Rows, rowID)
+			cleanup.Removed = append(cleanup.Removed, rowID)
+		}
+	}
+	cleanup.Kept = len(u.Undo)
+	return cleanup
+}
+
+// Footprint counts the store's rows and undo records
+func (u *UndoStore) Footprint() Footprint {
+	return Footprint{Rows: len(u.Rows), Tuples: len(u.Rows), UndoRecords: len(u.Undo)}
+}
+
+// InsertInitialData adds some initial rows for testing
+func (u *UndoStore) InsertInitialData() {
+	InsertInitialData(u)
+}
+
+// Clone creates a deep copy of the store
+func (u *UndoStore) Clone() *UndoStore {
+	clone := &UndoStore{
+		Transactions:    make(map[string]*Transaction),
+		Rows:            make(map[string]*UndoRow),
+		Undo:            make(map[string]*UndoRecord),
+		GlobalTimestamp: u.GlobalTimestamp,
+		Isolation:       u.Isolation,
+		RollbackCost:    make(map[string]int),
+		txSeq:           u.txSeq,
+		undoSeq:         u.undoSeq,
+	}
+	for id, tx := range u.Transactions {
+		txCopy := *tx
+		txCopy.ReadSet = append([]string{}, tx.ReadSet...)
+		txCopy.ScanSet = append([]string{}, tx.ScanSet...)
+		txCopy.WriteSet = append([]string{}, tx.WriteSet...)
+		txCopy.Snapshot.Concurrent = append([]string{}, tx.Snapshot.Concurrent...)
+		clone.Transactions[id] = &txCopy
+	}
+	// Row and undo data maps are never modified in place, only replaced
+	for id, row := range u.Rows {
+		rowCopy := *row
+		clone.Rows[id] = &rowCopy
+	}
+	for id, rec := range u.Undo {
+		recCopy := *rec
+		clone.Undo[id] = &recCopy
+	}
+	for id, cost := range u.RollbackCost {
+		clone.RollbackCost[id] = cost
+	}
+	return clone
+}
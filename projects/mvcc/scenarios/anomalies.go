@@ -0,0 +1,136 @@
+package scenarios
+
+// The anomaly lab: one interleaving per classic anomaly, each run at a level
+// that allows it and then checked. The check builds the serialization graph
+// of the executed history and ends with a verdict naming the anomalies that
+// occurred and whether the isolation level permits them.
+
+// anomalyScenario runs script and then checks the history it produced
+func anomalyScenario(id, name, description, script string) Scenario {
+	return Scenario{
+		ID:          id,
+		Name:        name,
+		Description: description,
+		Config: map[string]interface{}{
+			"initialData": true,
+		},
+		Operations: []Operation{
+			{Type: "script", Params: map[string]interface{}{"script": script}},
+			{Type: "check", Params: map[string]interface{}{}},
+		},
+	}
+}
+
+// AnomalyDirtyRead reads a write that is later rolled back
+func AnomalyDirtyRead() Scenario {
+	return anomalyScenario(
+		"anomaly-dirty-read",
+		"Anomaly Lab: Dirty Read",
+		"T2 runs at READ UNCOMMITTED and reads Bob's new email while T1 has not committed. T1 then rolls back, so T2 acted on data that never existed. The checker finds the aborted read, which alone makes the history not serializable",
+		`T1: BEGIN
+T1: WRITE users:2 id=2 name=Bob email=bob@example.net
+T2: BEGIN ISOLATION LEVEL READ UNCOMMITTED
+T2: READ users:2   -- sees T1's uncommitted version
+T1: ROLLBACK
+T2: COMMIT`,
+	)
+}
+
+// AnomalyNonRepeatableRead reads the same row twice at READ COMMITTED
+func AnomalyNonRepeatableRead() Scenario {
+	return anomalyScenario(
+		"anomaly-non-repeatable-read",
+		"Anomaly Lab: Non-Repeatable Read",
+		"T1 reads Alice at READ COMMITTED, T2 updates her and commits, and T1's second read returns the new version. T1 must come before T2, as it read what T2 replaced, and after it, as it read what T2 wrote",
+		`T1: BEGIN ISOLATION LEVEL READ COMMITTED
+T1: READ users:1
+T2: BEGIN
+T2: WRITE users:1 id=1 name=Alice email=alice@example.org
+T2: COMMIT
+T1: READ users:1   -- a new statement snapshot sees T2's commit
+T1: COMMIT`,
+	)
+}
+
+// AnomalyPhantom scans the users twice while another transaction inserts
+// one, once at READ COMMITTED and once at REPEATABLE READ
+func AnomalyPhantom() Scenario {
+	return anomalyScenario(
+		"anomaly-phantom",
+		"Anomaly Lab: Phantom",
+		"T1 at READ COMMITTED and T3 at REPEATABLE READ each scan the users twice, while T2 inserts Carol and commits in between. T1's second scan finds a phantom row. T3's transaction snapshot keeps both of its scans the same, so it has only an anti-dependency on T2 and no anomaly",
+		`T1: BEGIN ISOLATION LEVEL READ COMMITTED
+T3: BEGIN ISOLATION LEVEL REPEATABLE READ
+T1: SCAN users:; T3: SCAN users:
+T2: BEGIN
+T2: WRITE users:3 id=3 name=Carol email=carol@example.com
+T2: COMMIT
+T1: SCAN users:   -- Carol appears
+T3: SCAN users:   -- still two users
+T1: COMMIT; T3: COMMIT`,
+	)
+}
+
+// AnomalyLostUpdate raises a price twice at READ COMMITTED, and one of the
+// raises is lost
+func AnomalyLostUpdate() Scenario {
+	return anomalyScenario(
+		"anomaly-lost-update",
+		"Anomaly Lab: Lost Update",
+		"T1 and T2 both read the Widget at 9.99 at READ COMMITTED. T1 raises it by 1, and T2, meaning to raise it by 2, waits for T1's row lock. Once T1 commits, READ COMMITTED applies T2's write to the newest version, overwriting T1's raise with a price computed before it",
+		`T1: BEGIN ISOLATION LEVEL READ COMMITTED
+T2: BEGIN ISOLATION LEVEL READ COMMITTED
+T1: READ products:1; T2: READ products:1
+T1: WRITE products:1 id=1 name=Widget price=10.99
+T2: WRITE products:1 id=1 name=Widget price=11.99   -- waits for T1
+T1: COMMIT
+T2: COMMIT`,
+	)
+}
+
+// AnomalyWriteSkew is the on-call doctors at REPEATABLE READ, where, unlike
+// in WriteSkew, both commits succeed
+func AnomalyWriteSkew() Scenario {
+	return anomalyScenario(
+		"anomaly-write-skew",
+		"Anomaly Lab: Write Skew",
+		"The on-call doctors at REPEATABLE READ. T1 and T2 each see both Alice and Bob on call and take a different one off. Snapshot isolation only stops writes to the same row, so both commit and nobody is on call. Each read a row the other then wrote: two rw anti-dependencies forming a cycle",
+		`T0: BEGIN
+T0: WRITE users:1 id=1 name=Alice onCall=true
+T0: WRITE users:2 id=2 name=Bob onCall=true
+T0: COMMIT
+T1: BEGIN ISOLATION LEVEL REPEATABLE READ
+T2: BEGIN ISOLATION LEVEL REPEATABLE READ
+T1: READ users:1; T1: READ users:2
+T2: READ users:1; T2: READ users:2
+T1: WRITE users:1 id=1 name=Alice onCall=false
+T2: WRITE users:2 id=2 name=Bob onCall=false
+T1: COMMIT; T2: COMMIT`,
+	)
+}
+
+// AnomalyReadOnly is the read-only transaction anomaly of Fekete, O'Neil and
+// O'Neil: under snapshot isolation the two updaters alone are serializable,
+// but a report that only reads can observe a state no serial order produces
+func AnomalyReadOnly() Scenario {
+	return anomalyScenario(
+		"anomaly-read-only",
+		"Anomaly Lab: Read-Only Anomaly",
+		"Checking and savings start at 0. T2 withdraws 10 from checking and charges a fee of 1 if the total would go negative. Before it writes, T1 deposits 20 into savings and commits, and report T3 sees the deposit but no withdrawal. T2's snapshot predates the deposit, so it charges the fee, which T3's balances say was not due. At SERIALIZABLE T2's commit would fail",
+		`T0: BEGIN
+T0: WRITE accounts:checking balance=0
+T0: WRITE accounts:savings balance=0
+T0: COMMIT
+T2: BEGIN ISOLATION LEVEL REPEATABLE READ
+T2: READ accounts:checking; T2: READ accounts:savings
+T1: BEGIN ISOLATION LEVEL REPEATABLE READ
+T1: READ accounts:savings
+T1: WRITE accounts:savings balance=20
+T1: COMMIT
+T3: BEGIN ISOLATION LEVEL REPEATABLE READ
+T3: READ accounts:checking; T3: READ accounts:savings   -- 0 and 20
+T3: COMMIT
+T2: WRITE accounts:checking balance=-11   -- withdraws 10 plus the fee
+T2: COMMIT`,
+	)
+}
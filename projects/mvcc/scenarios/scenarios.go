@@ -0,0 +1,382 @@
+package scenarios
+
+// Scenario represents a predefined MVCC scenario
+type Scenario struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Config      map[string]interface{} `json:"config"`
+	Operations  []Operation            `json:"operations"`
+}
+
+// Operation represents an operation to perform
+type Operation struct {
+	Type   string                 `json:"type"` // begin, read, write, delete, commit, abort, gc, script, time-travel, compare, check
+	Params map[string]interface{} `json:"params"`
+}
+
+// GetScenarios returns all available scenarios
+func GetScenarios() []Scenario {
+	return []Scenario{
+		ConcurrentSessions(),
+		LostUpdate(),
+		LostUpdateFirstCommitter(),
+		NonRepeatableRead(),
+		WriteSkew(),
+		PostgresVisibility(),
+		PostgresReinsert(),
+		DeleteTombstone(),
+		IdleInTransactionBloat(),
+		Savepoints(),
+		TimeTravel(),
+		StorageComparison(),
+		AnomalyDirtyRead(),
+		AnomalyNonRepeatableRead(),
+		AnomalyPhantom(),
+		AnomalyLostUpdate(),
+		AnomalyWriteSkew(),
+		AnomalyReadOnly(),
+	}
+}
+
+// GetScenario returns a scenario by ID
+func GetScenario(id string) *Scenario {
+	for _, s := range GetScenarios() {
+		if s.ID == id {
+			return &s
+		}
+	}
+	return nil
+}
+
+// ConcurrentSessions interleaves three sessions to show that each transaction
+// reads through the snapshot it took at BEGIN
+func ConcurrentSessions() Scenario {
+	return Scenario{
+		ID:          "concurrent-sessions",
+		Name:        "Concurrent Sessions",
+		Description: "T1 updates Alice while T2 is active. T2 keeps seeing the old version even after T1 commits, while T3, which begins later, sees the new one",
+		Config: map[string]interface{}{
+			"initialData": true,
+		},
+		Operations: []Operation{
+			{Type: "script", Params: map[string]interface{}{"script": `T1: BEGIN; T2: BEGIN
+T1: WRITE users:1 id=1 name=Carol email=carol@example.com
+T2: READ users:1   -- T1 has not committed
+T1: COMMIT
+T2: READ users:1   -- T2's snapshot predates the commit
+T3: BEGIN
+T3: READ users:1
+T2: COMMIT; T3: COMMIT`}},
+		},
+	}
+}
+
+// lostUpdateScript has two sessions read a price and then both overwrite it,
+// which without conflict detection silently loses T1's update
+const lostUpdateScript = `T1: BEGIN; T2: BEGIN
+T1: READ products:1
+T2: READ products:1
+T1: WRITE products:1 id=1 name=Widget price=12
+T2: WRITE products:1 id=1 name=Widget price=15
+T1: COMMIT
+T2: COMMIT`
+
+// LostUpdate shows first-updater-wins: T2's write waits on T1's row lock and
+// fails with a serialization failure once T1 commits, as in PostgreSQL's
+// REPEATABLE READ
+func LostUpdate() Scenario {
+	return Scenario{
+		ID:          "lost-update",
+		Name:        "Lost Update (First Updater Wins)",
+		Description: "T1 and T2 both read the widget's price and write a new one. T2 blocks on the row T1 wrote, and when T1 commits T2 gets a serialization failure instead of overwriting T1's price",
+		Config: map[string]interface{}{
+			"initialData":  true,
+			"conflictMode": "first-updater-wins",
+			"blocking":     true,
+		},
+		Operations: []Operation{
+			{Type: "script", Params: map[string]interface{}{"script": lostUpdateScript}},
+		},
+	}
+}
+
+// LostUpdateFirstCommitter runs the same script under first-committer-wins,
+// where both writes succeed and the conflict surfaces at the later commit
+func LostUpdateFirstCommitter() Scenario {
+	return Scenario{
+		ID:          "lost-update-first-committer",
+		Name:        "Lost Update (First Committer Wins)",
+		Description: "The same interleaving with first-committer-wins: both writes proceed, T1 commits first, and T2's commit fails because T1 changed the row after T2's snapshot",
+		Config: map[string]interface{}{
+			"initialData":  true,
+			"conflictMode": "first-committer-wins",
+		},
+		Operations: []Operation{
+			{Type: "script", Params: map[string]interface{}{"script": lostUpdateScript}},
+		},
+	}
+}
+
+// NonRepeatableRead runs a READ COMMITTED and a REPEATABLE READ reader side
+// by side while a third session updates the row they read
+func NonRepeatableRead() Scenario {
+	return Scenario{
+		ID:          "non-repeatable-read",
+		Name:        "Non-Repeatable Read",
+		Description: "T1 reads at READ COMMITTED and T2 at REPEATABLE READ. After T3 updates Alice and commits, T1's next read takes a new statement snapshot and sees the change, while T2 still reads through its transaction snapshot",
+		Config: map[string]interface{}{
+			"initialData": true,
+		},
+		Operations: []Operation{
+			{Type: "script", Params: map[string]interface{}{"script": `T1: BEGIN ISOLATION LEVEL READ COMMITTED
+T2: BEGIN ISOLATION LEVEL REPEATABLE READ
+T1: READ users:1; T2: READ users:1
+T3: BEGIN
+T3: WRITE users:1 id=1 name=Alice email=alice@example.org
+T3: COMMIT
+T1: READ users:1   -- a new statement snapshot
+T2: READ users:1   -- the same transaction snapshot
+T1: COMMIT; T2: COMMIT`}},
+		},
+	}
+}
+
+// WriteSkew is the on-call doctors anomaly: two SERIALIZABLE transactions
+// each read both rows and then update a different one, which snapshot
+// isolation alone would allow. Each write adds an rw-antidependency, and the
+// two form the cycle that fails the second commit.
+func WriteSkew() Scenario {
+	return Scenario{
+		ID:          "write-skew",
+		Name:        "Write Skew",
+		Description: "Alice and Bob are both on call. T1 and T2 each check that both are, then take a different one off call. Their writes never touch the same row, so no write-write conflict stops them. At SERIALIZABLE each write adds an rw-antidependency to the dependency graph, the two form a cycle, and T2's commit fails",
+		Config: map[string]interface{}{
+			"initialData":    true,
+			"isolationLevel": "serializable",
+		},
+		Operations: []Operation{
+			{Type: "script", Params: map[string]interface{}{"script": `T0: BEGIN
+T0: WRITE users:1 id=1 name=Alice onCall=true
+T0: WRITE users:2 id=2 name=Bob onCall=true
+T0: COMMIT
+T1: BEGIN; T2: BEGIN
+T1: READ users:1; T1: READ users:2
+T2: READ users:1; T2: READ users:2
+T1: WRITE users:1 id=1 name=Alice onCall=false
+T2: WRITE users:2 id=2 name=Bob onCall=false
+T1: COMMIT
+T2: COMMIT   -- would leave nobody on call`}},
+		},
+	}
+}
+
+// PostgresVisibility runs under the postgres visibility model, so each read
+// is decided by xmin, xmax, the clog and an xmin:xmax:xip snapshot, and
+// leaves hint bits behind as pageinspect would show them
+func PostgresVisibility() Scenario {
+	return Scenario{
+		ID:          "postgres-visibility",
+		Name:        "PostgreSQL Tuple Visibility",
+		Description: "T1 updates Alice, setting xmax on the old tuple. T2's snapshot lists T1 in xip, so T2 keeps the old tuple even after T1 commits. T3 starts later, resolves T1 through the clog and sets hint bits. T4's delete of Bob aborts, and T5, the first reader whose snapshot follows it, marks its xmax invalid",
+		Config: map[string]interface{}{
+			"initialData":     true,
+			"visibilityModel": "postgres",
+		},
+		Operations: []Operation{
+			{Type: "script", Params: map[string]interface{}{"script": `T1: BEGIN; T2: BEGIN
+T1: WRITE users:1 id=1 name=Alice email=alice@example.org
+T1: READ users:1   -- cmin of the new tuple is below the read's curcid
+T2: READ users:1   -- xmax of the old tuple is in T2's xip
+T1: COMMIT
+T2: READ users:1   -- still in xip: the snapshot does not change
+T3: BEGIN
+T3: READ users:1   -- clog says committed: HEAP_XMIN_COMMITTED
+T4: BEGIN
+T4: DELETE users:2
+T4: ROLLBACK
+T3: READ users:2   -- xmax is at or above T3's snapshot xmax: in progress
+T5: BEGIN
+T5: READ users:2   -- clog says aborted: HEAP_XMAX_INVALID
+T2: COMMIT; T3: COMMIT; T5: COMMIT`}},
+		},
+	}
+}
+
+// PostgresReinsert writes a row again after its delete committed. The
+// deleted tuple keeps its deleter's xmax, so snapshots that saw the delete
+// go on finding no row while the write starts a fresh tuple
+func PostgresReinsert() Scenario {
+	return Scenario{
+		ID:          "postgres-reinsert",
+		Name:        "PostgreSQL Reinsert After Delete",
+		Description: "T1 deletes Bob and commits. T2 at REPEATABLE READ finds the row deleted. T3 then writes Bob again, inserting a new tuple rather than updating the dead one, whose xmax still names T1. T2 keeps finding the row deleted, and only T4, which begins after T3 commits, reads the new Bob",
+		Config: map[string]interface{}{
+			"initialData":     true,
+			"visibilityModel": "postgres",
+		},
+		Operations: []Operation{
+			{Type: "script", Params: map[string]interface{}{"script": `T1: BEGIN; T1: DELETE users:2; T1: COMMIT
+T2: BEGIN ISOLATION LEVEL REPEATABLE READ
+T2: READ users:2   -- xmax committed before the snapshot: deleted
+T3: BEGIN
+T3: WRITE users:2 id=2 name=Bob email=bob@example.net   -- a fresh tuple
+T3: COMMIT
+T2: READ users:2   -- the tombstone's xmax is still T1's: deleted
+T4: BEGIN
+T4: READ users:2   -- the new tuple
+T2: COMMIT; T4: COMMIT`}},
+		},
+	}
+}
+
+// DeleteTombstone shows a delete as a marker on the version the deleter
+// sees: older snapshots keep reading it, newer ones find no row, and an
+// aborted delete leaves the row as it was
+func DeleteTombstone() Scenario {
+	return Scenario{
+		ID:          "delete-tombstone",
+		Name:        "Deletes and Tombstones",
+		Description: "T1 deletes Bob while T2 is active. T2 still reads Bob after T1 commits, but T3, which begins later, finds the row deleted. T4's delete of Alice rolls back and T3 reads Alice as before",
+		Config: map[string]interface{}{
+			"initialData": true,
+		},
+		Operations: []Operation{
+			{Type: "script", Params: map[string]interface{}{"script": `T1: BEGIN; T2: BEGIN
+T1: DELETE users:2
+T2: READ users:2   -- the delete has not committed
+T1: COMMIT
+T2: READ users:2   -- T2's snapshot predates the delete
+T3: BEGIN
+T3: READ users:2   -- deleted
+T4: BEGIN
+T4: DELETE users:1
+T4: ROLLBACK
+T3: READ users:1   -- the aborted delete is undone
+T2: COMMIT; T3: COMMIT`}},
+		},
+	}
+}
+
+// IdleInTransactionBloat shows a session left idle in a transaction holding
+// back VACUUM's horizon, so every update after its snapshot leaves a version
+// behind until it ends
+func IdleInTransactionBloat() Scenario {
+	return Scenario{
+		ID:          "idle-in-transaction-bloat",
+		Name:        "Idle in Transaction Bloat",
+		Description: "Idle reads the widget and then sits in its transaction while W updates the price three times and deletes Bob. VACUUM can only keep the replaced versions as recently dead, and dead tuples pile up. Once Idle commits, VACUUM removes them all",
+		Config: map[string]interface{}{
+			"initialData": true,
+		},
+		Operations: []Operation{
+			{Type: "script", Params: map[string]interface{}{"script": `Idle: BEGIN
+Idle: READ products:1   -- and then nothing: idle in transaction
+W: BEGIN; W: WRITE products:1 id=1 name=Widget price=11; W: COMMIT
+W: BEGIN; W: WRITE products:1 id=1 name=Widget price=12; W: COMMIT
+W: BEGIN; W: WRITE products:1 id=1 name=Widget price=13; W: COMMIT
+W: BEGIN; W: DELETE users:2; W: COMMIT
+V: VACUUM   -- Idle's snapshot holds the horizon back
+Idle: READ products:1   -- still reads the original price
+Idle: COMMIT
+V: VACUUM   -- nothing holds the horizon now`}},
+		},
+	}
+}
+
+// Savepoints shows subtransactions: writes after a savepoint carry the
+// subtransaction's xid, so rolling back to it discards only them, while a
+// released savepoint's writes stay invisible to others until the
+// transaction commits
+func Savepoints() Scenario {
+	return Scenario{
+		ID:          "savepoints",
+		Name:        "Savepoints and Subtransactions",
+		Description: "T1 renames Alice, sets savepoint a, zeroes the widget's price and deletes Bob, then renames Alice again inside savepoint b and releases it. T2 sees none of it. Rolling back to a discards everything after a, including the released b, but keeps the first rename",
+		Config: map[string]interface{}{
+			"initialData":     true,
+			"visibilityModel": "postgres",
+		},
+		Operations: []Operation{
+			{Type: "script", Params: map[string]interface{}{"script": `T1: BEGIN
+T1: WRITE users:1 id=1 name=Carol email=carol@example.com
+T1: SAVEPOINT a
+T1: WRITE products:1 id=1 name=Widget price=0   -- a mistake
+T1: DELETE users:2
+T1: SAVEPOINT b
+T1: WRITE users:1 id=1 name=Dave email=dave@example.com
+T1: RELEASE b
+T1: READ users:1   -- its sub-committed write is its own
+T2: BEGIN
+T2: READ users:1   -- sub-committed, but T1 has not committed
+T1: ROLLBACK TO a   -- discards the price, the delete and the released b
+T1: READ users:1
+T1: READ users:2   -- the delete is undone
+T1: RELEASE a
+T1: COMMIT
+T2: READ users:1   -- still T2's snapshot
+T3: BEGIN
+T3: READ users:1
+T2: COMMIT; T3: COMMIT`}},
+		},
+	}
+}
+
+// TimeTravel reads rows as of past timestamps, which works for as long as
+// the versions survive: once VACUUM removes them, history before its
+// horizon is gone
+func TimeTravel() Scenario {
+	return Scenario{
+		ID:          "time-travel",
+		Name:        "Time Travel and History Retention",
+		Description: "W raises the widget's price twice and deletes Bob. R reads both rows as of earlier timestamps, until VACUUM reclaims the old versions and reads before its horizon fail. The scrubber replays the table at every timestamp before and after the VACUUM",
+		Config: map[string]interface{}{
+			"initialData": true,
+		},
+		Operations: []Operation{
+			{Type: "script", Params: map[string]interface{}{"script": `W: BEGIN; W: WRITE products:1 id=1 name=Widget price=11; W: COMMIT
+W: BEGIN; W: WRITE products:1 id=1 name=Widget price=12; W: COMMIT
+W: BEGIN; W: DELETE users:2; W: COMMIT
+R: READ products:1 AS OF 2   -- the original price
+R: READ products:1 AS OF 3
+R: READ users:2 AS OF 4
+R: READ users:2 AS OF 5   -- deleted by then`}},
+			{Type: "time-travel", Params: map[string]interface{}{}},
+			{Type: "script", Params: map[string]interface{}{"script": `V: VACUUM   -- nothing holds the horizon back
+R: READ products:1 AS OF 3   -- that version is gone
+R: READ products:1 AS OF 5`}},
+			{Type: "time-travel", Params: map[string]interface{}{}},
+		},
+	}
+}
+
+// StorageComparison runs one workload against the append-only store and the
+// in-place store with an undo log: the same reads see the same data, but
+// old versions live in different places, a rollback costs different work,
+// and cleanup reclaims different things
+func StorageComparison() Scenario {
+	return Scenario{
+		ID:          "storage-comparison",
+		Name:        "Append-Only vs Undo Log",
+		Description: "Old holds a snapshot while W raises the widget's price three times. Old's read walks three versions back in either store, but the append-only table grows while the in-place table stays at one row each and the undo log grows instead. A's rollback is free for the append-only store and replays undo for the in-place one",
+		Config: map[string]interface{}{
+			"initialData": true,
+		},
+		Operations: []Operation{
+			{Type: "compare", Params: map[string]interface{}{"script": `Old: BEGIN
+Old: READ products:1
+W: BEGIN; W: WRITE products:1 id=1 name=Widget price=11; W: COMMIT
+W: BEGIN; W: WRITE products:1 id=1 name=Widget price=12; W: COMMIT
+W: BEGIN; W: WRITE products:1 id=1 name=Widget price=13; W: COMMIT
+Old: READ products:1   -- three versions back
+New: BEGIN; New: READ products:1; New: COMMIT
+A: BEGIN
+A: WRITE users:1 id=1 name=Carol email=carol@example.com
+A: DELETE users:2
+A: ABORT
+V: VACUUM   -- Old holds the horizon back
+Old: COMMIT
+V: VACUUM`}},
+		},
+	}
+}
@@ -0,0 +1,109 @@
+package simulation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ersantana/db-internals/packages/protocol"
+	"github.com/ersantana/db-internals/packages/simulation/engine"
+	"github.com/ersantana/db-internals/projects/mvcc/internal"
+)
+
+// dependencyKinds are the edge kinds of the serialization graph, in the
+// order they are shown, with their titles and colors
+var dependencyKinds = []struct {
+	kind, title, color string
+}{
+	{internal.DepWriteWrite, "Write-Write Dependencies", "#8b5cf6"},
+	{internal.DepWriteRead, "Write-Read Dependencies", "#3b82f6"},
+	{internal.DepReadWrite, "Read-Write Anti-Dependencies", "#f59e0b"},
+}
+
+// PrepareCheckHistory generates steps that check the history the store has
+// executed: the serialization graph of its committed transactions, one kind
+// of edge at a time, the cycles in it, each anomaly found and a final
+// verdict on whether the history is serializable
+func (sim *MVCCSimulation) PrepareCheckHistory() {
+	sim.operation = "check"
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+
+	report := sim.store.CheckHistory()
+	store := sim.store.Clone()
+	data := storeData(store)
+	data["history"] = store.History
+	data["historyReport"] = report
+
+	sim.addDataStep(
+		"Check History",
+		fmt.Sprintf("Building the serialization graph of the %d committed transaction(s) from the %d operation(s) the store executed. Aborted transactions leave no edges, but reading their data is still an anomaly",
+			len(report.Transactions), len(store.History)),
+		[]protocol.Highlight{},
+		data,
+	)
+
+	for _, kind := range dependencyKinds {
+		edges := []string{}
+		highlights := []protocol.Highlight{}
+		for _, d := range report.Dependencies {
+			if d.Kind == kind.kind {
+				edges = append(edges, d.String())
+				highlights = append(highlights, protocol.Highlight{Type: "edge", ID: d.EdgeID(), Color: kind.color, Animation: "fadeIn"})
+			}
+		}
+		description := "None"
+		if len(edges) > 0 {
+			description = strings.Join(edges, ", ")
+		}
+		sim.addDataStep(kind.title, description, highlights, data)
+	}
+
+	cycleHighlights := []protocol.Highlight{}
+	cycles := []string{}
+	for _, cycle := range report.Cycles {
+		cycles = append(cycles, strings.Join(append(append([]string{}, cycle...), cycle[0]), " -> "))
+		for i, from := range cycle {
+			cycleHighlights = append(cycleHighlights, protocol.Highlight{Type: "edge", ID: from + "->" + cycle[(i+1)%len(cycle)], Color: "#ef4444", Animation: "flash"})
+		}
+	}
+	description := "The graph has no cycle, so some serial order satisfies every dependency"
+	if len(cycles) > 0 {
+		description = fmt.Sprintf("The graph has %d cycle(s), and no serial order can satisfy one: %s", len(cycles), strings.Join(cycles, "; "))
+	}
+	sim.addDataStep("Find Cycles", description, cycleHighlights, data)
+
+	for _, anomaly := range report.Anomalies {
+		color := "#f59e0b"
+		if !anomaly.Allowed {
+			color = "#ef4444"
+		}
+		highlights := []protocol.Highlight{}
+		for _, id := range anomaly.Transactions {
+			highlights = append(highlights, protocol.Highlight{Type: "row", ID: id, Color: color, Animation: "pulse"})
+		}
+		sim.addDataStep(anomaly.Kind.Title(), anomaly.Description, highlights, data)
+	}
+
+	sim.addDataStep("Verdict", historyVerdict(report), []protocol.Highlight{}, data)
+}
+
+// historyVerdict sums up a history report
+func historyVerdict(report internal.HistoryReport) string {
+	found := make([]string, len(report.Anomalies))
+	for i, a := range report.Anomalies {
+		judgement := "allowed by"
+		if !a.Allowed {
+			judgement = "which should not happen at"
+		}
+		found[i] = fmt.Sprintf("%s among %s, %s %s", strings.ToLower(a.Kind.Title()), strings.Join(a.Transactions, ", "), judgement, a.Isolation.SQL())
+	}
+
+	verdict := fmt.Sprintf("The history is not serializable. %d anomaly(ies): %s", len(found), strings.Join(found, "; "))
+	if report.Serializable {
+		verdict = fmt.Sprintf("The history is serializable: it has the same effect as running %s one at a time", strings.Join(report.SerialOrder, ", "))
+		if len(found) > 0 {
+			verdict += fmt.Sprintf(". Still, %s", strings.Join(found, "; "))
+		}
+	}
+	return verdict
+}
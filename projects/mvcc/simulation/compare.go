@@ -0,0 +1,238 @@
+package simulation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ersantana/db-internals/packages/protocol"
+	"github.com/ersantana/db-internals/packages/simulation/engine"
+	"github.com/ersantana/db-internals/projects/mvcc/internal"
+)
+
+// StatementResult is what one statement did under one storage strategy
+type StatementResult struct {
+	Outcome   string                 `json:"outcome"`
+	Detail    string                 `json:"detail"`
+	Data      map[string]interface{} `json:"data,omitempty"` // What a read returned
+	Path      []string               `json:"path,omitempty"` // What a read examined
+	Footprint internal.Footprint     `json:"footprint"`
+}
+
+// Comparison is one statement run under both storage strategies
+type Comparison struct {
+	Step       int             `json:"step"`
+	Statement  string          `json:"statement"`
+	AppendOnly StatementResult `json:"appendOnly"`
+	InPlace    StatementResult `json:"inPlace"`
+	Differs    bool            `json:"differs"` // The strategies returned different outcomes or data
+}
+
+// StrategySummary totals what a script cost under one strategy
+type StrategySummary struct {
+	Strategy     string             `json:"strategy"`
+	ReadCost     int                `json:"readCost"`     // Versions or undo records examined by all reads
+	RollbackCost int                `json:"rollbackCost"` // Undo records applied by rollbacks
+	Cleaned      int                `json:"cleaned"`      // Versions, undo records and rows reclaimed
+	Footprint    internal.Footprint `json:"footprint"`
+}
+
+// strategyRun tracks the sessions of a compared script on one strategy
+type strategyRun struct {
+	store    internal.Storage
+	sessions map[string]string // Session name -> its open transaction
+	failed   map[string]bool   // Sessions whose transaction a conflict aborted
+	summary  StrategySummary
+}
+
+func newStrategyRun(store internal.Storage) *strategyRun {
+	return &strategyRun{
+		store:    store,
+		sessions: make(map[string]string),
+		failed:   make(map[string]bool),
+		summary:  StrategySummary{Strategy: store.Strategy()},
+	}
+}
+
+// execute runs one statement and describes what the strategy did
+func (run *strategyRun) execute(st internal.Statement) StatementResult {
+	result := StatementResult{Outcome: OutcomeOK}
+	detail, err := run.apply(st, &result)
+	if err != nil {
+		result.Outcome, detail = OutcomeError, "ERROR: "+err.Error()
+		if errors.Is(err, internal.ErrSerializationFailure) {
+			run.failed[st.Session] = true
+		}
+	}
+	result.Detail = detail
+	result.Footprint = run.store.Footprint()
+	run.summary.Footprint = result.Footprint
+	return result
+}
+
+func (run *strategyRun) apply(st internal.Statement, result *StatementResult) (string, error) {
+	store := run.store
+	txID, open := run.sessions[st.Session]
+	switch {
+	case st.Savepoint != "" || st.AsOf != 0 || st.Command == internal.CmdScan:
+		return "", fmt.Errorf("%s is not part of the storage comparison", st.Command)
+	case st.NeedsTransaction() && !open:
+		return "", fmt.Errorf("%s has no open transaction; it must BEGIN first", st.Session)
+	case run.failed[st.Session] && (st.Command == internal.CmdCommit || st.Command == internal.CmdAbort):
+		delete(run.sessions, st.Session)
+		delete(run.failed, st.Session)
+		return fmt.Sprintf("%s was aborted by its error, so %s ends it with a rollback", txID, st.Command), nil
+	case run.failed[st.Session]:
+		return "", fmt.Errorf("current transaction %s is aborted, commands ignored until end of transaction block", txID)
+	}
+
+	switch st.Command {
+	case internal.CmdBegin:
+		if open {
+			return "", fmt.Errorf("%s already has open transaction %s", st.Session, txID)
+		}
+		tx := store.BeginTransaction(st.Isolation)
+		run.sessions[st.Session] = tx.ID
+		return fmt.Sprintf("Begins %s with a snapshot at timestamp %d", tx.ID, tx.Snapshot.Timestamp), nil
+
+	case internal.CmdRead:
+		read, err := store.ReadRow(txID, st.Row)
+		run.summary.ReadCost += len(read.Path)
+		result.Path = read.Path
+		if err != nil {
+			return "", err
+		}
+		result.Data = read.Data
+		return fmt.Sprintf("Reads %v from %s, examining %d: %s", read.Data, read.Source, len(read.Path), strings.Join(read.Path, ", ")), nil
+
+	case internal.CmdWrite:
+		if err := store.WriteRow(txID, st.Row, st.Data); err != nil {
+			return "", err
+		}
+		if store.Strategy() == internal.StrategyInPlace {
+			return fmt.Sprintf("Overwrites %s in place after logging its before-image to the undo log", st.Row), nil
+		}
+		return fmt.Sprintf("Appends a new version of %s to the table, at the head of its chain", st.Row), nil
+
+	case internal.CmdDelete:
+		if err := store.DeleteRow(txID, st.Row); err != nil {
+			return "", err
+		}
+		if store.Strategy() == internal.StrategyInPlace {
+			return fmt.Sprintf("Delete-marks %s in place after logging its before-image", st.Row), nil
+		}
+		return fmt.Sprintf("Marks the version of %s it sees deleted", st.Row), nil
+
+	case internal.CmdCommit:
+		if err := store.Commit(txID); err != nil {
+			return "", err
+		}
+		delete(run.sessions, st.Session)
+		return fmt.Sprintf("Commits %s", txID), nil
+
+	case internal.CmdAbort:
+		if err := store.Abort(txID); err != nil {
+			return "", err
+		}
+		delete(run.sessions, st.Session)
+		if undo, ok := store.(*internal.UndoStore); ok {
+			cost := undo.RollbackCost[txID]
+			run.summary.RollbackCost += cost
+			return fmt.Sprintf("Rolls %s back by applying %d undo record(s) to the rows it changed", txID, cost), nil
+		}
+		return fmt.Sprintf("Aborts %s: its versions are dropped and its deletes undone, and the rows were never overwritten", txID), nil
+
+	case internal.CmdVacuum:
+		if open {
+			return "", fmt.Errorf("VACUUM cannot run inside a transaction block")
+		}
+		cleanup := store.Cleanup()
+		run.summary.Cleaned += len(cleanup.Removed)
+		work := "VACUUM scans the table"
+		if store.Strategy() == internal.StrategyInPlace {
+			work = "Purge walks the undo log"
+		}
+		detail := fmt.Sprintf("%s up to horizon %d and reclaims nothing", work, cleanup.Horizon)
+		if len(cleanup.Removed) > 0 {
+			detail = fmt.Sprintf("%s up to horizon %d and reclaims %d: %s", work, cleanup.Horizon, len(cleanup.Removed), strings.Join(cleanup.Removed, ", "))
+		}
+		if cleanup.Kept > 0 {
+			detail += fmt.Sprintf(". %d old version(s) stay", cleanup.Kept)
+			if cleanup.HeldBy != "" {
+				detail += fmt.Sprintf(" for %s", cleanup.HeldBy)
+			}
+		}
+		return detail, nil
+	}
+	return "", fmt.Errorf("unknown command %q", st.Command)
+}
+
+// PrepareCompare runs a script (see internal.ParseScript) against both
+// storage strategies, each starting from the initial data at the
+// simulation's default isolation level, with one step per statement.
+// Writers do not wait, so a write to a row another transaction holds fails
+// under both. Savepoints, scans and AS OF reads are not compared.
+func (sim *MVCCSimulation) PrepareCompare(script string) error {
+	statements, err := internal.ParseScript(script)
+	if err != nil {
+		return err
+	}
+
+	sim.operation = "compare"
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+
+	appendOnly := internal.NewMVCCStore()
+	appendOnly.Isolation = sim.store.Isolation
+	appendOnly.Blocking = false
+	appendOnly.InsertInitialData()
+	inPlace := internal.NewUndoStore()
+	inPlace.Isolation = sim.store.Isolation
+	inPlace.InsertInitialData()
+
+	runs := []*strategyRun{newStrategyRun(appendOnly), newStrategyRun(inPlace)}
+	comparisons := []Comparison{}
+	data := func() map[string]interface{} {
+		return map[string]interface{}{
+			"appendOnly":  storeData(appendOnly.Clone()),
+			"inPlace":     inPlace.Clone(),
+			"comparisons": append([]Comparison{}, comparisons...),
+		}
+	}
+
+	sim.addDataStep(
+		"Compare Storage",
+		fmt.Sprintf("Running %d statements against the append-only store, which keeps every version in the table, and the in-place store, which keeps old versions in an undo log", len(statements)),
+		[]protocol.Highlight{},
+		data(),
+	)
+
+	for _, st := range statements {
+		c := Comparison{
+			Step:       len(sim.steps),
+			Statement:  st.String(),
+			AppendOnly: runs[0].execute(st),
+			InPlace:    runs[1].execute(st),
+		}
+		c.Differs = c.AppendOnly.Outcome != c.InPlace.Outcome || !reflect.DeepEqual(c.AppendOnly.Data, c.InPlace.Data)
+		comparisons = append(comparisons, c)
+
+		description := fmt.Sprintf("Append-only: %s. In-place: %s", c.AppendOnly.Detail, c.InPlace.Detail)
+		if c.Differs {
+			description += ". The strategies disagree"
+		}
+		sim.addDataStep(st.String(), description, []protocol.Highlight{}, data())
+	}
+
+	summaries := []StrategySummary{runs[0].summary, runs[1].summary}
+	lines := make([]string, len(summaries))
+	for i, s := range summaries {
+		lines[i] = fmt.Sprintf("%s: reads examined %d, rollbacks applied %d undo record(s), cleanup reclaimed %d, and it ends with %d tuple(s) in the table and %d undo record(s)",
+			s.Strategy, s.ReadCost, s.RollbackCost, s.Cleaned, s.Footprint.Tuples, s.Footprint.UndoRecords)
+	}
+	final := data()
+	final["summary"] = summaries
+	sim.addDataStep("Comparison Complete", strings.Join(lines, ". "), []protocol.Highlight{}, final)
+	return nil
+}
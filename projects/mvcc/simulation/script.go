@@ -0,0 +1,413 @@
+package simulation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ersantana/db-internals/packages/protocol"
+	"github.com/ersantana/db-internals/packages/simulation/engine"
+	"github.com/ersantana/db-internals/projects/mvcc/internal"
+)
+
+// Lane event outcomes
+const (
+	OutcomeOK      = "ok"
+	OutcomeError   = "error"
+	OutcomeBlocked = "blocked" // The statement waits for another transaction
+	OutcomeQueued  = "queued"  // The session is blocked, so the statement waits its turn
+)
+
+// Lane is one session's row on the transaction timeline
+type Lane struct {
+	Session      string      `json:"session"`
+	Transactions []string    `json:"transactions"` // In the order the session began them
+	Events       []LaneEvent `json:"events"`
+}
+
+// LaneEvent is a statement on a lane, placed at the step that ran it
+type LaneEvent struct {
+	Step      int    `json:"step"`
+	TxID      string `json:"txId,omitempty"`
+	Statement string `json:"statement"`
+	Outcome   string `json:"outcome"`
+	Resumed   bool   `json:"resumed,omitempty"` // Ran after the session was unblocked
+	Detail    string `json:"detail"`
+}
+
+// scriptRun tracks the sessions of one script as it executes
+type scriptRun struct {
+	store    *internal.MVCCStore
+	sessions map[string]string               // Session name -> its open transaction
+	blocked  map[string][]internal.Statement // Blocked session -> statements waiting to run
+	lanes    []*Lane
+	history  []internal.TableStats // Table stats after each statement
+}
+
+func (run *scriptRun) lane(session string) *Lane {
+	for _, lane := range run.lanes {
+		if lane.Session == session {
+			return lane
+		}
+	}
+	lane := &Lane{Session: session, Transactions: []string{}, Events: []LaneEvent{}}
+	run.lanes = append(run.lanes, lane)
+	return lane
+}
+
+// snapshot deep-copies the lanes for a step's data
+func (run *scriptRun) snapshot() []Lane {
+	lanes := make([]Lane, len(run.lanes))
+	for i, lane := range run.lanes {
+		lanes[i] = Lane{
+			Session:      lane.Session,
+			Transactions: append([]string{}, lane.Transactions...),
+			Events:       append([]LaneEvent{}, lane.Events...),
+		}
+	}
+	return lanes
+}
+
+// PrepareScript generates one step per statement of an interleaving script
+// (see internal.ParseScript), run against the simulation's store. Each step
+// carries the timeline lanes of every session up to that statement.
+//
+// A write that must wait for another transaction blocks its session: later
+// statements of that session queue up behind it, and all of them run as soon
+// as the transaction it waits for commits or aborts.
+func (sim *MVCCSimulation) PrepareScript(script string) error {
+	statements, err := internal.ParseScript(script)
+	if err != nil {
+		return err
+	}
+
+	sim.operation = "script"
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+
+	run := &scriptRun{
+		store:    sim.store,
+		sessions: make(map[string]string),
+		blocked:  make(map[string][]internal.Statement),
+	}
+	for _, st := range statements {
+		run.lane(st.Session)
+	}
+	sessions := make([]string, len(run.lanes))
+	for i, lane := range run.lanes {
+		sessions[i] = lane.Session
+	}
+	sim.addDataStep(
+		"Script",
+		fmt.Sprintf("Running %d statements interleaved across sessions %s", len(statements), strings.Join(sessions, ", ")),
+		[]protocol.Highlight{},
+		sim.scriptData(run, nil),
+	)
+
+	for _, st := range statements {
+		if queue, waiting := run.blocked[st.Session]; waiting {
+			run.blocked[st.Session] = append(queue, st)
+			txID := run.sessions[st.Session]
+			holder := run.store.Transactions[txID].WaitingFor
+			sim.recordStatement(run, st, LaneEvent{
+				TxID:    txID,
+				Outcome: OutcomeQueued,
+				Detail:  fmt.Sprintf("%s is blocked waiting for %s, so this statement runs once %s commits or aborts", st.Session, holder, holder),
+			}, []protocol.Highlight{{Type: "row", ID: txID, Color: "#94a3b8"}})
+			continue
+		}
+		sim.execute(run, st, false)
+	}
+
+	for _, lane := range run.lanes {
+		if queue, waiting := run.blocked[lane.Session]; waiting {
+			txID := run.sessions[lane.Session]
+			sim.addDataStep(
+				"Still Blocked",
+				fmt.Sprintf("The script ended with %s waiting for %s; %d statement(s) never ran",
+					lane.Session, run.store.Transactions[txID].WaitingFor, len(queue)),
+				[]protocol.Highlight{{Type: "row", ID: txID, Color: "#f59e0b", Animation: "pulse"}},
+				sim.scriptData(run, nil),
+			)
+		}
+	}
+	return nil
+}
+
+// execute runs one statement, records it, and then resumes any session that
+// was waiting for a transaction that is no longer active
+func (sim *MVCCSimulation) execute(run *scriptRun, st internal.Statement, resumed bool) {
+	txID := run.sessions[st.Session]
+	conflicts := len(run.store.RWConflicts)
+	detail, highlights, err := sim.runStatement(run, st)
+	if st.Command == internal.CmdBegin && err == nil {
+		txID = run.sessions[st.Session]
+	}
+
+	event := LaneEvent{TxID: txID, Outcome: OutcomeOK, Resumed: resumed, Detail: detail}
+	switch {
+	case errors.Is(err, internal.ErrWouldBlock):
+		run.blocked[st.Session] = []internal.Statement{st}
+		event.Outcome = OutcomeBlocked
+		event.Detail = fmt.Sprintf("Blocked: %s. The write waits until %s commits or aborts", err, run.store.Transactions[txID].WaitingFor)
+		highlights = []protocol.Highlight{{Type: "row", ID: txID, Color: "#f59e0b", Animation: "pulse"}}
+	case err != nil:
+		event.Outcome = OutcomeError
+		event.Detail = "ERROR: " + err.Error()
+		highlights = []protocol.Highlight{}
+		if txID != "" {
+			highlights = append(highlights, protocol.Highlight{Type: "row", ID: txID, Color: "#ef4444", Animation: "shake"})
+		}
+		highlights = append(highlights, structureHighlights(err)...)
+	default:
+		for _, c := range run.store.RWConflicts[conflicts:] {
+			event.Detail += fmt.Sprintf(". New rw-antidependency %s -> %s: %s read a version of %s that %s replaced",
+				c.Reader, c.Writer, c.Reader, c.RowID, c.Writer)
+			highlights = append(highlights, protocol.Highlight{Type: "edge", ID: c.EdgeID(), Color: "#f59e0b", Animation: "fadeIn"})
+		}
+	}
+	if resumed {
+		event.Detail = "Resumed. " + event.Detail
+	}
+	sim.recordStatement(run, st, event, highlights)
+
+	sim.wakeWaiters(run)
+}
+
+// wakeWaiters resumes blocked sessions whose holder has finished, running
+// their queued statements until the queue empties or they block again
+func (sim *MVCCSimulation) wakeWaiters(run *scriptRun) {
+	for _, lane := range run.lanes {
+		queue, waiting := run.blocked[lane.Session]
+		if !waiting {
+			continue
+		}
+		tx := run.store.Transactions[run.sessions[lane.Session]]
+		if holder := run.store.Transactions[tx.WaitingFor]; holder != nil && holder.Status == internal.TxActive {
+			continue
+		}
+
+		delete(run.blocked, lane.Session)
+		for i, st := range queue {
+			sim.execute(run, st, true)
+			if _, again := run.blocked[lane.Session]; again {
+				run.blocked[lane.Session] = append(run.blocked[lane.Session], queue[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// recordStatement adds a statement's event to its lane and a step for it
+func (sim *MVCCSimulation) recordStatement(run *scriptRun, st internal.Statement, event LaneEvent, highlights []protocol.Highlight) {
+	event.Step = len(sim.steps)
+	event.Statement = st.String()
+	lane := run.lane(st.Session)
+	lane.Events = append(lane.Events, event)
+	run.history = append(run.history, run.store.Stats())
+	sim.addDataStep(st.String(), event.Detail, highlights, sim.scriptData(run, &st))
+}
+
+// runStatement applies one statement to the store and describes the outcome
+func (sim *MVCCSimulation) runStatement(run *scriptRun, st internal.Statement) (string, []protocol.Highlight, error) {
+	store := run.store
+	txID, open := run.sessions[st.Session]
+	if st.NeedsTransaction() && !open {
+		return "", nil, fmt.Errorf("%s has no open transaction; it must BEGIN first", st.Session)
+	}
+	txHighlight := func(color string) protocol.Highlight {
+		return protocol.Highlight{Type: "row", ID: txID, Color: color, Animation: "pulse"}
+	}
+
+	// A conflict already aborted the transaction. As in PostgreSQL, nothing
+	// but the end of the transaction block is accepted, and COMMIT rolls back.
+	if open && store.Transactions[txID].Status == internal.TxAborted {
+		switch st.Command {
+		case internal.CmdCommit, internal.CmdAbort:
+			delete(run.sessions, st.Session)
+			return fmt.Sprintf("%s was aborted by its error, so %s ends it with a rollback", txID, st.Command),
+				[]protocol.Highlight{{Type: "row", ID: txID, Color: "#ef4444"}}, nil
+		}
+		return "", nil, fmt.Errorf("current transaction %s is aborted, commands ignored until end of transaction block", txID)
+	}
+
+	switch st.Command {
+	case internal.CmdBegin:
+		if open {
+			return "", nil, fmt.Errorf("%s already has open transaction %s", st.Session, txID)
+		}
+		tx := store.BeginTransaction(st.Isolation)
+		txID = tx.ID
+		run.sessions[st.Session] = tx.ID
+		lane := run.lane(st.Session)
+		lane.Transactions = append(lane.Transactions, tx.ID)
+
+		detail := fmt.Sprintf("%s begins %s at %s with a snapshot at timestamp %d", st.Session, tx.ID, tx.Isolation.SQL(), tx.Snapshot.Timestamp)
+		if store.Model == internal.ModelPostgres {
+			detail = fmt.Sprintf("%s begins %s (xid %d) at %s with snapshot %s", st.Session, tx.ID, tx.Xid, tx.Isolation.SQL(), tx.PGSnapshot)
+		}
+		if len(tx.Snapshot.Concurrent) > 0 && tx.SnapshotKind() == "transaction snapshot" {
+			detail += fmt.Sprintf(". Changes of %s, still active, stay invisible to %s even after they commit",
+				strings.Join(tx.Snapshot.Concurrent, ", "), tx.ID)
+		}
+		return detail, []protocol.Highlight{txHighlight("#10b981")}, nil
+
+	case internal.CmdRead:
+		if st.AsOf != 0 {
+			ver, checks, err := store.ReadAsOfExplained(st.Row, st.AsOf)
+			if err != nil {
+				return "", nil, err
+			}
+			detail := fmt.Sprintf("%s reads %s as of timestamp %d and sees %s %v. %s",
+				st.Session, st.Row, st.AsOf, ver.ID, ver.Data, checks[len(checks)-1].Visibility.Reason)
+			for _, check := range checks[:len(checks)-1] {
+				detail += fmt.Sprintf(". It skips %s: %s", check.VersionID, check.Visibility.Reason)
+			}
+			return detail, []protocol.Highlight{{Type: "cell", ID: ver.ID, Color: "#8b5cf6", Animation: "pulse"}}, nil
+		}
+		tx := store.Transactions[txID]
+		ver, checks, err := store.ReadExplained(txID, st.Row)
+		if err != nil {
+			return "", nil, err
+		}
+		snapshot := fmt.Sprintf("at timestamp %d", tx.Snapshot.Timestamp)
+		if store.Model == internal.ModelPostgres {
+			snapshot = tx.PGSnapshot.String()
+		}
+		detail := fmt.Sprintf("%s (%s) reads %s through its %s %s and sees %s %v. %s",
+			st.Session, txID, st.Row, tx.SnapshotKind(), snapshot, ver.ID, ver.Data, checks[len(checks)-1].Visibility.Reason)
+		for _, check := range checks[:len(checks)-1] {
+			detail += fmt.Sprintf(". It skips %s: %s", check.VersionID, check.Visibility.Reason)
+		}
+		return detail, []protocol.Highlight{
+			txHighlight("#3b82f6"),
+			{Type: "cell", ID: ver.ID, Color: "#10b981", Animation: "pulse"},
+		}, nil
+
+	case internal.CmdScan:
+		tx := store.Transactions[txID]
+		versions, err := store.Scan(txID, st.Row)
+		if err != nil {
+			return "", nil, err
+		}
+		snapshot := fmt.Sprintf("at timestamp %d", tx.Snapshot.Timestamp)
+		if store.Model == internal.ModelPostgres {
+			snapshot = tx.PGSnapshot.String()
+		}
+		highlights := []protocol.Highlight{txHighlight("#3b82f6")}
+		rows := []string{}
+		for _, ver := range versions {
+			rows = append(rows, fmt.Sprintf("%s=%s", ver.RowID, ver.ID))
+			highlights = append(highlights, protocol.Highlight{Type: "cell", ID: ver.ID, Color: "#10b981", Animation: "pulse"})
+		}
+		detail := fmt.Sprintf("%s (%s) scans %s through its %s %s and finds no rows", st.Session, txID, st.Row, tx.SnapshotKind(), snapshot)
+		if len(rows) > 0 {
+			detail = fmt.Sprintf("%s (%s) scans %s through its %s %s and finds %d row(s): %s",
+				st.Session, txID, st.Row, tx.SnapshotKind(), snapshot, len(rows), strings.Join(rows, ", "))
+		}
+		return detail, highlights, nil
+
+	case internal.CmdWrite:
+		ver, err := store.Write(txID, st.Row, st.Data)
+		if err != nil {
+			return "", nil, err
+		}
+		detail := fmt.Sprintf("%s (%s) writes %s as new version %s %v. Until %s commits, only it can see this version",
+			st.Session, txID, st.Row, ver.ID, ver.Data, txID)
+		return detail, []protocol.Highlight{
+			txHighlight("#f59e0b"),
+			{Type: "cell", ID: ver.ID, Color: "#10b981", Animation: "fadeIn"},
+		}, nil
+
+	case internal.CmdDelete:
+		ver, err := store.Delete(txID, st.Row)
+		if err != nil {
+			return "", nil, err
+		}
+		detail := fmt.Sprintf("%s (%s) marks %s, the version of %s it sees, deleted. Snapshots that see the delete once %s commits find no row",
+			st.Session, txID, ver.ID, st.Row, txID)
+		if *ver.DeletedBy != txID {
+			detail = fmt.Sprintf("%s (%s) also deletes %s, the version of %s it sees, which %s has already deleted. Under first-committer-wins both deletes stand, and the first of them to commit wins",
+				st.Session, txID, ver.ID, st.Row, *ver.DeletedBy)
+		}
+		return detail, []protocol.Highlight{
+			txHighlight("#f59e0b"),
+			{Type: "cell", ID: ver.ID, Color: "#ef4444", Animation: "pulse"},
+		}, nil
+
+	case internal.CmdCommit:
+		if err := store.Commit(txID); err != nil {
+			return "", nil, err
+		}
+		delete(run.sessions, st.Session)
+		tx := store.Transactions[txID]
+		detail := fmt.Sprintf("%s commits %s at timestamp %d. Transactions that begin from now on see its writes", st.Session, txID, *tx.CommitTime)
+		if active := store.ActiveTransactions(); len(active) > 0 {
+			detail += fmt.Sprintf("; the snapshots of %s, still active, are unchanged", strings.Join(active, ", "))
+		}
+		return detail, []protocol.Highlight{txHighlight("#10b981")}, nil
+
+	case internal.CmdAbort:
+		if err := store.Abort(txID); err != nil {
+			return "", nil, err
+		}
+		delete(run.sessions, st.Session)
+		return fmt.Sprintf("%s aborts %s: its versions are removed and its deletes undone", st.Session, txID),
+			[]protocol.Highlight{{Type: "row", ID: txID, Color: "#ef4444"}}, nil
+
+	case internal.CmdSavepoint:
+		sub, err := store.Savepoint(txID, st.Savepoint)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("%s (%s) sets savepoint %s, beginning subtransaction %s (xid %d) under %s",
+			st.Session, txID, st.Savepoint, sub.ID, sub.Xid, sub.Parent), []protocol.Highlight{txHighlight("#3b82f6")}, nil
+
+	case internal.CmdRollbackTo:
+		versions := len(store.Versions)
+		sub, err := store.RollbackToSavepoint(txID, st.Savepoint)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("%s (%s) rolls back to savepoint %s: %d version(s) written since are discarded and its deletes undone. The savepoint stays, with new subtransaction %s (xid %d)",
+			st.Session, txID, st.Savepoint, versions-len(store.Versions), sub.ID, sub.Xid), []protocol.Highlight{txHighlight("#f59e0b")}, nil
+
+	case internal.CmdRelease:
+		sub, err := store.ReleaseSavepoint(txID, st.Savepoint)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("%s (%s) releases savepoint %s: %s is sub-committed, so its writes belong to %s and stay invisible to others until %s commits",
+			st.Session, txID, st.Savepoint, sub.ID, sub.Parent, txID), []protocol.Highlight{txHighlight("#10b981")}, nil
+
+	case internal.CmdVacuum:
+		if open {
+			return "", nil, fmt.Errorf("VACUUM cannot run inside a transaction block")
+		}
+		report := store.Vacuum()
+		highlights := []protocol.Highlight{}
+		for _, verdict := range report.Verdicts {
+			if verdict.State == internal.TupleDead || verdict.State == internal.TupleRecentlyDead {
+				highlights = append(highlights, protocol.Highlight{Type: "cell", ID: verdict.VersionID, Color: tupleColors[verdict.State], Animation: "pulse"})
+			}
+		}
+		horizon := fmt.Sprintf("No transaction is active, so the horizon is the current timestamp %d", report.Horizon)
+		if report.HeldBy != "" {
+			horizon = fmt.Sprintf("The horizon is timestamp %d, held back by %s, whose snapshot is %d commit(s) old", report.Horizon, report.HeldBy, report.Lag)
+			highlights = append(highlights, protocol.Highlight{Type: "row", ID: report.HeldBy, Color: "#f59e0b", Animation: "pulse"})
+		}
+		return fmt.Sprintf("%s runs VACUUM. %s. %s", st.Session, horizon, vacuumSummary(report)), highlights, nil
+	}
+	return "", nil, fmt.Errorf("unknown command %q", st.Command)
+}
+
+// scriptData snapshots the store and lanes, with the statement just run
+func (sim *MVCCSimulation) scriptData(run *scriptRun, st *internal.Statement) map[string]interface{} {
+	data := storeData(run.store.Clone())
+	data["lanes"] = run.snapshot()
+	data["statsHistory"] = append([]internal.TableStats{}, run.history...)
+	if st != nil {
+		data["statement"] = *st
+	}
+	return data
+}
@@ -1,7 +1,9 @@
 package simulation
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/ersantana/db-internals/packages/protocol"
 	"github.com/ersantana/db-internals/packages/simulation/engine"
@@ -38,6 +40,32 @@ func (sim *MVCCSimulation) Description() string {
 // Initialize sets up the simulation with given config
 func (sim *MVCCSimulation) Initialize(config map[string]interface{}) error {
 	sim.store = internal.NewMVCCStore()
+	if mode, ok := config["conflictMode"].(string); ok && mode != "" {
+		switch internal.ConflictMode(mode) {
+		case internal.FirstUpdaterWins, internal.FirstCommitterWins:
+			sim.store.ConflictMode = internal.ConflictMode(mode)
+		default:
+			return fmt.Errorf("unknown conflict mode %q", mode)
+		}
+	}
+	if name, ok := config["isolationLevel"].(string); ok && name != "" {
+		level, err := internal.ParseIsolationLevel(name)
+		if err != nil {
+			return err
+		}
+		sim.store.Isolation = level
+	}
+	if model, ok := config["visibilityModel"].(string); ok && model != "" {
+		switch internal.VisibilityModel(model) {
+		case internal.ModelTimestamp, internal.ModelPostgres:
+			sim.store.Model = internal.VisibilityModel(model)
+		default:
+			return fmt.Errorf("unknown visibility model %q", model)
+		}
+	}
+	if blocking, ok := config["blocking"].(bool); ok {
+		sim.store.Blocking = blocking
+	}
 
 	// Pre-populate with initial data if specified
 	if populate, ok := config["initialData"].(bool); ok && populate {
@@ -51,7 +79,12 @@ func (sim *MVCCSimulation) Initialize(config map[string]interface{}) error {
 
 // Reset returns the simulation to initial state
 func (sim *MVCCSimulation) Reset() error {
+	mode, level, model, blocking := sim.store.ConflictMode, sim.store.Isolation, sim.store.Model, sim.store.Blocking
 	sim.store = internal.NewMVCCStore()
+	sim.store.ConflictMode = mode
+	sim.store.Isolation = level
+	sim.store.Model = model
+	sim.store.Blocking = blocking
 	sim.steps = make([]engine.Step, 0)
 	sim.currentStep = -1
 	return nil
@@ -79,10 +112,15 @@ func (sim *MVCCSimulation) ExecuteStep(index int) engine.StepResult {
 	sim.currentStep = index
 	step := sim.steps[index]
 
+	data := step.Data
+	if data == nil {
+		data = sim.GetVisualizationData()
+	}
+
 	return engine.StepResult{
 		Success:     true,
 		Highlights:  step.Highlights,
-		Data:        sim.GetVisualizationData(),
+		Data:        data,
 		Description: step.Description,
 	}
 }
@@ -111,17 +149,30 @@ func (sim *MVCCSimulation) GetState() interface{} {
 
 // GetVisualizationData returns data for rendering
 func (sim *MVCCSimulation) GetVisualizationData() map[string]interface{} {
+	return storeData(sim.store)
+}
+
+// storeData is the visualization data for a store. Pass a clone to keep a
+// step's snapshot fixed while later steps modify the store.
+func storeData(store *internal.MVCCStore) map[string]interface{} {
 	return map[string]interface{}{
-		"transactions":      sim.store.Transactions,
-		"versions":          sim.store.Versions,
-		"rows":              sim.store.Rows,
-		"globalTimestamp":   sim.store.GlobalTimestamp,
-		"activeTransaction": sim.store.ActiveTransaction,
+		"transactions":       store.Transactions,
+		"versions":           store.Versions,
+		"rows":               store.Rows,
+		"globalTimestamp":    store.GlobalTimestamp,
+		"activeTransactions": store.ActiveTransactions(),
+		"dependencyGraph":    store.DependencyGraph(),
+		"model":              store.Model,
+		"clog":               store.Clog,
+		"heapPage":           store.HeapPage(),
+		"stats":              store.Stats(),
+		"subtransactions":    store.SubxactTrees(),
 	}
 }
 
-// PrepareBeginTransaction generates steps for beginning a transaction
-func (sim *MVCCSimulation) PrepareBeginTransaction() {
+// PrepareBeginTransaction generates steps for beginning a transaction at an
+// isolation level, or the store's default if it is empty
+func (sim *MVCCSimulation) PrepareBeginTransaction(level internal.IsolationLevel) {
 	sim.operation = "begin"
 	sim.steps = make([]engine.Step, 0)
 	sim.currentStep = -1
@@ -134,16 +185,16 @@ func (sim *MVCCSimulation) PrepareBeginTransaction() {
 		[]protocol.Highlight{},
 	)
 
-	tx := storeCopy.BeginTransaction()
+	tx := storeCopy.BeginTransaction(level)
 
 	sim.addStep(
 		"Transaction Started",
-		fmt.Sprintf("Created transaction %s with start time %d", tx.ID, tx.StartTime),
+		fmt.Sprintf("Created transaction %s at %s with start time %d", tx.ID, tx.Isolation.SQL(), tx.StartTime),
 		[]protocol.Highlight{{Type: "row", ID: tx.ID, Color: "#10b981", Animation: "pulse"}},
 	)
 
 	// Apply to actual store
-	sim.store.BeginTransaction()
+	sim.store.BeginTransaction(level)
 }
 
 // PrepareRead generates steps for a read operation
@@ -172,61 +223,63 @@ func (sim *MVCCSimulation) PrepareRead(txID, rowID string) {
 		return
 	}
 
+	// Apply the read first: levels with a snapshot per statement take it now,
+	// and under the postgres model the checks set hint bits as they go
+	ver, checks, err := sim.store.ReadExplained(txID, rowID)
+
+	snapshot := fmt.Sprintf("its %s at %d", tx.SnapshotKind(), tx.Snapshot.Timestamp)
+	if sim.store.Model == internal.ModelPostgres {
+		snapshot = fmt.Sprintf("its %s %s (xmin:xmax:xip) with curcid %d", tx.SnapshotKind(), tx.PGSnapshot, tx.PGSnapshot.Curcid)
+	}
 	sim.addStep(
 		fmt.Sprintf("Read %s", rowID),
-		fmt.Sprintf("Transaction %s reading row %s at snapshot time %d", txID, rowID, tx.StartTime),
+		fmt.Sprintf("Transaction %s (%s) reading row %s through %s", txID, tx.Isolation.SQL(), rowID, snapshot),
 		[]protocol.Highlight{
 			{Type: "row", ID: txID, Color: "#3b82f6", Animation: "pulse"},
 		},
 	)
 
-	// Walk through version chain
-	for _, verID := range row.VersionChain {
-		ver := sim.store.Versions[verID]
-		creatorTx := sim.store.Transactions[ver.CreatedBy]
-
-		visible := false
-		reason := ""
-
-		if ver.CreatedBy == txID {
-			visible = true
-			reason = "Created by current transaction"
-		} else if creatorTx.Status != internal.TxCommitted {
-			reason = fmt.Sprintf("Creator transaction %s not committed", ver.CreatedBy)
-		} else if creatorTx.CommitTime == nil || *creatorTx.CommitTime > tx.StartTime {
-			reason = fmt.Sprintf("Committed at %d, after our snapshot %d", *creatorTx.CommitTime, tx.StartTime)
-		} else {
-			visible = true
-			reason = fmt.Sprintf("Committed at %d, before our snapshot %d", *creatorTx.CommitTime, tx.StartTime)
+	// Walk through version chain, one step per rule the check applied
+	for _, check := range checks {
+		for i, rule := range check.Visibility.Steps {
+			sim.addStep(
+				fmt.Sprintf("Check %s (%d/%d)", check.VersionID, i+1, len(check.Visibility.Steps)),
+				rule,
+				[]protocol.Highlight{
+					{Type: "cell", ID: check.VersionID, Color: "#3b82f6", Animation: "pulse"},
+				},
+			)
 		}
 
 		color := "#ef4444" // Not visible
-		if visible {
+		if check.Visibility.Visible {
 			color = "#10b981"
 		}
 
 		sim.addStep(
-			fmt.Sprintf("Check %s", verID),
-			reason,
+			fmt.Sprintf("Check %s: %s", check.VersionID, check.Visibility.Rule),
+			check.Visibility.Reason,
 			[]protocol.Highlight{
-				{Type: "cell", ID: verID, Color: color, Animation: "pulse"},
+				{Type: "cell", ID: check.VersionID, Color: color, Animation: "pulse"},
 			},
 		)
+	}
 
-		if visible {
-			sim.addStep(
-				"Version Found",
-				fmt.Sprintf("Reading version %s with data: %v", verID, ver.Data),
-				[]protocol.Highlight{
-					{Type: "cell", ID: verID, Color: "#10b981", Animation: "pulse"},
-				},
-			)
-			break
+	if err != nil {
+		title := "No Visible Version"
+		if len(checks) > 0 && checks[len(checks)-1].Visibility.Rule == internal.RuleDeleted {
+			title = "Row Deleted"
 		}
+		sim.addStep(title, err.Error(), []protocol.Highlight{})
+		return
 	}
-
-	// Apply the read
-	sim.store.Read(txID, rowID)
+	sim.addStep(
+		"Version Found",
+		fmt.Sprintf("Reading version %s with data: %v", ver.ID, ver.Data),
+		[]protocol.Highlight{
+			{Type: "cell", ID: ver.ID, Color: "#10b981", Animation: "pulse"},
+		},
+	)
 }
 
 // PrepareWrite generates steps for a write operation
@@ -271,7 +324,11 @@ func (sim *MVCCSimulation) PrepareWrite(txID, rowID string, data map[string]inte
 	}
 
 	// Apply the write
-	ver, _ := sim.store.Write(txID, rowID, data)
+	ver, err := sim.store.Write(txID, rowID, data)
+	if err != nil {
+		sim.addConflictStep(txID, err)
+		return
+	}
 
 	sim.addStep(
 		"Version Created",
@@ -282,6 +339,52 @@ func (sim *MVCCSimulation) PrepareWrite(txID, rowID string, data map[string]inte
 	)
 }
 
+// PrepareDelete generates steps for a delete operation
+func (sim *MVCCSimulation) PrepareDelete(txID, rowID string) {
+	sim.operation = "delete"
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+
+	tx := sim.store.Transactions[txID]
+	if tx == nil {
+		sim.addStep(
+			"Error",
+			fmt.Sprintf("Transaction %s not found", txID),
+			[]protocol.Highlight{},
+		)
+		return
+	}
+
+	sim.addStep(
+		fmt.Sprintf("Delete %s", rowID),
+		fmt.Sprintf("Transaction %s deleting row %s: it marks the version it sees rather than the newest one", txID, rowID),
+		[]protocol.Highlight{
+			{Type: "row", ID: txID, Color: "#f59e0b", Animation: "pulse"},
+		},
+	)
+
+	// Apply the delete
+	ver, err := sim.store.Delete(txID, rowID)
+	if err != nil {
+		sim.addConflictStep(txID, err)
+		return
+	}
+
+	description := fmt.Sprintf("Version %s is marked deleted by %s at %d. It stays in the chain for snapshots that cannot see the delete; once %s commits, later snapshots find no row",
+		ver.ID, txID, *ver.DeletedAt, txID)
+	if *ver.DeletedBy != txID {
+		description = fmt.Sprintf("Version %s is already marked deleted by %s. Under first-committer-wins %s's delete stands beside it, and whichever commits first wins; the other fails at commit",
+			ver.ID, *ver.DeletedBy, txID)
+	}
+	sim.addStep(
+		"Tombstone Set",
+		description,
+		[]protocol.Highlight{
+			{Type: "cell", ID: ver.ID, Color: "#ef4444", Animation: "pulse"},
+		},
+	)
+}
+
 // PrepareCommit generates steps for committing a transaction
 func (sim *MVCCSimulation) PrepareCommit(txID string) {
 	sim.operation = "commit"
@@ -321,7 +424,10 @@ func (sim *MVCCSimulation) PrepareCommit(txID string) {
 	}
 
 	// Apply the commit
-	sim.store.Commit(txID)
+	if err := sim.store.Commit(txID); err != nil {
+		sim.addConflictStep(txID, err)
+		return
+	}
 	tx = sim.store.Transactions[txID]
 
 	sim.addStep(
@@ -388,60 +494,314 @@ func (sim *MVCCSimulation) PrepareAbort(txID string) {
 	)
 }
 
-// PrepareGarbageCollect generates steps for garbage collection
-func (sim *MVCCSimulation) PrepareGarbageCollect() {
-	sim.operation = "gc"
+// PrepareReadAsOf generates steps for reading a row as it was committed at
+// timestamp ts, outside any transaction
+func (sim *MVCCSimulation) PrepareReadAsOf(rowID string, ts int64) {
+	sim.operation = "read-as-of"
 	sim.steps = make([]engine.Step, 0)
 	sim.currentStep = -1
 
 	sim.addStep(
-		"Garbage Collection",
-		"Starting garbage collection to remove old versions",
+		fmt.Sprintf("Read %s As Of %d", rowID, ts),
+		fmt.Sprintf("Reading row %s as a snapshot taken at timestamp %d would have: the newest version committed by then, unless a delete committed by then", rowID, ts),
 		[]protocol.Highlight{},
 	)
 
-	// Find oldest active transaction
-	oldestActive := sim.store.GlobalTimestamp
-	for _, tx := range sim.store.Transactions {
-		if tx.Status == internal.TxActive && tx.StartTime < oldestActive {
-			oldestActive = tx.StartTime
+	ver, checks, err := sim.store.ReadAsOfExplained(rowID, ts)
+	for _, check := range checks {
+		color := "#ef4444" // Not visible
+		if check.Visibility.Visible {
+			color = "#10b981"
 		}
+		sim.addStep(
+			fmt.Sprintf("Check %s: %s", check.VersionID, check.Visibility.Rule),
+			check.Visibility.Reason,
+			[]protocol.Highlight{{Type: "cell", ID: check.VersionID, Color: color, Animation: "pulse"}},
+		)
 	}
 
+	if err != nil {
+		title := "No Version"
+		if errors.Is(err, internal.ErrHistoryRemoved) {
+			title = "History Removed"
+		}
+		sim.addStep(title, err.Error(), []protocol.Highlight{})
+		return
+	}
 	sim.addStep(
-		"Find Threshold",
-		fmt.Sprintf("Oldest active transaction started at %d, can remove versions older than this", oldestActive),
-		[]protocol.Highlight{},
+		"Read Complete",
+		fmt.Sprintf("At timestamp %d, %s was %s %v", ts, rowID, ver.ID, ver.Data),
+		[]protocol.Highlight{{Type: "cell", ID: ver.ID, Color: "#10b981", Animation: "pulse"}},
+	)
+}
+
+// TimeTravelFrame is the table as it was committed at one timestamp
+type TimeTravelFrame struct {
+	Timestamp int64                        `json:"timestamp"`
+	Committed []string                     `json:"committed"` // Transactions that committed at this timestamp
+	Rows      map[string]*internal.Version `json:"rows"`      // Row ID -> its version then
+	Removed   bool                         `json:"removed"`   // Before the GC threshold, so not replayable
+}
+
+// PrepareTimeTravel generates one step per timestamp, replaying the table as
+// it was committed at each. Timestamps before the GC threshold cannot be
+// replayed: VACUUM removed versions they need, which is the price of
+// reclaiming the space.
+func (sim *MVCCSimulation) PrepareTimeTravel() {
+	sim.operation = "time-travel"
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+
+	// Replaying only reads, so every frame can share one copy
+	store := sim.store.Clone()
+	description := fmt.Sprintf("Replaying the table at each timestamp from 1 to %d", store.GlobalTimestamp)
+	if store.GCThreshold > 0 {
+		description += fmt.Sprintf(". History before the GC threshold %d has been removed by VACUUM", store.GCThreshold)
+	}
+	sim.addStep("Time Travel", description, []protocol.Highlight{})
+
+	frames := []TimeTravelFrame{}
+	for ts := int64(1); ts <= store.GlobalTimestamp; ts++ {
+		frame := TimeTravelFrame{Timestamp: ts, Committed: store.CommittedAt(ts), Rows: map[string]*internal.Version{}}
+
+		highlights := []protocol.Highlight{}
+		rows := []string{}
+		versions, err := store.ScanAsOf(ts)
+		if err != nil {
+			frame.Removed = true
+		}
+		for _, ver := range versions {
+			frame.Rows[ver.RowID] = ver
+			rows = append(rows, fmt.Sprintf("%s=%s", ver.RowID, ver.ID))
+			highlights = append(highlights, protocol.Highlight{Type: "cell", ID: ver.ID, Color: "#8b5cf6"})
+		}
+		frames = append(frames, frame)
+
+		description := fmt.Sprintf("The table had %d row(s): %s", len(rows), strings.Join(rows, ", "))
+		switch {
+		case frame.Removed:
+			description = fmt.Sprintf("This state can no longer be replayed: %s", err)
+		case len(rows) == 0:
+			description = "The table was empty"
+		}
+		if len(frame.Committed) > 0 {
+			description = fmt.Sprintf("%s committed. %s", strings.Join(frame.Committed, ", "), description)
+		}
+
+		data := storeData(store)
+		data["frames"] = append([]TimeTravelFrame{}, frames...)
+		data["asOf"] = ts
+		sim.addDataStep(fmt.Sprintf("As Of %d", ts), description, highlights, data)
+	}
+}
+
+// PrepareSavepoint generates steps for setting a savepoint, which begins a
+// subtransaction inside the transaction's innermost one
+func (sim *MVCCSimulation) PrepareSavepoint(txID, name string) {
+	sim.operation = "savepoint"
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+
+	sub, err := sim.store.Savepoint(txID, name)
+	if err != nil {
+		sim.addStep("Error", err.Error(), []protocol.Highlight{})
+		return
+	}
+	sim.addDataStep(
+		fmt.Sprintf("Savepoint %s", name),
+		fmt.Sprintf("%s begins subtransaction %s (xid %d) under %s. Its writes carry xid %d, so rolling back to %s discards just them",
+			txID, sub.ID, sub.Xid, sub.Parent, sub.Xid, name),
+		[]protocol.Highlight{{Type: "row", ID: txID, Color: "#3b82f6", Animation: "pulse"}},
+		storeData(sim.store.Clone()),
 	)
+}
+
+// PrepareRollbackToSavepoint generates steps for rolling back to a savepoint:
+// the subtransactions discarded, each version removed, and the savepoint's
+// new subtransaction
+func (sim *MVCCSimulation) PrepareRollbackToSavepoint(txID, name string) {
+	sim.operation = "rollback-to-savepoint"
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
 
-	removed := sim.store.GarbageCollect()
+	before := sim.store.Clone()
+	sub, err := sim.store.RollbackToSavepoint(txID, name)
+	if err != nil {
+		sim.addStep("Error", err.Error(), []protocol.Highlight{})
+		return
+	}
 
-	if len(removed) > 0 {
-		for _, verID := range removed {
+	sim.addStep(
+		fmt.Sprintf("Rollback to %s", name),
+		fmt.Sprintf("%s aborts the subtransaction begun by savepoint %s and every subtransaction nested in it, released or not", txID, name),
+		[]protocol.Highlight{{Type: "row", ID: txID, Color: "#f59e0b", Animation: "pulse"}},
+	)
+	for _, discarded := range sim.store.Transactions[txID].Subxacts {
+		for _, verID := range discarded.Discarded {
+			if before.Versions[verID] == nil {
+				continue // Discarded by an earlier rollback
+			}
 			sim.addStep(
-				fmt.Sprintf("Remove %s", verID),
-				fmt.Sprintf("Removed old version %s", verID),
-				[]protocol.Highlight{
-					{Type: "cell", ID: verID, Color: "#ef4444", Animation: "pulse"},
-				},
+				fmt.Sprintf("Discard %s", verID),
+				fmt.Sprintf("%s was written by %s, which rolled back, so it is removed", verID, discarded.ID),
+				[]protocol.Highlight{{Type: "cell", ID: verID, Color: "#ef4444", Animation: "shake"}},
 			)
 		}
 	}
+	sim.addDataStep(
+		"Savepoint Restored",
+		fmt.Sprintf("Savepoint %s remains, now with subtransaction %s (xid %d). %s's writes before the savepoint are untouched",
+			name, sub.ID, sub.Xid, txID),
+		[]protocol.Highlight{{Type: "row", ID: txID, Color: "#10b981"}},
+		storeData(sim.store.Clone()),
+	)
+}
+
+// PrepareReleaseSavepoint generates steps for releasing a savepoint
+func (sim *MVCCSimulation) PrepareReleaseSavepoint(txID, name string) {
+	sim.operation = "release-savepoint"
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
+
+	sub, err := sim.store.ReleaseSavepoint(txID, name)
+	if err != nil {
+		sim.addStep("Error", err.Error(), []protocol.Highlight{})
+		return
+	}
+	sim.addDataStep(
+		fmt.Sprintf("Release %s", name),
+		fmt.Sprintf("Subtransaction %s is sub-committed: its writes now belong to %s, which sees them as its own. Other transactions treat them as in progress until %s commits",
+			sub.ID, sub.Parent, txID),
+		[]protocol.Highlight{{Type: "row", ID: txID, Color: "#10b981", Animation: "pulse"}},
+		storeData(sim.store.Clone()),
+	)
+}
+
+// tupleColors colors versions by VACUUM state
+var tupleColors = map[string]string{
+	internal.TupleLive:         "#10b981",
+	internal.TupleInProgress:   "#3b82f6",
+	internal.TupleRecentlyDead: "#f59e0b",
+	internal.TupleDead:         "#ef4444",
+}
+
+// PrepareGarbageCollect generates steps for a VACUUM: the horizon and the
+// transaction holding it back, the verdict on every version, and what was
+// removed
+func (sim *MVCCSimulation) PrepareGarbageCollect() {
+	sim.operation = "gc"
+	sim.steps = make([]engine.Step, 0)
+	sim.currentStep = -1
 
 	sim.addStep(
-		"GC Complete",
-		fmt.Sprintf("Garbage collection complete, removed %d versions", len(removed)),
+		"Vacuum",
+		"VACUUM finds the horizon, the oldest snapshot any active transaction reads through, and removes the versions no snapshot can read",
 		[]protocol.Highlight{},
 	)
+
+	report := sim.store.Vacuum()
+
+	if report.HeldBy != "" {
+		sim.addStep(
+			"Find Horizon",
+			fmt.Sprintf("The horizon is timestamp %d, held back by %s, whose snapshot was taken then. Versions replaced by the %d commit(s) since stay until it ends",
+				report.Horizon, report.HeldBy, report.Lag),
+			[]protocol.Highlight{{Type: "row", ID: report.HeldBy, Color: "#f59e0b", Animation: "pulse"}},
+		)
+	} else {
+		sim.addStep(
+			"Find Horizon",
+			fmt.Sprintf("No transaction is active, so the horizon is the current timestamp %d and every replaced or deleted version is removable", report.Horizon),
+			[]protocol.Highlight{},
+		)
+	}
+
+	for _, verdict := range report.Verdicts {
+		sim.addStep(
+			fmt.Sprintf("%s: %s", verdict.VersionID, verdict.State),
+			verdict.Reason,
+			[]protocol.Highlight{{Type: "cell", ID: verdict.VersionID, Color: tupleColors[verdict.State]}},
+		)
+	}
+
+	for _, verID := range report.Removed {
+		sim.addStep(
+			fmt.Sprintf("Remove %s", verID),
+			fmt.Sprintf("Removed dead version %s", verID),
+			[]protocol.Highlight{{Type: "cell", ID: verID, Color: "#ef4444", Animation: "pulse"}},
+		)
+	}
+	for _, rowID := range report.RemovedRows {
+		sim.addStep(
+			fmt.Sprintf("Remove %s", rowID),
+			fmt.Sprintf("Every version of %s was dead, so the row is gone", rowID),
+			[]protocol.Highlight{},
+		)
+	}
+
+	data := storeData(sim.store.Clone())
+	data["vacuum"] = report
+	sim.addDataStep("Vacuum Complete", vacuumSummary(report), []protocol.Highlight{}, data)
+}
+
+// vacuumSummary describes what a VACUUM removed, what it had to keep, and
+// the bloat before and after
+func vacuumSummary(report internal.VacuumReport) string {
+	summary := fmt.Sprintf("Removed %d dead version(s)", len(report.Removed))
+	if len(report.RemovedRows) > 0 {
+		summary += fmt.Sprintf(" and row(s) %s", strings.Join(report.RemovedRows, ", "))
+	}
+	if kept := report.After.DeadTuples; kept > 0 {
+		summary += fmt.Sprintf("; kept %d recently dead version(s) that %s's snapshot may still read", kept, report.HeldBy)
+	}
+	return summary + fmt.Sprintf(". Dead tuples %d -> %d, bloat %.0f%% -> %.0f%%",
+		report.Before.DeadTuples, report.After.DeadTuples, report.Before.BloatRatio*100, report.After.BloatRatio*100)
 }
 
-// Helper method
+// Helper methods
+
+// addConflictStep records a write or commit that failed or must wait
+func (sim *MVCCSimulation) addConflictStep(txID string, err error) {
+	title, color, animation := "Error", "#ef4444", "shake"
+	switch {
+	case errors.Is(err, internal.ErrWouldBlock):
+		title, color, animation = "Blocked", "#f59e0b", "pulse"
+	case errors.Is(err, internal.ErrSerializationFailure):
+		title = "Serialization Failure"
+	case errors.Is(err, internal.ErrDeadlock):
+		title = "Deadlock"
+	}
+	highlights := []protocol.Highlight{{Type: "row", ID: txID, Color: color, Animation: animation}}
+	sim.addStep(title, err.Error(), append(highlights, structureHighlights(err)...))
+}
+
+// structureHighlights marks the two edges of the dangerous structure behind
+// an ErrDependencies failure in the dependency graph
+func structureHighlights(err error) []protocol.Highlight {
+	var conflict *internal.ConflictError
+	if !errors.As(err, &conflict) || conflict.Structure == nil {
+		return nil
+	}
+	highlights := []protocol.Highlight{}
+	for _, edge := range conflict.Structure.Edges() {
+		highlights = append(highlights, protocol.Highlight{Type: "edge", ID: edge, Color: "#ef4444", Animation: "flash"})
+	}
+	return highlights
+}
+
+// addStep records a step rendered with the store's state when it is executed
 func (sim *MVCCSimulation) addStep(title, description string, highlights []protocol.Highlight) {
+	sim.addDataStep(title, description, highlights, nil)
+}
+
+// addDataStep records a step with the data snapshot it should render
+func (sim *MVCCSimulation) addDataStep(title, description string, highlights []protocol.Highlight, data map[string]interface{}) {
 	step := engine.Step{
 		Index:       len(sim.steps),
 		Title:       title,
 		Description: description,
 		Highlights:  highlights,
+		Data:        data,
 	}
 	sim.steps = append(sim.steps, step)
 }